@@ -0,0 +1,164 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// values of ADX encoding type
+const (
+	ADXEncodingFixed       = 2
+	ADXEncodingStandard    = 3
+	ADXEncodingExponential = 4
+	ADXEncodingAHX         = 0x10
+	ADXEncodingAHX2        = 0x11
+)
+
+// ADXHeader is decoded header of CRI ADX audio stream.
+//
+// Header starts with 0x8000 and offset of "(c)CRI" copyright, which ends right before audio data.
+// Frames of every channel follow each other, each frame has 2 bytes of scale and 4-bit samples
+type ADXHeader struct {
+	// offset of the first frame from the start of the header
+	DataOffset int
+
+	EncodingType   byte
+	BlockSize      byte
+	SampleBitDepth byte
+	Channels       int
+	SampleRate     int
+	TotalSamples   uint32
+	HighpassFreq   uint16
+	Version        byte
+	Flags          byte
+
+	Loop *ADXLoop
+}
+
+// ADXLoop is loop region of the stream
+type ADXLoop struct {
+	StartSample uint32
+	StartByte   uint32
+	EndSample   uint32
+	EndByte     uint32
+}
+
+// Duration returns length of the stream in seconds
+func (h ADXHeader) Duration() float64 {
+	if h.SampleRate == 0 {
+		return 0
+	}
+
+	return float64(h.TotalSamples) / float64(h.SampleRate)
+}
+
+// Encrypted reports whether frames are encrypted by key
+func (h ADXHeader) Encrypted() bool {
+	return h.Flags == 0x08 || h.Flags == 0x09
+}
+
+var adxCopyright = []byte("(c)CRI")
+
+// ParseADXHeader decodes ADX header from the start of data
+func ParseADXHeader(data []byte) (ADXHeader, error) {
+	var h ADXHeader
+
+	if !looksLikeADX(data) {
+		return h, &ErrBadADXHeader{Reason: "no ADX signature"}
+	}
+
+	h.DataOffset = int(binary.BigEndian.Uint16(data[2:])) + 4
+	if h.DataOffset > len(data) || h.DataOffset < 0x14+len(adxCopyright) {
+		return h, &ErrBadADXHeader{Reason: fmt.Sprintf("header size %#x doesn't fit into %#x bytes", h.DataOffset, len(data))}
+	}
+
+	if !bytes.Equal(data[h.DataOffset-len(adxCopyright):h.DataOffset], adxCopyright) {
+		return h, &ErrBadADXHeader{Reason: "no copyright before audio data"}
+	}
+
+	h.EncodingType = data[4]
+	h.BlockSize = data[5]
+	h.SampleBitDepth = data[6]
+	h.Channels = int(data[7])
+	h.SampleRate = int(binary.BigEndian.Uint32(data[8:]))
+	h.TotalSamples = binary.BigEndian.Uint32(data[0xC:])
+	h.HighpassFreq = binary.BigEndian.Uint16(data[0x10:])
+	h.Version = data[0x12]
+	h.Flags = data[0x13]
+
+	if h.Channels == 0 || h.SampleRate == 0 {
+		return h, &ErrBadADXHeader{Reason: fmt.Sprintf("bad format: %d channels, %d Hz", h.Channels, h.SampleRate)}
+	}
+
+	// loop info has different position in versions 3 and 4, and is present only if header is big enough
+	var loopPos int
+	switch h.Version {
+	case 3:
+		loopPos = 0x18
+	case 4:
+		loopPos = 0x24
+	}
+
+	if loopPos != 0 && loopPos+0x14 <= h.DataOffset-len(adxCopyright) {
+		if binary.BigEndian.Uint32(data[loopPos:]) != 0 {
+			h.Loop = &ADXLoop{
+				StartSample: binary.BigEndian.Uint32(data[loopPos+0x4:]),
+				StartByte:   binary.BigEndian.Uint32(data[loopPos+0x8:]),
+				EndSample:   binary.BigEndian.Uint32(data[loopPos+0xC:]),
+				EndByte:     binary.BigEndian.Uint32(data[loopPos+0x10:]),
+			}
+		}
+	}
+
+	return h, nil
+}
+
+// looksLikeADX checks fixed fields of ADX header, enough to tell it from audio data
+func looksLikeADX(data []byte) bool {
+	if len(data) < 8 || data[0] != 0x80 || data[1] != 0x00 {
+		return false
+	}
+
+	switch data[4] {
+	case ADXEncodingFixed, ADXEncodingStandard, ADXEncodingExponential, ADXEncodingAHX, ADXEncodingAHX2:
+	default:
+		return false
+	}
+
+	return data[5] != 0 && data[6] == 4
+}
+
+// isADXHeader checks if chunk holds ADX header
+func isADXHeader(c Chunk) bool {
+	return looksLikeADX(c.payloadPrefix(8))
+}
+
+// ADXHeader decodes ADX header of audio stream with provided channel
+func (s *USMInfo) ADXHeader(channel byte) (ADXHeader, error) {
+	for _, c := range s.AudioStreams {
+		if c.Data.PayloadHeader.PayloadType != PayloadTypeStream || c.Data.PayloadHeader.ChannelNumber != channel {
+			continue
+		}
+
+		if isADXHeader(c) {
+			return readADXHeader(c)
+		}
+	}
+
+	return ADXHeader{}, fmt.Errorf("audio stream %d has no ADX header", channel)
+}
+
+func readADXHeader(c Chunk) (ADXHeader, error) {
+	payload, err := c.ReadPayload()
+	if err != nil {
+		return ADXHeader{}, err
+	}
+
+	h, err := ParseADXHeader(payload)
+	if err != nil {
+		return h, locate(err, c.payloadOffset(), c.Header.ID)
+	}
+
+	return h, nil
+}
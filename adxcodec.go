@@ -0,0 +1,256 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// bytes of every channel in ADX frame: 2 bytes of scale and 32 4-bit samples
+	adxBlockSize = 18
+	// samples of every channel in ADX frame
+	adxBlockSamples = (adxBlockSize - 2) * 2
+	// prediction coefficients are fixed-point with 12 bits of fraction
+	adxCoefBits = 12
+	// cutoff frequency used by CRI encoder
+	adxHighpassFreq = 500
+)
+
+// adxCoefs calculates prediction coefficients from highpass frequency
+func adxCoefs(highpass, sampleRate int) (int32, int32) {
+	z := math.Cos(2 * math.Pi * float64(highpass) / float64(sampleRate))
+	a := math.Sqrt2 - z
+	b := math.Sqrt2 - 1
+	c := (a - math.Sqrt((a+b)*(a-b))) / b
+
+	return int32(math.Floor(c * 2 * (1 << adxCoefBits))), int32(math.Floor(c * c * -(1 << adxCoefBits)))
+}
+
+// adxHistory keeps 2 previous samples of a channel
+type adxHistory struct {
+	s1, s2 int32
+}
+
+func (h *adxHistory) predict(coef1, coef2 int32) int32 {
+	return (coef1*h.s1 + coef2*h.s2) >> adxCoefBits
+}
+
+func (h *adxHistory) push(s int32) {
+	h.s2, h.s1 = h.s1, s
+}
+
+func clamp16(v int32) int32 {
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+
+	return v
+}
+
+// decodeADXBlock decodes block of single channel
+func decodeADXBlock(block []byte, coef1, coef2 int32, h *adxHistory, out []int16) {
+	scale := int32(binary.BigEndian.Uint16(block)&0x1FFF) + 1
+
+	for i := 0; i < adxBlockSamples; i++ {
+		nibble := block[2+i/2]
+		if i&1 == 0 {
+			nibble >>= 4
+		}
+		// sign-extend 4 bits
+		delta := int32(int8(nibble<<4) >> 4)
+
+		s := clamp16(delta*scale + h.predict(coef1, coef2))
+		h.push(s)
+		out[i] = int16(s)
+	}
+}
+
+// encodeADXBlock encodes 32 samples of single channel
+func encodeADXBlock(samples []int16, coef1, coef2 int32, h *adxHistory, block []byte) {
+	// first pass finds scale which fits prediction errors into 4 bits
+	var min, max int32
+	test := *h
+	for _, s := range samples {
+		d := int32(s) - test.predict(coef1, coef2)
+		if d > max {
+			max = d
+		}
+		if d < min {
+			min = d
+		}
+		test.push(int32(s))
+	}
+
+	scale := max / 7
+	if -min/8 > scale {
+		scale = -min / 8
+	}
+	// prediction in decoder uses decoded samples, so leave some room for errors
+	scale += scale / 8
+	if scale < 1 {
+		scale = 1
+	}
+	if scale > 0x2000 {
+		scale = 0x2000
+	}
+
+	binary.BigEndian.PutUint16(block, uint16(scale-1))
+	for i := 2; i < adxBlockSize; i++ {
+		block[i] = 0
+	}
+
+	for i, s := range samples {
+		predicted := h.predict(coef1, coef2)
+		d := int32(math.Round(float64(int32(s)-predicted) / float64(scale)))
+		if d > 7 {
+			d = 7
+		} else if d < -8 {
+			d = -8
+		}
+
+		nibble := byte(d) & 0x0F
+		if i&1 == 0 {
+			nibble <<= 4
+		}
+		block[2+i/2] |= nibble
+
+		h.push(clamp16(d*scale + predicted))
+	}
+}
+
+// EncodeADX makes ADX file from interleaved 16-bit samples
+func EncodeADX(samples []int16, sampleRate, channels int) ([]byte, error) {
+	if channels <= 0 || channels > 255 || sampleRate <= 0 {
+		return nil, fmt.Errorf("bad format: %d channels, %d Hz", channels, sampleRate)
+	}
+
+	total := len(samples) / channels
+	const dataOffset = 0x24
+
+	header := make([]byte, dataOffset)
+	header[0] = 0x80
+	binary.BigEndian.PutUint16(header[2:], dataOffset-4)
+	header[4] = ADXEncodingStandard
+	header[5] = adxBlockSize
+	header[6] = 4
+	header[7] = byte(channels)
+	binary.BigEndian.PutUint32(header[8:], uint32(sampleRate))
+	binary.BigEndian.PutUint32(header[0xC:], uint32(total))
+	binary.BigEndian.PutUint16(header[0x10:], adxHighpassFreq)
+	header[0x12] = 3
+	copy(header[dataOffset-len(adxCopyright):], adxCopyright)
+
+	coef1, coef2 := adxCoefs(adxHighpassFreq, sampleRate)
+	history := make([]adxHistory, channels)
+
+	frames := (total + adxBlockSamples - 1) / adxBlockSamples
+	out := bytes.NewBuffer(make([]byte, 0, dataOffset+frames*channels*adxBlockSize+adxBlockSize))
+	out.Write(header)
+
+	block := make([]byte, adxBlockSize)
+	channelSamples := make([]int16, adxBlockSamples)
+	for frame := 0; frame < frames; frame++ {
+		for ch := 0; ch < channels; ch++ {
+			for i := range channelSamples {
+				pos := (frame*adxBlockSamples + i) * channels
+				if pos+ch < len(samples) {
+					channelSamples[i] = samples[pos+ch]
+				} else {
+					channelSamples[i] = 0
+				}
+			}
+
+			encodeADXBlock(channelSamples, coef1, coef2, &history[ch], block)
+			out.Write(block)
+		}
+	}
+
+	// end of stream marker, followed by the size of padding
+	end := make([]byte, adxBlockSize)
+	end[0], end[1], end[3] = 0x80, 0x01, adxBlockSize-4
+	out.Write(end)
+
+	return out.Bytes(), nil
+}
+
+func decodeADX(chunks []Chunk, out io.Writer) error {
+	h, err := readADXHeader(chunks[0])
+	if err != nil {
+		return err
+	}
+
+	if h.Encrypted() {
+		return errors.New("encrypted ADX streams are not supported")
+	}
+
+	if h.EncodingType != ADXEncodingStandard || h.BlockSize != adxBlockSize || h.SampleBitDepth != 4 {
+		return fmt.Errorf("ADX encoding %d with %d-byte blocks is not supported", h.EncodingType, h.BlockSize)
+	}
+
+	if err = WriteWAVHeader(out, h.SampleRate, h.Channels, uint64(h.TotalSamples)); err != nil {
+		return err
+	}
+
+	buf, err := chunks[0].ReadPayload()
+	if err != nil {
+		return err
+	}
+	buf = buf[h.DataOffset:]
+
+	coef1, coef2 := adxCoefs(int(h.HighpassFreq), h.SampleRate)
+	history := make([]adxHistory, h.Channels)
+	frameSize := adxBlockSize * h.Channels
+	channelSamples := make([]int16, adxBlockSamples)
+	frameSamples := make([]int16, adxBlockSamples*h.Channels)
+	left := int(h.TotalSamples)
+
+	for i := 1; ; i++ {
+		for len(buf) >= frameSize && left > 0 {
+			// end marker
+			if buf[0] == 0x80 && buf[1] == 0x01 {
+				return fmt.Errorf("stream ended %d samples early", left)
+			}
+
+			for ch := 0; ch < h.Channels; ch++ {
+				decodeADXBlock(buf[ch*adxBlockSize:], coef1, coef2, &history[ch], channelSamples)
+				for j, s := range channelSamples {
+					frameSamples[j*h.Channels+ch] = s
+				}
+			}
+			buf = buf[frameSize:]
+
+			samples := frameSamples
+			if left < adxBlockSamples {
+				samples = samples[:left*h.Channels]
+			}
+			left -= len(samples) / h.Channels
+
+			if err = binary.Write(out, binary.LittleEndian, samples); err != nil {
+				return err
+			}
+		}
+
+		if left <= 0 || i >= len(chunks) {
+			break
+		}
+
+		payload, err := chunks[i].ReadPayload()
+		if err != nil {
+			return err
+		}
+		buf = append(buf, payload...)
+	}
+
+	if left > 0 {
+		return fmt.Errorf("stream ended %d samples early", left)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestADXRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		sampleRate int
+		channels   int
+		samples    int
+		// history starts from zero, so the first samples are less precise
+		minSNR float64
+	}{
+		{"mono", 44100, 1, 4410, 45},
+		{"stereo, partial frame", 48000, 2, 1000, 40},
+		{"shorter than frame", 32000, 2, 5, 15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := testTone(tt.sampleRate, tt.channels, tt.samples)
+
+			adx, err := EncodeADX(samples, tt.sampleRate, tt.channels)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			h, err := ParseADXHeader(adx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.SampleRate != tt.sampleRate || h.Channels != tt.channels || int(h.TotalSamples) != tt.samples {
+				t.Fatalf("header has %d samples of %d channels, %d Hz", h.TotalSamples, h.Channels, h.SampleRate)
+			}
+
+			// stream is split between chunks in the middle of a frame
+			split := int(h.DataOffset) + adxBlockSize*tt.channels + 5
+			chunks := []Chunk{
+				{Data: Data{Payload: adx[:split]}},
+				{Data: Data{Payload: adx[split:]}},
+			}
+
+			var out bytes.Buffer
+			if err = decodeADX(chunks, &out); err != nil {
+				t.Fatal(err)
+			}
+
+			wav, err := ReadWAV(&out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wav.Len() != tt.samples || wav.Channels != tt.channels {
+				t.Fatalf("decoded %d samples of %d channels", wav.Len(), wav.Channels)
+			}
+
+			if ratio := snr(samples, wav.Samples); ratio < tt.minSNR {
+				t.Fatalf("SNR is %.1f dB", ratio)
+			}
+		})
+	}
+}
+
+func TestADXTruncated(t *testing.T) {
+	adx, err := EncodeADX(testTone(44100, 1, 1000), 44100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err = decodeADX([]Chunk{{Data: Data{Payload: adx[:len(adx)/2]}}}, &out); err == nil {
+		t.Fatal("expected error")
+	}
+}
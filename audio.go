@@ -0,0 +1,221 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// AudioProperties describes format of a single audio stream
+type AudioProperties struct {
+	// value of audio_codec field from AUDIO_HDRINFO
+	Codec      int
+	SampleRate int
+	Channels   int
+	// number of samples per channel
+	Samples uint64
+}
+
+// Duration returns length of the stream in seconds
+func (p AudioProperties) Duration() float64 {
+	if p.SampleRate == 0 {
+		return 0
+	}
+
+	return float64(p.Samples) / float64(p.SampleRate)
+}
+
+// durationTolerance is difference between audio and video lengths, in seconds, which is still fine
+const durationTolerance = 0.5
+
+// AudioProperties reads format of audio stream with provided channel.
+// HCA or ADX header is preferred, AUDIO_HDRINFO is used for other codecs
+func (s *USMInfo) AudioProperties(channel byte) (AudioProperties, error) {
+	var props AudioProperties
+
+	chunks := s.streamOf(_SFA, channel)
+	if len(chunks) == 0 {
+		return props, fmt.Errorf("file has no audio stream with channel %d", channel)
+	}
+
+	switch audioHeaderCodec(chunks[0]) {
+	case audioCodecHCA:
+		h, err := readHCAHeader(chunks[0])
+		if err != nil {
+			return props, err
+		}
+
+		return AudioProperties{
+			Codec:      audioCodecHCA,
+			SampleRate: h.SampleRate,
+			Channels:   h.Channels,
+			Samples:    h.Samples(),
+		}, nil
+	case audioCodecADX:
+		h, err := readADXHeader(chunks[0])
+		if err != nil {
+			return props, err
+		}
+
+		return AudioProperties{
+			Codec:      audioCodecADX,
+			SampleRate: h.SampleRate,
+			Channels:   h.Channels,
+			Samples:    uint64(h.TotalSamples),
+		}, nil
+	}
+
+	hdr, ok := s.HDRInfo[_SFA]
+	if !ok {
+		return props, errors.New("file has no audio header info")
+	}
+
+	_, rows, err := hdr.Table()
+	if err != nil {
+		return props, fmt.Errorf("can't read audio header info: %w", err)
+	}
+
+	if len(rows) == 0 {
+		return props, errors.New("audio header info is empty")
+	}
+
+	value := func(key string) uint64 {
+		e, _ := GetEntry(rows[0], key)
+		return e.Uint()
+	}
+
+	props.Codec = int(value("audio_codec"))
+	props.SampleRate = int(value("sampling_rate"))
+	props.Channels = int(value("num_channels"))
+	props.Samples = value("total_samples")
+
+	return props, nil
+}
+
+// audioHeaderCodec returns codec of the header chunk holds, or 0 if it's not a header
+func audioHeaderCodec(c Chunk) int {
+	switch {
+	case isHCAHeader(c):
+		return audioCodecHCA
+	case isADXHeader(c):
+		return audioCodecADX
+	default:
+		return 0
+	}
+}
+
+// readAudioHeader decodes header of any supported codec
+func readAudioHeader(c Chunk) (interface{}, error) {
+	switch audioHeaderCodec(c) {
+	case audioCodecHCA:
+		return readHCAHeader(c)
+	case audioCodecADX:
+		return readADXHeader(c)
+	default:
+		return nil, fmt.Errorf("chunk %s at %#x is not audio header", idToString(c.Header.ID), c.offset)
+	}
+}
+
+// detectAudioCodec returns codec from audio header info,
+// or from header of the first audio stream when header info doesn't have it
+func (s *USMInfo) detectAudioCodec() int {
+	if codec := audioCodec(s); codec != 0 {
+		return codec
+	}
+
+	channels := s.audioChannels()
+	if len(channels) == 0 {
+		return 0
+	}
+
+	chunks := s.streamOf(_SFA, channels[0])
+	if len(chunks) == 0 {
+		return 0
+	}
+
+	return audioHeaderCodec(chunks[0])
+}
+
+// audioChannels returns channel numbers of all audio streams
+func (s *USMInfo) audioChannels() []byte {
+	result := make([]byte, 0)
+	for _, key := range streamKeys(s.AudioStreams) {
+		result = append(result, key.Channel)
+	}
+
+	return result
+}
+
+// CheckAudio verifies that audio from donor can replace audio of target.
+// Different sample rate or channel count is an error, since it's going to desync or break playback.
+// Different duration is returned as warning, because it's often fine to have a few seconds of silence
+func CheckAudio(target, donor *USMInfo) ([]string, error) {
+	channels := donor.audioChannels()
+	if len(channels) == 0 {
+		return nil, errors.New("donor doesn't have any audio streams")
+	}
+
+	var videoDuration float64
+	if len(target.VideoStreams) > 0 {
+		video, err := target.summarizeStream(keyOf(target.VideoStreams[0]))
+		if err != nil {
+			return nil, fmt.Errorf("can't read video: %w", err)
+		}
+		videoDuration = video.Duration
+	}
+
+	targetChannels := target.audioChannels()
+	warnings := make([]string, 0)
+
+	for _, channel := range channels {
+		props, err := donor.AudioProperties(channel)
+		if err != nil {
+			return warnings, fmt.Errorf("donor audio %d: %w", channel, err)
+		}
+
+		if len(targetChannels) > 0 {
+			// streams are compared by channel, extra donor streams are compared to the first one
+			orig := targetChannels[0]
+			for _, ch := range targetChannels {
+				if ch == channel {
+					orig = ch
+				}
+			}
+
+			origProps, err := target.AudioProperties(orig)
+			if err != nil {
+				return warnings, fmt.Errorf("audio %d: %w", orig, err)
+			}
+
+			if props.Codec != origProps.Codec {
+				warnings = append(warnings, fmt.Sprintf("donor audio %d is %s, but movie has %s",
+					channel, codecName(props.Codec), codecName(origProps.Codec)))
+			}
+
+			if props.SampleRate != origProps.SampleRate {
+				return warnings, fmt.Errorf("donor audio %d has sample rate %d Hz, but movie has %d Hz",
+					channel, props.SampleRate, origProps.SampleRate)
+			}
+
+			if props.Channels != origProps.Channels {
+				return warnings, fmt.Errorf("donor audio %d has %d channels, but movie has %d",
+					channel, props.Channels, origProps.Channels)
+			}
+		}
+
+		if d := props.Duration(); d > 0 && videoDuration > 0 && math.Abs(d-videoDuration) > durationTolerance {
+			warnings = append(warnings, fmt.Sprintf("donor audio %d lasts %s, but video lasts %s",
+				channel, formatSeconds(d), formatSeconds(videoDuration)))
+		}
+	}
+
+	return warnings, nil
+}
+
+func codecName(codec int) string {
+	if name, ok := audioCodecNames[uint64(codec)]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("codec %d", codec)
+}
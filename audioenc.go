@@ -0,0 +1,257 @@
+package parser
+
+import (
+	"fmt"
+)
+
+// audioChunkSamples is how many samples of every channel go into a single audio chunk
+const audioChunkSamples = 4096
+
+// AudioFromWAV encodes wav with the same codec target uses for its audio.
+// Result has only audio stream with its header info, and is meant to be used as donor in ReplaceAudio
+func AudioFromWAV(target *USMInfo, wav *WAVAudio, opts AudioEncodeOptions) (*USMInfo, error) {
+	if wav.Len() == 0 {
+		return nil, fmt.Errorf("WAV file has no samples")
+	}
+
+	codec := target.detectAudioCodec()
+	if codec == 0 {
+		codec = audioCodecADX
+	}
+
+	var header []byte
+	var frames [][]byte
+	var frameSamples int
+
+	switch codec {
+	case audioCodecADX:
+		data, err := EncodeADX(wav.Samples, wav.SampleRate, wav.Channels)
+		if err != nil {
+			return nil, err
+		}
+
+		h, err := ParseADXHeader(data)
+		if err != nil {
+			return nil, err
+		}
+
+		header, data = data[:h.DataOffset], data[h.DataOffset:]
+		frameSize := adxBlockSize * wav.Channels
+		for len(data) >= frameSize {
+			frames = append(frames, data[:frameSize])
+			data = data[frameSize:]
+		}
+		// end marker goes together with the last frame
+		frames[len(frames)-1] = append(frames[len(frames)-1], data...)
+		frameSamples = adxBlockSamples
+	case audioCodecHCA:
+		var err error
+		header, frames, err = EncodeHCA(wav, opts)
+		if err != nil {
+			return nil, err
+		}
+		frameSamples = HCASamplesPerBlock
+	default:
+		return nil, fmt.Errorf("encoding to %s is not supported", codecName(codec))
+	}
+
+	var channel byte
+	if channels := target.audioChannels(); len(channels) > 0 {
+		channel = channels[0]
+	}
+
+	result := newUSMInfo()
+	result.AudioStreams = makeAudioChunks(header, frames, frameSamples, wav.SampleRate, channel, target.videoFrameRate())
+
+	hdr, err := target.audioHeaderInfo(codec, wav.SampleRate, wav.Channels, wav.Len())
+	if err != nil {
+		return nil, err
+	}
+	result.HDRInfo[_SFA] = hdr
+
+	return result, nil
+}
+
+// makeAudioChunks puts codec header into the first chunk and groups frames into the rest.
+// Frame time of chunks is in the same units as video, so they are written together with their frames
+func makeAudioChunks(header []byte, frames [][]byte, frameSamples, sampleRate int, channel byte, frameRate int32) []Chunk {
+	result := []Chunk{makeStreamChunk(_SFA, channel, 0, frameRate, header)}
+
+	perChunk := audioChunkSamples / frameSamples
+	if perChunk == 0 {
+		perChunk = 1
+	}
+
+	for i := 0; i < len(frames); i += perChunk {
+		end := i + perChunk
+		if end > len(frames) {
+			end = len(frames)
+		}
+
+		var payload []byte
+		for _, f := range frames[i:end] {
+			payload = append(payload, f...)
+		}
+
+		frameTime := int32(int64(i) * int64(frameSamples) * int64(frameRate) / int64(sampleRate))
+		result = append(result, makeStreamChunk(_SFA, channel, frameTime, frameRate, payload))
+	}
+
+	return result
+}
+
+// audioHeaderInfo makes AUDIO_HDRINFO for new audio, keeping layout of existing one if there is any
+func (s *USMInfo) audioHeaderInfo(codec, sampleRate, channels, samples int) (Chunk, error) {
+	fields := map[string]uint64{
+		"audio_codec":   uint64(codec),
+		"sampling_rate": uint64(sampleRate),
+		"num_channels":  uint64(channels),
+		"total_samples": uint64(samples),
+	}
+
+	if hdr, ok := s.HDRInfo[_SFA]; ok {
+		name, rows, err := hdr.Table()
+		if err != nil {
+			return Chunk{}, fmt.Errorf("can't read audio header info: %w", err)
+		}
+
+		if len(rows) > 0 {
+			for i := range rows[0] {
+				if v, ok := fields[rows[0][i].Key]; ok {
+					setUint(&rows[0][i], v)
+				}
+			}
+
+			return makeTableChunk(hdr, name, rows[:1])
+		}
+	}
+
+	row := []Entry{
+		{Key: "audio_codec", Type: values[0x11], Value: []byte{byte(codec)}},
+		{Key: "sampling_rate", Type: values[0x15]},
+		{Key: "num_channels", Type: values[0x11], Value: []byte{byte(channels)}},
+		{Key: "metadata_count", Type: values[0x11], Value: []byte{0}},
+		{Key: "metadata_size", Type: values[0x15]},
+		{Key: "total_samples", Type: values[0x15]},
+		{Key: "ambisonics", Type: values[0x11], Value: []byte{0}},
+	}
+	setUint(&row[1], uint64(sampleRate))
+	setUint(&row[4], 0)
+	setUint(&row[5], uint64(samples))
+
+	hdr := Chunk{
+		Header: Header{ID: _SFA},
+		Data: Data{
+			PayloadHeader: PayloadHeader{
+				Offset:      0x18,
+				PayloadType: PayloadTypeHeader,
+				FrameRate:   0x1e,
+			},
+		},
+	}
+
+	return makeTableChunk(hdr, "AUDIO_HDRINFO", [][]Entry{row})
+}
+
+// audioFrames is audio stream split into codec frames
+type audioFrames struct {
+	codec  int
+	header []byte
+	frames [][]byte
+	// whatever follows the frames, like ADX end marker
+	trailer      []byte
+	frameSamples int
+	sampleRate   int
+	// frame rate of the source chunks
+	frameRate int32
+}
+
+// readAudioFrames loads audio stream with provided channel and splits it into frames
+func (s *USMInfo) readAudioFrames(channel byte) (*audioFrames, error) {
+	chunks := s.streamOf(_SFA, channel)
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("file has no audio stream with channel %d", channel)
+	}
+
+	var data []byte
+	for _, c := range chunks {
+		payload, err := c.ReadPayload()
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, payload...)
+	}
+
+	a := &audioFrames{codec: audioHeaderCodec(chunks[0]), frameRate: 2997}
+	for _, c := range chunks {
+		if audioHeaderCodec(c) == 0 {
+			a.frameRate = c.Data.PayloadHeader.FrameRate
+			break
+		}
+	}
+
+	switch a.codec {
+	case audioCodecHCA:
+		h, err := ParseHCAHeader(data)
+		if err != nil {
+			return nil, err
+		}
+
+		a.header, data = data[:h.HeaderSize], data[h.HeaderSize:]
+		for i := uint32(0); i < h.BlockCount && len(data) >= int(h.BlockSize); i++ {
+			a.frames = append(a.frames, data[:h.BlockSize])
+			data = data[h.BlockSize:]
+		}
+		a.frameSamples, a.sampleRate = HCASamplesPerBlock, h.SampleRate
+	case audioCodecADX:
+		h, err := ParseADXHeader(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if h.BlockSize != adxBlockSize {
+			return nil, fmt.Errorf("ADX with %d-byte blocks is not supported", h.BlockSize)
+		}
+
+		frameSize := adxBlockSize * h.Channels
+		a.header, data = data[:h.DataOffset], data[h.DataOffset:]
+		for len(data) >= frameSize && !(data[0] == 0x80 && data[1] == 0x01) {
+			a.frames = append(a.frames, data[:frameSize])
+			data = data[frameSize:]
+		}
+		a.frameSamples, a.sampleRate = adxBlockSamples, h.SampleRate
+	default:
+		return nil, fmt.Errorf("audio stream %d is neither HCA nor ADX", channel)
+	}
+
+	if len(a.frames) == 0 {
+		return nil, fmt.Errorf("audio stream %d has no frames", channel)
+	}
+
+	a.trailer = data
+
+	return a, nil
+}
+
+// chunks puts frames back into stream chunks, trailer goes together with the last frame
+func (a *audioFrames) chunks(channel byte) []Chunk {
+	frames := append([][]byte{}, a.frames...)
+	if len(a.trailer) > 0 && len(frames) > 0 {
+		last := append([]byte{}, frames[len(frames)-1]...)
+		frames[len(frames)-1] = append(last, a.trailer...)
+	}
+
+	return makeAudioChunks(a.header, frames, a.frameSamples, a.sampleRate, channel, a.frameRate)
+}
+
+// setAudioStream replaces chunks of audio stream with provided channel
+func (s *USMInfo) setAudioStream(channel byte, chunks []Chunk) {
+	result := make([]Chunk, 0, len(s.AudioStreams)+len(chunks))
+	for _, c := range s.AudioStreams {
+		if c.Data.PayloadHeader.ChannelNumber != channel {
+			result = append(result, c)
+		}
+	}
+
+	s.AudioStreams = append(result, chunks...)
+}
@@ -25,7 +25,12 @@ func WriteChunk(src Chunk, out io.Writer) (n int64, err error) {
 	var chunkPayloadSize = int(src.Header.Size) - src.Data.PayloadHeader.Len() -
 		int(src.Data.PayloadHeader.PaddingSize)
 
-	err = safeWriter(out, src.Data.Payload[:chunkPayloadSize])
+	payload, err := src.ReadPayload()
+	if err != nil {
+		return
+	}
+
+	err = safeWriter(out, payload[:chunkPayloadSize])
 	if err != nil {
 		return
 	}
@@ -166,3 +171,57 @@ func compressPayload(src Payload) ([]byte, error) {
 
 	return result.Bytes(), nil
 }
+
+// makeTableChunk puts @UTF table into payload of chunk c, updating its size and padding
+func makeTableChunk(c Chunk, name string, rows [][]Entry) (Chunk, error) {
+	payloadContent := compressDict(name, rows)
+
+	c.Data.PayloadHeader.PaddingSize = 0
+	if remainder := (payloadContent.Size() + 8) % 0x10; remainder != 0 {
+		c.Data.PayloadHeader.PaddingSize = uint16(0x10 - remainder)
+	}
+
+	compressedPayload, err := compressPayload(Payload{
+		Header:      Header{ID: _UTF, Size: int32(payloadContent.Size())},
+		PayloadData: payloadContent,
+	})
+
+	if err != nil {
+		return Chunk{}, fmt.Errorf("can't compress payload: %w", err)
+	}
+
+	c.Data.Payload = compressedPayload
+
+	c.Header.Size = int32(payloadContent.Size()) +
+		int32(c.Data.PayloadHeader.PaddingSize) +
+		8 + // UTF header inside payload
+		24 // 24 - PayloadHeader
+
+	return c, nil
+}
+
+// makeStreamChunk wraps payload into stream chunk, adding padding so chunk size is aligned to 16 bytes
+func makeStreamChunk(id [4]byte, channel byte, frameTime, frameRate int32, payload []byte) Chunk {
+	c := Chunk{
+		Header: Header{ID: id},
+		Data: Data{
+			PayloadHeader: PayloadHeader{
+				Offset:        0x18,
+				ChannelNumber: channel,
+				PayloadType:   PayloadTypeStream,
+				FrameTime:     frameTime,
+				FrameRate:     frameRate,
+			},
+			Payload: payload,
+		},
+	}
+
+	// 8 - chunk header, 24 - PayloadHeader
+	if remainder := (8 + 24 + len(payload)) % 0x10; remainder != 0 {
+		c.Data.PayloadHeader.PaddingSize = uint16(0x10 - remainder)
+	}
+
+	c.Header.Size = int32(24 + len(payload) + int(c.Data.PayloadHeader.PaddingSize))
+
+	return c
+}
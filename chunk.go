@@ -2,15 +2,117 @@ package parser
 
 import (
 	"fmt"
+	"io"
 )
 
 type Chunk struct {
 	offset int
+	// src is set for chunks indexed by Reader, their payload is loaded on demand
+	src io.ReaderAt
 
 	Header Header
 	Data   Data
 }
 
+// Offset returns position of the chunk in source file
+func (c Chunk) Offset() int {
+	return c.offset
+}
+
+// IsLoaded reports whether chunk payload is already in memory
+func (c Chunk) IsLoaded() bool {
+	return c.Data.Payload != nil || c.src == nil
+}
+
+// ReadPayload returns payload of the chunk.
+// For chunks indexed by Reader payload is read from the source every time,
+// without being cached, so memory usage stays bounded
+func (c Chunk) ReadPayload() ([]byte, error) {
+	if c.IsLoaded() {
+		return c.Data.Payload, nil
+	}
+
+	payload := make([]byte, c.payloadSize())
+	n, err := c.src.ReadAt(payload, c.payloadOffset())
+	if n != len(payload) {
+		return nil, &ErrTruncatedChunk{
+			Offset:   int64(c.offset),
+			ChunkID:  c.Header.ID,
+			Expected: int(c.Header.Size) + 8,
+			Actual:   8 + c.Data.PayloadHeader.Len() + n,
+		}
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// Load returns copy of the chunk with payload read into memory
+func (c Chunk) Load() (Chunk, error) {
+	payload, err := c.ReadPayload()
+	if err != nil {
+		return c, err
+	}
+
+	c.Data.Payload = payload
+	return c, nil
+}
+
+// Table decodes @UTF table stored in chunk payload,
+// errors have offsets in the source file
+func (c Chunk) Table() (name string, rows [][]Entry, err error) {
+	raw, err := c.ReadPayload()
+	if err != nil {
+		return "", nil, err
+	}
+
+	payload, err := ParsePayload(raw)
+	if err != nil {
+		return "", nil, locate(err, c.payloadOffset(), c.Header.ID)
+	}
+
+	name, rows, err = BuildDict(payload)
+	if err != nil {
+		return "", nil, locate(err, c.payloadOffset(), c.Header.ID)
+	}
+
+	return name, rows, nil
+}
+
+// payloadPrefix returns up to n first bytes of payload without loading whole chunk
+func (c Chunk) payloadPrefix(n int) []byte {
+	if c.IsLoaded() {
+		if len(c.Data.Payload) < n {
+			return c.Data.Payload
+		}
+		return c.Data.Payload[:n]
+	}
+
+	if c.payloadSize() < n {
+		n = c.payloadSize()
+	}
+	if n < 0 {
+		n = 0
+	}
+
+	head := make([]byte, n)
+	read, _ := c.src.ReadAt(head, c.payloadOffset())
+
+	return head[:read]
+}
+
+// payloadOffset returns position of payload in source file,
+// it goes right after chunk header and payload header
+func (c Chunk) payloadOffset() int64 {
+	return int64(c.offset) + 8 + int64(c.Data.PayloadHeader.Len())
+}
+
+func (c Chunk) payloadSize() int {
+	return int(c.Header.Size) - int(c.Data.PayloadHeader.PaddingSize) - c.Data.PayloadHeader.Len()
+}
+
 func (c Chunk) String() string {
 	return fmt.Sprintf(`{`+
 		`"Header": %v, `+
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// errSkipped marks files which are left as is on purpose, it's not a failure
+var errSkipped = errors.New("skipped")
+
+// batchJob is processing of a single file in batch mode
+type batchJob struct {
+	name string
+	// files the job reads and writes, for reports
+	inputs []string
+	output string
+	// run does the work and writes what happens to logger.
+	// Returned error wrapping errSkipped means file was skipped
+	run func(ctx context.Context, logger *log.Logger) error
+}
+
+// batchResult is outcome of batchJob
+type batchResult struct {
+	job     batchJob
+	err     error
+	elapsed time.Duration
+	// log output of the job
+	log []byte
+	// sizes and durations of files of the job, recorded while it runs.
+	// Output is only set when it was written
+	inputs []reportFile
+	output *reportFile
+}
+
+func (r batchResult) skipped() bool {
+	return errors.Is(r.err, errSkipped)
+}
+
+// runBatch runs jobs with up to workers of them at once. Only running jobs keep their files open,
+// so memory is bounded by amount of workers. Log output of every job is collected separately
+// and written to logger in order of jobs, as soon as all previous ones are finished.
+// When ctx is done, jobs which haven't started yet fail without running
+func runBatch(ctx context.Context, jobs []batchJob, workers int, logger *log.Logger) []batchResult {
+	if workers < 1 {
+		workers = 1
+	}
+
+	results := make([]batchResult, len(jobs))
+	done := make([]chan struct{}, len(jobs))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	queue := make(chan int)
+	go func() {
+		for i := range jobs {
+			queue <- i
+		}
+		close(queue)
+	}()
+
+	bar := newProgressBar("Starting", len(jobs), true)
+	defer bar.stop()
+
+	jobCtx := hideFileProgress(ctx)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if err := ctx.Err(); err != nil {
+					results[i] = batchResult{job: jobs[i], err: err}
+				} else {
+					bar.title(jobs[i].name)
+					results[i] = runJob(jobCtx, jobs[i], logger.Flags())
+				}
+				bar.add(1)
+				close(done[i])
+			}
+		}()
+	}
+
+	for i := range jobs {
+		<-done[i]
+		bar.pause(func() {
+			_, _ = logger.Writer().Write(results[i].log)
+		})
+	}
+	wg.Wait()
+
+	return results
+}
+
+// runJob runs single job with its own logger and adds its outcome to the log
+func runJob(ctx context.Context, job batchJob, flags int) batchResult {
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", flags)
+
+	ctx, files := recordFiles(ctx)
+	start := time.Now()
+	err := safeRun(ctx, job, logger)
+	elapsed := time.Since(start)
+
+	result := batchResult{job: job, err: err, elapsed: elapsed, inputs: make([]reportFile, 0, len(job.inputs))}
+	for _, input := range job.inputs {
+		result.inputs = append(result.inputs, files.input(input))
+	}
+	if err == nil && job.output != "" {
+		result.output = files.output(job.output)
+	}
+
+	switch {
+	case err == nil:
+		logDetail(logger, "%s: done in %s\n", job.name, elapsed.Round(time.Millisecond))
+	case errors.Is(err, errSkipped):
+		logger.Printf("%s: %s\n", job.name, err)
+	default:
+		logger.Printf("%s: failed: %s\n", job.name, err)
+	}
+
+	result.log = buf.Bytes()
+	return result
+}
+
+// safeRun runs job, turning panic into error, so one broken file doesn't stop the batch
+func safeRun(ctx context.Context, job batchJob, logger *log.Logger) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return job.run(ctx, logger)
+}
+
+// printSummary writes counts of results and reasons of failures
+func printSummary(results []batchResult, out io.Writer) {
+	ok, skipped, failed := countResults(results)
+	_, _ = fmt.Fprintf(out, "All done! %d ok, %d skipped, %d failed\n", ok, skipped, failed)
+
+	if failed == 0 {
+		return
+	}
+
+	_, _ = fmt.Fprintln(out, "Failed:")
+	interrupted := 0
+	for _, r := range results {
+		switch {
+		case errors.Is(r.err, context.Canceled):
+			interrupted++
+		case r.err != nil && !r.skipped():
+			_, _ = fmt.Fprintf(out, "\t%s: %s\n", r.job.name, r.err)
+		}
+	}
+
+	if interrupted > 0 {
+		_, _ = fmt.Fprintf(out, "\t%d files weren't finished, batch was interrupted\n", interrupted)
+	}
+}
+
+// countResults returns amount of successful, skipped and failed jobs
+func countResults(results []batchResult) (ok, skipped, failed int) {
+	for _, r := range results {
+		switch {
+		case r.err == nil:
+			ok++
+		case r.skipped():
+			skipped++
+		default:
+			failed++
+		}
+	}
+
+	return ok, skipped, failed
+}
+
+// skip makes error for file which is left as is for provided reason
+func skip(format string, args ...interface{}) error {
+	return fmt.Errorf("%s, %w", fmt.Sprintf(format, args...), errSkipped)
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// command is a subcommand of command line interface
+type command struct {
+	name string
+	// parameters of command, e.g. "input [output] [--json]"
+	usage string
+	// description of command, without indentation
+	help string
+	// run reads parameters and runs command, returned error means parameters are wrong.
+	// Command should stop when ctx is done
+	run func(ctx context.Context, args []string) error
+	// ui asks for parameters interactively and runs command
+	ui func(ctx context.Context)
+}
+
+// cliArgs are parameters of command, split into positional ones and named flags
+type cliArgs struct {
+	positional []string
+	// values of flags by their names, switches have empty values
+	flags map[string]string
+}
+
+// globalFlags are flags accepted by every command, they set global settings
+var globalFlags = map[string]func(*cliSettings){
+	"--dry-run":       func(s *cliSettings) { s.dryRun = true },
+	"--force":         func(s *cliSettings) { s.overwrite = overwriteForce },
+	"--skip-existing": func(s *cliSettings) { s.overwrite = overwriteSkip },
+	"--quiet":         func(s *cliSettings) { s.verbosity = verbosityQuiet },
+	"--verbose":       func(s *cliSettings) { s.verbosity = verbosityVerbose },
+}
+
+var globalHelp = `Global flags:
+	--dry-run        process inputs, but only report outputs which would be written
+	--force          overwrite existing outputs
+	--skip-existing  keep existing outputs and skip their inputs, it's not a failure
+	--quiet          print only warnings, errors and summaries
+	--verbose        print details, e.g. sizes of outputs and time spent on batch files
+Existing outputs are never overwritten without --force, such command fails instead.
+Every command which writes a file or folder accepts --output path in place of positional output.
+Progress is shown when output is a terminal, except with --quiet.
+Ctrl+C stops the command and removes output it was writing.
+`
+
+// parseGlobalFlags removes global flags from args, wherever they are, and returns settings they make
+func parseGlobalFlags(args []string) ([]string, cliSettings, error) {
+	var s cliSettings
+	rest := make([]string, 0, len(args))
+	seen := make(map[string]bool)
+
+	for i, arg := range args {
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+
+		set, ok := globalFlags[arg]
+		if !ok {
+			rest = append(rest, arg)
+			continue
+		}
+
+		set(&s)
+		seen[arg] = true
+	}
+
+	if seen["--force"] && seen["--skip-existing"] {
+		return rest, s, errors.New("--force and --skip-existing can't be used together")
+	}
+
+	if seen["--quiet"] && seen["--verbose"] {
+		return rest, s, errors.New("--quiet and --verbose can't be used together")
+	}
+
+	return rest, s, nil
+}
+
+// parseArgs splits args into positional parameters and flags. Flags from withValue need a value,
+// either as the next parameter or after "=", the rest of flags are switches.
+// Everything after "--" is positional, so paths starting with dashes can be used
+func parseArgs(args []string, withValue []string, switches ...string) (cliArgs, error) {
+	result := cliArgs{flags: make(map[string]string)}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			result.positional = append(result.positional, args[i+1:]...)
+			break
+		}
+
+		if !strings.HasPrefix(arg, "--") {
+			result.positional = append(result.positional, arg)
+			continue
+		}
+
+		name, value, hasValue := arg, "", false
+		if eq := strings.IndexByte(arg, '='); eq >= 0 {
+			name, value, hasValue = arg[:eq], arg[eq+1:], true
+		}
+
+		if _, ok := result.flags[name]; ok {
+			return result, fmt.Errorf("%s is set twice", name)
+		}
+
+		switch {
+		case contains(withValue, name):
+			if !hasValue {
+				if i+1 >= len(args) {
+					return result, fmt.Errorf("%s needs a value", name)
+				}
+				value = args[i+1]
+				i++
+			}
+		case contains(switches, name):
+			if hasValue {
+				return result, fmt.Errorf("%s doesn't take a value", name)
+			}
+		default:
+			return result, fmt.Errorf("unknown flag %s", name)
+		}
+
+		result.flags[name] = value
+	}
+
+	return result, nil
+}
+
+// need checks that positional parameters named by names are present,
+// and that there are at most optional more of them
+func (a cliArgs) need(optional int, names ...string) error {
+	if len(a.positional) < len(names) {
+		return fmt.Errorf("need to specify %s", names[len(a.positional)])
+	}
+
+	if len(a.positional) > len(names)+optional {
+		return fmt.Errorf("unexpected parameter %s", a.positional[len(names)+optional])
+	}
+
+	return nil
+}
+
+// arg returns positional parameter i, or empty string if there are not enough of them
+func (a cliArgs) arg(i int) string {
+	if i >= len(a.positional) {
+		return ""
+	}
+
+	return a.positional[i]
+}
+
+// output returns value of --output, or positional parameter i if it's not set
+func (a cliArgs) output(i int) (string, error) {
+	output, ok := a.flags["--output"]
+	if !ok {
+		return a.arg(i), nil
+	}
+
+	if a.arg(i) != "" {
+		return "", errors.New("output is set both as parameter and with --output")
+	}
+
+	return output, nil
+}
+
+func (a cliArgs) value(name string) (string, bool) {
+	v, ok := a.flags[name]
+	return v, ok
+}
+
+func (a cliArgs) has(name string) bool {
+	_, ok := a.flags[name]
+	return ok
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isHelp(arg string) bool {
+	return arg == "--help" || arg == "-h" || arg == "help"
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == strings.ToLower(name) {
+			return c, true
+		}
+	}
+
+	return command{}, false
+}
+
+// runCommand runs command with args and exits on wrong parameters, showing its usage
+func runCommand(ctx context.Context, c command, args []string) {
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "--help" || arg == "-h" {
+			fmt.Print(c.helpText())
+			os.Exit(0)
+		}
+	}
+
+	if err := c.run(ctx, args); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\nUsage: usmparser %s %s\nSee usmparser %s --help for details\n",
+			c.name, err, c.name, c.usage, c.name)
+		os.Exit(1)
+	}
+}
+
+// helpText is full help of command
+func (c command) helpText() string {
+	return fmt.Sprintf("Usage:\n\tusmparser %s %s\n\n%s\n%s", c.name, c.usage, indent(c.help, "\t"), globalHelp)
+}
+
+// helpText is help of all commands
+func helpText() string {
+	var b strings.Builder
+	b.WriteString("Usage:\n")
+	b.WriteString("\tusmparser command parameters... [global flags]\n")
+	b.WriteString("\tusmparser command --help\n")
+	b.WriteString("Without parameters interactive mode is started.\n\n")
+	b.WriteString(globalHelp)
+	b.WriteString("\nList of available commands:\n")
+
+	for _, c := range commands {
+		fmt.Fprintf(&b, "\t- %s %s\n%s\n", c.name, c.usage, indent(c.help, "\t\t"))
+	}
+
+	return b.String()
+}
+
+// indent adds prefix to every non-empty line of s
+func indent(s, prefix string) string {
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
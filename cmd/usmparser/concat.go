@@ -0,0 +1,89 @@
+package main
+
+import (
+	parser "USMparser"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// concatOptions are arguments of concat command
+type concatOptions struct {
+	inputs []string
+	output string
+	// key for encrypted HCA
+	key uint64
+}
+
+// Concat joins files `opts.inputs` one after another and writes result to `opts.output`.
+// If output is empty, {{first input}}-concat.usm is used
+func Concat(ctx context.Context, opts concatOptions) {
+	outPath := defaultOutput(opts.output, opts.inputs[0], "-concat.usm")
+	if err := concatFiles(ctx, opts.inputs, outPath, opts.key); err != nil {
+		exitOnError(err)
+	}
+
+	logDone(log.Default(), outPath, "%d files joined", len(opts.inputs))
+}
+
+// concatFiles joins files `inputs` one after another and writes result to outPath
+func concatFiles(ctx context.Context, inputs []string, outPath string, key uint64) error {
+	if err := checkNotInput(outPath, inputs...); err != nil {
+		return err
+	}
+
+	// chunks are read from sources while writing result, so all of them are closed after it
+	sources := make([]*os.File, 0, len(inputs))
+	defer func() {
+		for _, src := range sources {
+			src.Close()
+		}
+	}()
+
+	segments := make([]*parser.USMInfo, 0, len(inputs))
+	for _, path := range inputs {
+		src, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("can't open source file: %w", err)
+		}
+		sources = append(sources, src)
+
+		info, err := parseFile(ctx, src)
+		if err != nil {
+			return fmt.Errorf("can't parse file %s: %w", path, err)
+		}
+
+		segments = append(segments, info)
+	}
+
+	result, err := parser.Concat(segments, key)
+	if err != nil {
+		return fmt.Errorf("can't concatenate files: %w", err)
+	}
+
+	return writeUSM(ctx, result, outPath)
+}
+
+// parseConcatArgs reads input paths and flags
+func parseConcatArgs(args []string) (opts concatOptions, err error) {
+	a, err := parseArgs(args, []string{"--output", "--key"})
+	if err != nil {
+		return opts, err
+	}
+
+	opts.inputs = a.positional
+	if len(opts.inputs) < 2 {
+		return opts, errors.New("need at least two files to concatenate")
+	}
+
+	opts.output, _ = a.value("--output")
+	if v, ok := a.value("--key"); ok {
+		if opts.key, err = parseKey(v); err != nil {
+			return opts, err
+		}
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	parser "USMparser"
+)
+
+// ExportCues writes cue points of file `path` as JSON to `outPath`.
+// If outPath is empty, {{path}}_cues.json is used
+func ExportCues(ctx context.Context, path, outPath string) {
+	outPath = defaultOutput(outPath, path, "_cues.json")
+	if err := checkNotInput(outPath, path); err != nil {
+		log.Fatalln(err)
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		log.Fatalln("can't open source file: ", err)
+	}
+	defer src.Close()
+
+	info, err := parseFile(ctx, src)
+	if err != nil {
+		log.Fatalln("can't parse file: ", err)
+	}
+
+	cues, err := info.CuePoints()
+	if err != nil {
+		log.Fatalln("can't read cue points: ", err)
+	}
+
+	out, err := createOutput(outPath)
+	if err != nil {
+		exitOnError(err)
+	}
+
+	if err = parser.WriteCuePoints(out, cues); err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		out.Abort()
+		log.Fatalln("can't write cue points: ", err)
+	}
+
+	logDone(log.Default(), outPath, "%d cue points", len(cues))
+}
+
+// ImportCues replaces cue points of file `path` with ones from JSON file `cuesPath`
+// and writes result to `outPath`. If outPath is empty, {{path}}-new.usm is used
+func ImportCues(ctx context.Context, path, cuesPath, outPath string) {
+	outPath = defaultOutput(outPath, path, "-new.usm")
+	if err := checkNotInput(outPath, path, cuesPath); err != nil {
+		log.Fatalln(err)
+	}
+
+	cuesFile, err := os.Open(cuesPath)
+	if err != nil {
+		log.Fatalln("can't open cue points file: ", err)
+	}
+
+	cues, err := parser.ReadCuePoints(cuesFile)
+	cuesFile.Close()
+	if err != nil {
+		log.Fatalln("can't read cue points: ", err)
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		log.Fatalln("can't open source file: ", err)
+	}
+	defer src.Close()
+
+	info, err := parseFile(ctx, src)
+	if err != nil {
+		log.Fatalln("can't parse file: ", err)
+	}
+
+	if err = info.SetCuePoints(cues); err != nil {
+		log.Fatalln("can't set cue points: ", err)
+	}
+
+	if err = writeUSM(ctx, info, outPath); err != nil {
+		exitOnError(err)
+	}
+
+	logDone(log.Default(), outPath, "")
+}
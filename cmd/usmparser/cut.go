@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// cutOptions are arguments of cut command
+type cutOptions struct {
+	output string
+	// times in seconds, to <= 0 means the end of the movie
+	from, to float64
+}
+
+// Cut writes part of file `path` between `opts.from` and `opts.to` to `opts.output`.
+// If output is empty, {{path}}-cut.usm is used
+func Cut(ctx context.Context, path string, opts cutOptions) {
+	outPath := defaultOutput(opts.output, path, "-cut.usm")
+	start, err := cutFile(ctx, path, outPath, opts.from, opts.to)
+	if err != nil {
+		exitOnError(err)
+	}
+
+	logDone(log.Default(), outPath, "starts from keyframe at %s", formatTimestamp(start))
+}
+
+// cutFile writes part of file `path` between from and to seconds to outPath, returns time of its first keyframe
+func cutFile(ctx context.Context, path, outPath string, from, to float64) (float64, error) {
+	if err := checkNotInput(outPath, path); err != nil {
+		return 0, err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("can't open source file: %w", err)
+	}
+	defer src.Close()
+
+	info, err := parseFile(ctx, src)
+	if err != nil {
+		return 0, fmt.Errorf("can't parse file: %w", err)
+	}
+
+	start, err := info.Cut(from, to)
+	if err != nil {
+		return 0, fmt.Errorf("can't cut file: %w", err)
+	}
+
+	return start, writeUSM(ctx, info, outPath)
+}
+
+// parseCutArgs reads input, output path and time range
+func parseCutArgs(args []string) (path string, opts cutOptions, err error) {
+	a, err := parseArgs(args, []string{"--output", "--from", "--to"})
+	if err != nil {
+		return path, opts, err
+	}
+
+	if err = a.need(1, "input"); err != nil {
+		return path, opts, err
+	}
+
+	if opts.output, err = a.output(1); err != nil {
+		return path, opts, err
+	}
+
+	if v, ok := a.value("--from"); ok {
+		if opts.from, err = parseTimestamp(v); err != nil {
+			return path, opts, err
+		}
+	}
+
+	if v, ok := a.value("--to"); ok {
+		if opts.to, err = parseTimestamp(v); err != nil {
+			return path, opts, err
+		}
+	}
+
+	return a.arg(0), opts, nil
+}
+
+// parseTimestamp reads time as [[hh:]mm:]ss[.fff] and returns it in seconds
+func parseTimestamp(s string) (float64, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("wrong time %s, expected hh:mm:ss", s)
+	}
+
+	var result float64
+	for _, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("wrong time %s, expected hh:mm:ss", s)
+		}
+		result = result*60 + v
+	}
+
+	return result, nil
+}
+
+// formatTimestamp prints seconds as hh:mm:ss.fff
+func formatTimestamp(seconds float64) string {
+	ms := int64(seconds*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// delayOptions are optional arguments of audiodelay command
+type delayOptions struct {
+	output  string
+	channel byte
+	// key for encrypted HCA
+	key uint64
+}
+
+// AudioDelay shifts audio of file `path` by `delay` milliseconds and writes result to `opts.output`.
+// If output is empty, {{path}}-new.usm is used
+func AudioDelay(ctx context.Context, path string, delay float64, opts delayOptions) {
+	outPath := defaultOutput(opts.output, path, "-new.usm")
+	if err := checkNotInput(outPath, path); err != nil {
+		log.Fatalln(err)
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		log.Fatalln("can't open source file: ", err)
+	}
+	defer src.Close()
+
+	info, err := parseFile(ctx, src)
+	if err != nil {
+		log.Fatalln("can't parse file: ", err)
+	}
+
+	applied, err := info.DelayAudio(opts.channel, delay/1000, opts.key)
+	if err != nil {
+		log.Fatalln("can't shift audio: ", err)
+	}
+
+	if err = writeUSM(ctx, info, outPath); err != nil {
+		exitOnError(err)
+	}
+
+	logDone(log.Default(), outPath, "audio shifted by %.0f ms", applied*1000)
+}
+
+// parseDelayArgs reads input, delay, output path and flags
+func parseDelayArgs(args []string) (path string, delay float64, opts delayOptions, err error) {
+	a, err := parseArgs(args, []string{"--output", "--channel", "--key"})
+	if err != nil {
+		return path, delay, opts, err
+	}
+
+	if err = a.need(1, "input", "delay in milliseconds"); err != nil {
+		return path, delay, opts, err
+	}
+
+	if delay, err = parseDelay(a.arg(1)); err != nil {
+		return path, delay, opts, err
+	}
+
+	if opts.output, err = a.output(2); err != nil {
+		return path, delay, opts, err
+	}
+
+	if v, ok := a.value("--key"); ok {
+		if opts.key, err = parseKey(v); err != nil {
+			return path, delay, opts, err
+		}
+	}
+
+	if v, ok := a.value("--channel"); ok {
+		ch, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			return path, delay, opts, fmt.Errorf("wrong channel number %s: %w", v, err)
+		}
+		opts.channel = byte(ch)
+	}
+
+	return a.arg(0), delay, opts, nil
+}
+
+// parseDelay reads delay in milliseconds, optionally with "ms" suffix
+func parseDelay(s string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(s), "ms"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("wrong delay %s: %w", s, err)
+	}
+
+	return v, nil
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,42 +14,62 @@ import (
 	parser "USMparser"
 )
 
-// DumpFile tries to read file `path` and write result to file `outPath`
-func DumpFile(path string, outPath string) {
+// DumpFile tries to read file `path` and write result to file `outPath`.
+// If outPath is empty, {{path}}.json is used
+func DumpFile(ctx context.Context, path string, outPath string) {
+	outPath = defaultOutput(outPath, path, ".json")
+	if err := checkNotInput(outPath, path); err != nil {
+		log.Fatalln(err)
+	}
+
 	src, err := os.Open(path)
 	if err != nil {
 		log.Fatalln("can't open source file: ", err)
 	}
+	defer src.Close()
 
-	out, err := os.Create(outPath)
+	out, err := createOutput(outPath)
 	if err != nil {
-		log.Fatalln("can't create output file: ", err)
+		exitOnError(err)
 	}
 
-	defer func() {
-		_ = src.Close()
-		_ = out.Close()
-	}()
-
-	err = parser.DumpAllChunks(src, out)
+	progress, done := fileProgress(ctx, "Dumping", path)
+	err = parser.DumpAllChunksContext(ctx, src, out, progress)
+	done()
+	if err == nil || err == io.EOF {
+		err = out.Close()
+	}
 	if err != nil {
-		if err != io.EOF {
-			log.Fatalln(err)
-		}
+		out.Abort()
+		log.Fatalln(err)
 	}
+
+	logDone(log.Default(), outPath, "")
 }
 
 // DumpSubs will try to extract all the subtitles from provided file
-// and save them as {{filename}}_{{language}}.srt in outputFolder
-func DumpSubs(inputFile, outputFolder string, format string) {
+// and save them as {{filename}}_{{language}}.srt in outputFolder.
+// If outputFolder is empty, folder of the file is used
+func DumpSubs(ctx context.Context, inputFile, outputFolder string, format string) {
+	if outputFolder == "" {
+		outputFolder = filepath.Dir(inputFile)
+	}
+
 	src, err := os.Open(inputFile)
 	if err != nil {
 		log.Fatalln("can't open source file: ", err)
 	}
 
-	subs, err := parser.GetSubs(src)
+	progress, done := fileProgress(ctx, "Reading", inputFile)
+	r, err := parser.NewFileReaderContext(ctx, src, progress)
+	done()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	subs, err := r.Subs()
 	src.Close()
-	if err != nil && err != io.EOF {
+	if err != nil {
 		log.Fatalln(err)
 	}
 
@@ -61,25 +83,43 @@ func DumpSubs(inputFile, outputFolder string, format string) {
 	}
 
 	// make sure output path exists
-	if err := os.MkdirAll(outputFolder, os.ModePerm); err != nil {
-		log.Fatalln("can't create output folder: ", err)
+	if err := makeOutputDir(outputFolder); err != nil {
+		log.Fatalln(err)
 	}
 
 	filename := strings.TrimSuffix(filepath.Base(inputFile), ".usm")
+	failed := false
 	for lang, sub := range result {
 		newPath := fmt.Sprintf("%s_%s.%s", filepath.Join(outputFolder, filename), lang, format)
-		f, err := os.Create(newPath)
+		if err = checkNotInput(newPath, inputFile); err != nil {
+			log.Println(err)
+			failed = true
+			continue
+		}
+
+		f, err := createOutput(newPath)
 		if err != nil {
-			log.Printf("cant open %s: %s\n", newPath, err)
+			log.Println(err)
+			failed = failed || !errors.Is(err, errSkipped)
 			continue
 		}
 
 		_, err = f.Write(sub.Bytes())
 		//_, err = f.Write([]byte{0x0D, 0x0A}) // add trailing new line
+		if err == nil {
+			err = f.Close()
+		}
 		if err != nil {
+			f.Abort()
 			log.Printf("can't write to %s: %s\n", newPath, err)
+			failed = true
+			continue
 		}
 
-		log.Println(newPath, " ok!")
+		logDone(log.Default(), newPath, "")
+	}
+
+	if failed {
+		os.Exit(1)
 	}
 }
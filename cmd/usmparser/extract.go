@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	parser "USMparser"
+)
+
+// extractOptions are optional arguments of extract command
+type extractOptions struct {
+	output string
+	// "raw" keeps stream as is, "wav" decodes audio
+	format string
+	// key for encrypted audio
+	key uint64
+}
+
+// Extract writes data of `stream` from file `path` to `opts.output`.
+// Stream is a name of stream type, optionally followed by channel number, e.g. "audio:1".
+// If output is empty, {{path}}_{{stream}}.{{ext}} is used
+func Extract(ctx context.Context, path, stream string, opts extractOptions) {
+	name, channel, err := parseStreamName(stream)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	id, ok := parser.StreamTypes[name]
+	if !ok {
+		log.Fatalln("unknown stream type: ", name)
+	}
+
+	switch opts.format {
+	case "", "raw":
+		opts.format = "raw"
+	case "wav":
+		if name != "audio" {
+			log.Fatalln("only audio can be extracted as wav")
+		}
+	default:
+		log.Fatalln("unknown format: ", opts.format)
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		log.Fatalln("can't open source file: ", err)
+	}
+	defer src.Close()
+
+	info, err := parseFile(ctx, src)
+	if err != nil {
+		log.Fatalln("can't parse file: ", err)
+	}
+
+	outPath := opts.output
+	if outPath == "" {
+		ext := opts.format
+		if ext == "raw" {
+			ext = info.StreamExtension(id)
+		}
+		outPath = fmt.Sprintf("%s_%s.%s", strings.TrimSuffix(path, ".usm"), name, ext)
+	}
+
+	if err = checkNotInput(outPath, path); err != nil {
+		log.Fatalln(err)
+	}
+
+	out, err := createOutput(outPath)
+	if err != nil {
+		exitOnError(err)
+	}
+
+	if opts.format == "wav" {
+		err = info.ExtractWAV(channel, opts.key, out)
+	} else {
+		err = info.ExtractStream(id, channel, out)
+	}
+	if err == nil {
+		err = out.Close()
+	}
+
+	if err != nil {
+		out.Abort()
+		log.Fatalln("can't extract stream: ", err)
+	}
+
+	logDone(log.Default(), outPath, "")
+}
+
+// parseExtractArgs reads input, stream name, output path and flags
+func parseExtractArgs(args []string) (path, stream string, opts extractOptions, err error) {
+	a, err := parseArgs(args, []string{"--output", "--format", "--key"})
+	if err != nil {
+		return path, stream, opts, err
+	}
+
+	if err = a.need(1, "input", "stream - video, alpha or audio"); err != nil {
+		return path, stream, opts, err
+	}
+
+	if opts.output, err = a.output(2); err != nil {
+		return path, stream, opts, err
+	}
+
+	if v, ok := a.value("--format"); ok {
+		opts.format = strings.ToLower(v)
+	}
+
+	if v, ok := a.value("--key"); ok {
+		if opts.key, err = parseKey(v); err != nil {
+			return path, stream, opts, err
+		}
+	}
+
+	return a.arg(0), a.arg(1), opts, nil
+}
+
+// parseKey reads decryption key, either decimal or hex with 0x prefix
+func parseKey(s string) (uint64, error) {
+	key, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("wrong key %s: %w", s, err)
+	}
+
+	return key, nil
+}
+
+// parseStreamName splits "name:channel" into its parts, channel is 0 if not set
+func parseStreamName(stream string) (name string, channel byte, err error) {
+	parts := strings.SplitN(strings.ToLower(stream), ":", 2)
+	if len(parts) == 1 {
+		return parts[0], 0, nil
+	}
+
+	ch, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil {
+		return "", 0, fmt.Errorf("wrong channel number %s: %w", parts[1], err)
+	}
+
+	return parts[0], byte(ch), nil
+}
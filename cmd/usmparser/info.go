@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	parser "USMparser"
+)
+
+// Info prints short summary of file `path`, either human-readable or as JSON
+func Info(ctx context.Context, path string, asJSON bool) {
+	src, err := os.Open(path)
+	if err != nil {
+		log.Fatalln("can't open source file: ", err)
+	}
+	defer src.Close()
+
+	info, err := parseFile(ctx, src)
+	if err != nil {
+		log.Fatalln("can't parse file: ", err)
+	}
+
+	summary, err := parser.Summarize(info)
+	if err != nil {
+		log.Fatalln("can't read file info: ", err)
+	}
+
+	if !asJSON {
+		fmt.Println(summary.String())
+		return
+	}
+
+	result, err := json.MarshalIndent(summary, "", "\t")
+	if err != nil {
+		log.Fatalln("encoding err: ", err)
+	}
+
+	fmt.Println(string(result))
+}
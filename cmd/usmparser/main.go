@@ -1,35 +1,31 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/pterm/pterm"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 )
 
-func CoolerMain() {
-	options := []string{
-		"replaceaudio",
-		"dumpfile",
-		"dumpsubs",
+func CoolerMain(ctx context.Context) {
+	options := make([]string, len(commands))
+	for i, c := range commands {
+		options[i] = c.name
 	}
 
-	command, _ := pterm.DefaultInteractiveSelect.
+	name, _ := pterm.DefaultInteractiveSelect.
 		WithOptions(options).
 		Show("Choose command")
 
-	switch command {
-	case "replaceaudio":
-		ReplaceAudioUI()
-	case "dumpfile":
-		DumpFileUI()
-	case "dumpsubs":
-		DumpSubsUI()
+	if c, ok := findCommand(name); ok {
+		c.ui(ctx)
 	}
 }
 
-func ReplaceAudioUI() {
+func ReplaceAudioUI(ctx context.Context) {
 	input1, _ := pterm.DefaultInteractiveTextInput.
 		Show("Input path to main file (or folder of files)")
 
@@ -39,13 +35,7 @@ func ReplaceAudioUI() {
 		return
 	}
 
-	var defaultOutput string
-
-	if info1.IsDir() {
-		defaultOutput = filepath.Join(input1, "out")
-	} else {
-		defaultOutput = fmt.Sprintf("%s-new.usm", strings.TrimSuffix(input1, ".usm"))
-	}
+	defaultPath := replaceAudioOutput(input1, info1.IsDir())
 
 	input2, _ := pterm.DefaultInteractiveTextInput.
 		Show("Now input path to file (or folder of files) to extract audio from")
@@ -62,38 +52,46 @@ func ReplaceAudioUI() {
 	}
 
 	output, _ := pterm.DefaultInteractiveTextInput.
-		Show(fmt.Sprintf("Change output path or leave empty to keep default (%s)", defaultOutput))
+		Show(fmt.Sprintf("Change output path or leave empty to keep default (%s)", defaultPath))
 
 	// weird workaround until they fix lib
 	if output == "" || output == input2 {
-		output = defaultOutput
+		output = defaultPath
 	}
 
 	pterm.Println()
 
-	ReplaceAudio(input1, input1, output)
+	opts := newReplaceOptions()
+	if !info2.IsDir() && strings.EqualFold(filepath.Ext(input2), ".wav") {
+		opts.Quality, _ = pterm.DefaultInteractiveSelect.
+			WithOptions([]string{"highest", "high", "middle", "low", "lowest"}).
+			WithDefaultOption("high").
+			Show("Choose quality of encoded HCA audio")
+	}
+
+	ReplaceAudio(ctx, input1, input2, output, opts)
 }
 
-func DumpFileUI() {
+func DumpFileUI(ctx context.Context) {
 	input, _ := pterm.DefaultInteractiveTextInput.
 		Show("Input path to .usm file to dump")
 
-	defaultOutput := fmt.Sprintf("%s-new.usm", strings.TrimSuffix(input, ".usm"))
+	defaultPath := defaultOutput("", input, ".json")
 
 	output, _ := pterm.DefaultInteractiveTextInput.
-		Show(fmt.Sprintf("Change output path or leave empty to keep default (%s)", defaultOutput))
+		Show(fmt.Sprintf("Change output path or leave empty to keep default (%s)", defaultPath))
 
 	// weird workaround until they fix lib
 	if output == "" || output == input {
-		output = defaultOutput
+		output = defaultPath
 	}
 
 	pterm.Println()
 
-	DumpFile(input, output)
+	DumpFile(ctx, input, output)
 }
 
-func DumpSubsUI() {
+func DumpSubsUI(ctx context.Context) {
 	input, _ := pterm.DefaultInteractiveTextInput.
 		Show("Input path to .usm file to extract subtitles")
 
@@ -118,93 +116,726 @@ func DumpSubsUI() {
 		return
 	}
 
-	defaultOutput := filepath.Dir(input)
+	defaultPath := filepath.Dir(input)
 
 	output, _ := pterm.DefaultInteractiveTextInput.
-		Show(fmt.Sprintf("Change output folder or leave empty to keep default (%s)", defaultOutput))
+		Show(fmt.Sprintf("Change output folder or leave empty to keep default (%s)", defaultPath))
 
 	// weird workaround until they fix lib
 	if output == "" || output == input {
-		output = defaultOutput
+		output = defaultPath
 	}
 
 	pterm.Println()
 
-	DumpSubs(input, output, format)
+	DumpSubs(ctx, input, output, format)
 }
 
-func main() {
-	args := os.Args
+func RecoverUI(ctx context.Context) {
+	input, _ := pterm.DefaultInteractiveTextInput.
+		Show("Input path to damaged .usm file")
+
+	defaultPath := defaultOutput("", input, "-recovered.usm")
+
+	output, _ := pterm.DefaultInteractiveTextInput.
+		Show(fmt.Sprintf("Change output path or leave empty to keep default (%s)", defaultPath))
+
+	// weird workaround until they fix lib
+	if output == "" || output == input {
+		output = defaultPath
+	}
+
+	pterm.Println()
+
+	Recover(ctx, input, output)
+}
+
+func VerifyUI(ctx context.Context) {
+	input, _ := pterm.DefaultInteractiveTextInput.
+		Show("Input path to .usm file to verify")
+
+	pterm.Println()
+
+	Verify(ctx, input)
+}
+
+func ExtractUI(ctx context.Context) {
+	input, _ := pterm.DefaultInteractiveTextInput.
+		Show("Input path to .usm file to extract stream from")
+
+	stream, _ := pterm.DefaultInteractiveSelect.
+		WithOptions([]string{"video", "alpha", "audio"}).
+		Show("Choose stream to extract")
+
+	var opts extractOptions
+	if stream == "audio" {
+		opts.format, _ = pterm.DefaultInteractiveSelect.
+			WithOptions([]string{"raw", "wav"}).
+			Show("Choose format: raw HCA/ADX stream or decoded wav")
+	}
+
+	if opts.format == "wav" {
+		key, _ := pterm.DefaultInteractiveTextInput.
+			Show("Input decryption key or leave empty if audio is not encrypted")
+
+		var err error
+		if key = strings.TrimSpace(key); key != "" && key != input {
+			if opts.key, err = parseKey(key); err != nil {
+				pterm.Fatal.Println(err)
+				return
+			}
+		}
+	}
+
+	opts.output, _ = pterm.DefaultInteractiveTextInput.
+		Show("Change output path or leave empty to keep default ({{input}}_{{stream}}.{{ext}})")
+
+	// weird workaround until they fix lib
+	if opts.output == input {
+		opts.output = ""
+	}
+
+	pterm.Println()
+
+	Extract(ctx, input, stream, opts)
+}
+
+func ExportCuesUI(ctx context.Context) {
+	input, _ := pterm.DefaultInteractiveTextInput.
+		Show("Input path to .usm file to export cue points from")
+
+	defaultPath := defaultOutput("", input, "_cues.json")
+
+	output, _ := pterm.DefaultInteractiveTextInput.
+		Show(fmt.Sprintf("Change output path or leave empty to keep default (%s)", defaultPath))
+
+	// weird workaround until they fix lib
+	if output == "" || output == input {
+		output = defaultPath
+	}
+
+	pterm.Println()
+
+	ExportCues(ctx, input, output)
+}
+
+func ImportCuesUI(ctx context.Context) {
+	input, _ := pterm.DefaultInteractiveTextInput.
+		Show("Input path to .usm file to import cue points to")
+
+	cues, _ := pterm.DefaultInteractiveTextInput.
+		Show("Now input path to .json file with cue points")
+
+	defaultPath := defaultOutput("", input, "-new.usm")
+
+	output, _ := pterm.DefaultInteractiveTextInput.
+		Show(fmt.Sprintf("Change output path or leave empty to keep default (%s)", defaultPath))
+
+	// weird workaround until they fix lib
+	if output == "" || output == cues {
+		output = defaultPath
+	}
+
+	pterm.Println()
+
+	ImportCues(ctx, input, cues, output)
+}
+
+func InfoUI(ctx context.Context) {
+	input, _ := pterm.DefaultInteractiveTextInput.
+		Show("Input path to .usm file")
+
+	pterm.Println()
+
+	Info(ctx, input, false)
+}
+
+func AudioDelayUI(ctx context.Context) {
+	input, _ := pterm.DefaultInteractiveTextInput.
+		Show("Input path to .usm file to shift audio of")
+
+	delayInput, _ := pterm.DefaultInteractiveTextInput.
+		Show("Input delay in milliseconds, negative values make audio play earlier")
+
+	delay, err := parseDelay(strings.TrimSpace(delayInput))
+	if err != nil {
+		pterm.Fatal.Println(err)
+		return
+	}
+
+	var opts delayOptions
+	defaultPath := defaultOutput("", input, "-new.usm")
+
+	opts.output, _ = pterm.DefaultInteractiveTextInput.
+		Show(fmt.Sprintf("Change output path or leave empty to keep default (%s)", defaultPath))
+
+	// weird workaround until they fix lib
+	if opts.output == delayInput {
+		opts.output = ""
+	}
+
+	pterm.Println()
+
+	AudioDelay(ctx, input, delay, opts)
+}
+
+func CutUI(ctx context.Context) {
+	input, _ := pterm.DefaultInteractiveTextInput.
+		Show("Input path to .usm file to cut")
+
+	var opts cutOptions
+	var err error
+
+	from, _ := pterm.DefaultInteractiveTextInput.
+		Show("Input start time as hh:mm:ss, video starts from the nearest keyframe before it")
 
-	// 1st arg is program name
-	if len(args) <= 1 {
-		CoolerMain()
+	if opts.from, err = parseTimestamp(strings.TrimSpace(from)); err != nil {
+		pterm.Fatal.Println(err)
 		return
 	}
 
-	if len(args) < 3 {
-		displayHelp()
+	to, _ := pterm.DefaultInteractiveTextInput.
+		Show("Input end time as hh:mm:ss or leave empty to keep everything till the end")
+
+	// weird workaround until they fix lib
+	if to = strings.TrimSpace(to); to != "" && to != from {
+		if opts.to, err = parseTimestamp(to); err != nil {
+			pterm.Fatal.Println(err)
+			return
+		}
+	}
+
+	defaultPath := defaultOutput("", input, "-cut.usm")
+
+	opts.output, _ = pterm.DefaultInteractiveTextInput.
+		Show(fmt.Sprintf("Change output path or leave empty to keep default (%s)", defaultPath))
+
+	if opts.output == to || opts.output == from {
+		opts.output = ""
 	}
 
-	var output string
+	pterm.Println()
 
-	// different commands
-	switch strings.ToLower(args[1]) {
-	case "dumpfile":
-		if len(args) < 4 {
-			output = strings.TrimSuffix(args[2], ".usm") + ".json"
-		} else {
-			output = args[3]
+	Cut(ctx, input, opts)
+}
+
+func ConcatUI(ctx context.Context) {
+	var opts concatOptions
+	for {
+		input, _ := pterm.DefaultInteractiveTextInput.
+			Show(fmt.Sprintf("Input path to .usm file #%d or leave empty to finish", len(opts.inputs)+1))
+
+		// weird workaround until they fix lib
+		input = strings.TrimSpace(input)
+		if input == "" || (len(opts.inputs) > 0 && input == opts.inputs[len(opts.inputs)-1]) {
+			break
 		}
-		DumpFile(args[2], output)
-	case "dumpsubs":
-		if len(args) >= 5 {
-			output = args[4]
-		} else if len(args) == 4 {
-			output = filepath.Dir(args[2])
-		} else {
-			fmt.Println("need to specify output format - srt or txt")
-			os.Exit(1)
+		opts.inputs = append(opts.inputs, input)
+	}
+
+	if len(opts.inputs) < 2 {
+		pterm.Fatal.Println("need at least two files to concatenate")
+		return
+	}
+
+	defaultPath := defaultOutput("", opts.inputs[0], "-concat.usm")
+
+	opts.output, _ = pterm.DefaultInteractiveTextInput.
+		Show(fmt.Sprintf("Change output path or leave empty to keep default (%s)", defaultPath))
+
+	if opts.output == opts.inputs[len(opts.inputs)-1] {
+		opts.output = ""
+	}
+
+	pterm.Println()
+
+	Concat(ctx, opts)
+}
+
+func SplitUI(ctx context.Context) {
+	input, _ := pterm.DefaultInteractiveTextInput.
+		Show("Input path to .usm file to split")
+
+	var opts splitOptions
+	var err error
+
+	mode, _ := pterm.DefaultInteractiveSelect.
+		WithOptions([]string{"at times", "every N seconds"}).
+		Show("Choose how to split, parts start from the nearest keyframe")
+
+	if mode == "at times" {
+		at, _ := pterm.DefaultInteractiveTextInput.
+			Show("Input times as hh:mm:ss separated by commas")
+
+		for _, s := range strings.Split(at, ",") {
+			t, err := parseTimestamp(strings.TrimSpace(s))
+			if err != nil {
+				pterm.Fatal.Println(err)
+				return
+			}
+			opts.at = append(opts.at, t)
 		}
+	} else {
+		every, _ := pterm.DefaultInteractiveTextInput.
+			Show("Input length of parts in seconds or as hh:mm:ss")
 
-		DumpSubs(args[2], output, args[3])
-	case "replaceaudio":
-		// no output provided, use same folder
-		if len(args) < 5 {
-			output = strings.TrimSuffix(args[2], ".usm") + "-new.usm"
-		} else {
-			output = args[4]
+		if opts.every, err = parseTimestamp(strings.TrimSpace(every)); err != nil || opts.every <= 0 {
+			pterm.Fatal.Println("wrong length of parts: ", every)
+			return
 		}
-		ReplaceAudio(args[2], args[3], output)
-	default:
-		displayHelp()
 	}
+
+	defaultPath := filepath.Dir(input)
+
+	opts.output, _ = pterm.DefaultInteractiveTextInput.
+		Show(fmt.Sprintf("Change output folder or leave empty to keep default (%s)", defaultPath))
+
+	pterm.Println()
+
+	Split(ctx, input, opts)
 }
 
-func displayHelp() {
-	fmt.Print(Help)
-	os.Exit(0)
+func ReplaceSubsUI(ctx context.Context) {
+	input1, _ := pterm.DefaultInteractiveTextInput.
+		Show("Input path to main .usm file")
+
+	input2, _ := pterm.DefaultInteractiveTextInput.
+		Show("Now input path to .usm file to copy subtitles from")
+
+	defaultPath := defaultOutput("", input1, "-new.usm")
+
+	output, _ := pterm.DefaultInteractiveTextInput.
+		Show(fmt.Sprintf("Change output path or leave empty to keep default (%s)", defaultPath))
+
+	// weird workaround until they fix lib
+	if output == input2 {
+		output = ""
+	}
+
+	pterm.Println()
+
+	ReplaceSubs(ctx, input1, input2, output)
 }
 
-var Help = `Usage:
-	usmparser command parameters...
+func StripUI(ctx context.Context) {
+	input, _ := pterm.DefaultInteractiveTextInput.
+		Show("Input path to .usm file to remove streams from")
+
+	streams, _ := pterm.DefaultInteractiveMultiselect.
+		WithOptions([]string{"alpha", "audio", "subtitles", "cues"}).
+		Show("Choose streams to remove")
+
+	if len(streams) == 0 {
+		pterm.Fatal.Println("no streams chosen")
+		return
+	}
+
+	defaultPath := defaultOutput("", input, "-new.usm")
 
-List of available commands:
-	- replaceaudio input1 input2 [output]
-		Copies audio from input2 to input1.
-		Pass folders as parameters to process all files inside them.
-		If output parameter not set - will use 
-			- in batch mode: {{input1}}/"out"
-			- in single file mode: {{input1}}-new.usm
+	output, _ := pterm.DefaultInteractiveTextInput.
+		Show(fmt.Sprintf("Change output path or leave empty to keep default (%s)", defaultPath))
+
+	// weird workaround until they fix lib
+	if output == input {
+		output = ""
+	}
 
-	- dumpfile input [output]
-		Dumps everything from provided input file to output.
-		If output parameter not set - will use {{input1}}.json
+	pterm.Println()
 
-	- dumpsubs input format [output]
-		Dumps all subtitles from input file to separated files for each language, each with "_lang" suffix.
-		Format can be either:
-			- srt: normal subtitle format
-			- txt: plaintext for Scaleform Video Encoder
-		If output parameter not set - will output result in same folder with input
-`
+	Strip(ctx, input, streams, output)
+}
+
+func RunUI(ctx context.Context) {
+	input, _ := pterm.DefaultInteractiveTextInput.
+		Show("Input path to .json or .yaml manifest with jobs")
+
+	pterm.Println()
+
+	Run(ctx, input, runOptions{})
+}
+
+func main() {
+	args, s, err := parseGlobalFlags(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	settings = s
+
+	// Ctrl+C stops running command, outputs it was writing are removed.
+	// Second one kills the program right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	// no command, asking for everything interactively
+	if len(args) == 0 {
+		CoolerMain(ctx)
+		return
+	}
+
+	if isHelp(args[0]) {
+		if len(args) > 1 {
+			if c, ok := findCommand(args[1]); ok {
+				fmt.Print(c.helpText())
+				return
+			}
+		}
+		fmt.Print(helpText())
+		return
+	}
+
+	c, ok := findCommand(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %s, see usmparser --help\n", args[0])
+		os.Exit(1)
+	}
+
+	runCommand(ctx, c, args[1:])
+}
+
+var commands = []command{
+	{
+		name:  "replaceaudio",
+		usage: "input1 input2 [output] [--quality name] [--bitrate bps] [--key key] [--jobs n]\n\t\t[--recursive] [--donor template] [--match regex] [--pairs file.csv] [--report file]",
+		help: `Copies audio from input2 to input1.
+input2 can be a 16-bit wav, it's encoded with the codec of input1 (HCA or ADX).
+HCA quality is one of highest, high (default), middle, low or lowest,
+or exact --bitrate of all channels can be set instead, e.g. 192k.
+Pass --key to encrypt HCA with that key.
+Pass folders as parameters to process all files inside them, --jobs files at once (1 by default).
+In batch mode --recursive enters sub-folders and keeps their structure in output.
+Donor of input is found with --donor template, {{dir}}/{{name}} by default, e.g. {{dir}}/{{name}}_ja,
+.usm or .wav is added when it has no extension. With --match only inputs with relative path
+matching the regex are processed and --donor can refer to its groups, e.g. $1.
+--pairs reads input, donor and optional output paths from CSV file instead.
+Failed files don't stop the batch, they are listed at the end and exit code is 1.
+--report writes status, reason, sizes and stream durations of every file of the batch
+as JUnit XML if it ends with .xml, or as JSON otherwise.
+If output parameter not set - will use
+	- in batch mode: {{input1}}/out
+	- in single file mode: {{input1}}-new.usm
+`,
+		ui: ReplaceAudioUI,
+		run: func(ctx context.Context, args []string) error {
+			in1, in2, out, opts, err := parseReplaceArgs(args)
+			if err != nil {
+				return err
+			}
+
+			ReplaceAudio(ctx, in1, in2, out, opts)
+			return nil
+		},
+	},
+	{
+		name:  "dumpfile",
+		usage: "input [output]",
+		help: `Dumps everything from provided input file to output.
+If output parameter not set - will use {{input}}.json
+`,
+		ui: DumpFileUI,
+		run: func(ctx context.Context, args []string) error {
+			a, err := parseOutputArgs(args, "input")
+			if err != nil {
+				return err
+			}
+
+			DumpFile(ctx, a.arg(0), a.arg(1))
+			return nil
+		},
+	},
+	{
+		name:  "dumpsubs",
+		usage: "input format [output]",
+		help: `Dumps all subtitles from input file to separated files for each language, each with "_lang" suffix.
+Format can be either:
+	- srt: normal subtitle format
+	- txt: plaintext for Scaleform Video Encoder
+If output folder not set - will use folder of input
+`,
+		ui: DumpSubsUI,
+		run: func(ctx context.Context, args []string) error {
+			a, err := parseOutputArgs(args, "input", "format - srt or txt")
+			if err != nil {
+				return err
+			}
+
+			DumpSubs(ctx, a.arg(0), a.arg(2), a.arg(1))
+			return nil
+		},
+	},
+	{
+		name:  "recover",
+		usage: "input [output]",
+		help: `Reads damaged or partially downloaded file, skipping broken chunks,
+prints what was skipped and writes everything that could be salvaged to output.
+If output parameter not set - will use {{input}}-recovered.usm
+`,
+		ui: RecoverUI,
+		run: func(ctx context.Context, args []string) error {
+			a, err := parseOutputArgs(args, "input")
+			if err != nil {
+				return err
+			}
+
+			Recover(ctx, a.arg(0), a.arg(1))
+			return nil
+		},
+	},
+	{
+		name:  "verify",
+		usage: "input",
+		help: `Checks structural integrity of input file and prints found issues.
+Exits with non-zero code if there are any errors.
+`,
+		ui: VerifyUI,
+		run: func(ctx context.Context, args []string) error {
+			a, err := parseArgs(args, nil)
+			if err != nil {
+				return err
+			}
+			if err = a.need(0, "input"); err != nil {
+				return err
+			}
+
+			Verify(ctx, a.arg(0))
+			return nil
+		},
+	},
+	{
+		name:  "extract",
+		usage: "input stream [output] [--format raw|wav] [--key key]",
+		help: `Writes raw data of one stream from input file to output.
+Stream can be either video, alpha (transparency layer) or audio,
+add channel number after colon to choose other than first one, e.g. audio:1
+HCA and ADX audio can be decoded to wav with --format wav, encrypted audio needs --key.
+If output parameter not set - will use {{input}}_{{stream}}.{{ext}}
+`,
+		ui: ExtractUI,
+		run: func(ctx context.Context, args []string) error {
+			path, stream, opts, err := parseExtractArgs(args)
+			if err != nil {
+				return err
+			}
+
+			Extract(ctx, path, stream, opts)
+			return nil
+		},
+	},
+	{
+		name:  "exportcues",
+		usage: "input [output]",
+		help: `Exports cue points of input file as JSON list of {name, time (in ms), type, param}.
+If output parameter not set - will use {{input}}_cues.json
+`,
+		ui: ExportCuesUI,
+		run: func(ctx context.Context, args []string) error {
+			a, err := parseOutputArgs(args, "input")
+			if err != nil {
+				return err
+			}
+
+			ExportCues(ctx, a.arg(0), a.arg(1))
+			return nil
+		},
+	},
+	{
+		name:  "importcues",
+		usage: "input cues [output]",
+		help: `Replaces cue points of input file with ones from JSON file made by exportcues.
+Edit times in that file to retime cue points or add new entries to add cue points.
+If output parameter not set - will use {{input}}-new.usm
+`,
+		ui: ImportCuesUI,
+		run: func(ctx context.Context, args []string) error {
+			a, err := parseOutputArgs(args, "input", ".json file with cue points")
+			if err != nil {
+				return err
+			}
+
+			ImportCues(ctx, a.arg(0), a.arg(1), a.arg(2))
+			return nil
+		},
+	},
+	{
+		name:  "info",
+		usage: "input [--json]",
+		help: `Prints short summary of input file: container version, streams with their codecs,
+resolution, frame and sample rates, durations, bitrates, subtitle languages and encryption.
+Pass --json to get it in machine-readable form.
+`,
+		ui: InfoUI,
+		run: func(ctx context.Context, args []string) error {
+			a, err := parseArgs(args, nil, "--json")
+			if err != nil {
+				return err
+			}
+			if err = a.need(0, "input"); err != nil {
+				return err
+			}
+
+			Info(ctx, a.arg(0), a.has("--json"))
+			return nil
+		},
+	},
+	{
+		name:  "audiodelay",
+		usage: "input delay [output] [--channel n] [--key key]",
+		help: `Shifts audio of input by delay milliseconds, negative delay makes audio play earlier.
+Silence is added at one edge and the same amount is cut from the other, in whole audio frames.
+Encrypted HCA needs --key, encrypted ADX can't be shifted.
+If output parameter not set - will use {{input}}-new.usm
+`,
+		ui: AudioDelayUI,
+		run: func(ctx context.Context, args []string) error {
+			path, delay, opts, err := parseDelayArgs(args)
+			if err != nil {
+				return err
+			}
+
+			AudioDelay(ctx, path, delay, opts)
+			return nil
+		},
+	},
+	{
+		name:  "cut",
+		usage: "input [output] [--from hh:mm:ss] [--to hh:mm:ss]",
+		help: `Keeps only part of input between --from and --to, e.g. to make a trailer.
+Video starts from the nearest keyframe before --from, audio, subtitles and cue points
+are cut at the same time and all times are shifted to start from zero.
+Without --to everything till the end is kept.
+If output parameter not set - will use {{input}}-cut.usm
+`,
+		ui: CutUI,
+		run: func(ctx context.Context, args []string) error {
+			path, opts, err := parseCutArgs(args)
+			if err != nil {
+				return err
+			}
+
+			Cut(ctx, path, opts)
+			return nil
+		},
+	},
+	{
+		name:  "concat",
+		usage: "input1 input2 [input3...] [--output path] [--key key]",
+		help: `Joins inputs one after another, e.g. to make a recap from several scenes.
+Inputs need the same video codec, resolution and frame rate, the same audio streams
+and every one of them has to start from a keyframe. Audio of every input starts at the
+audio frame nearest to its video. Encrypted HCA needs --key, encrypted ADX can't be joined.
+If output parameter not set - will use {{input1}}-concat.usm
+`,
+		ui: ConcatUI,
+		run: func(ctx context.Context, args []string) error {
+			opts, err := parseConcatArgs(args)
+			if err != nil {
+				return err
+			}
+
+			Concat(ctx, opts)
+			return nil
+		},
+	},
+	{
+		name:  "split",
+		usage: "input [output] (--at hh:mm:ss,hh:mm:ss... | --every hh:mm:ss)",
+		help: `Splits input into standalone parts at provided times or into parts of the same length.
+Every part starts from the keyframe nearest to its time, has its own headers,
+audio, subtitles and cue points, with all times shifted to start from zero.
+With --every the last part shorter than half of the length is joined to the previous one.
+Parts are named {{input}}-1.usm, {{input}}-2.usm and so on.
+If output folder not set - will use folder of input
+`,
+		ui: SplitUI,
+		run: func(ctx context.Context, args []string) error {
+			path, opts, err := parseSplitArgs(args)
+			if err != nil {
+				return err
+			}
+
+			Split(ctx, path, opts)
+			return nil
+		},
+	},
+	{
+		name:  "replacesubs",
+		usage: "input1 input2 [output]",
+		help: `Copies subtitles from input2 to input1, subtitles of input1 are removed.
+If output parameter not set - will use {{input1}}-new.usm
+`,
+		ui: ReplaceSubsUI,
+		run: func(ctx context.Context, args []string) error {
+			a, err := parseOutputArgs(args, "input", "file to copy subtitles from")
+			if err != nil {
+				return err
+			}
+
+			ReplaceSubs(ctx, a.arg(0), a.arg(1), a.arg(2))
+			return nil
+		},
+	},
+	{
+		name:  "strip",
+		usage: "input streams [output]",
+		help: `Removes streams from input, streams are separated by commas: alpha, audio, subtitles or cues,
+add channel number after colon to remove only one of them, e.g. subtitles,audio:1
+If output parameter not set - will use {{input}}-new.usm
+`,
+		ui: StripUI,
+		run: func(ctx context.Context, args []string) error {
+			a, err := parseOutputArgs(args, "input", "streams to remove, e.g. subtitles,cues")
+			if err != nil {
+				return err
+			}
+
+			Strip(ctx, a.arg(0), strings.Split(a.arg(1), ","), a.arg(2))
+			return nil
+		},
+	},
+	{
+		name:  "run",
+		usage: "manifest [--jobs n] [--report file]",
+		help: `Runs jobs from JSON or YAML manifest: {"workers": n, "jobs": [{"operation", "inputs", "options", "output"}]}.
+Operations are replaceaudio (options quality, bitrate, key), replacesubs, strip (option streams)
+and cut (options from, to). Relative paths are relative to folder of manifest,
+output defaults are the same as of the commands. --jobs overrides workers of manifest.
+--report writes outcome of every job, the same as for replaceaudio.
+Global flags apply to every job. Manifests ending with .yaml or .yml are read as YAML, others as JSON.
+`,
+		ui: RunUI,
+		run: func(ctx context.Context, args []string) error {
+			path, opts, err := parseRunArgs(args)
+			if err != nil {
+				return err
+			}
+
+			Run(ctx, path, opts)
+			return nil
+		},
+	},
+}
+
+// parseOutputArgs reads required parameters named by names, followed by optional output,
+// for commands which have no other flags
+func parseOutputArgs(args []string, names ...string) (cliArgs, error) {
+	a, err := parseArgs(args, []string{"--output"})
+	if err != nil {
+		return a, err
+	}
+
+	if err = a.need(1, names...); err != nil {
+		return a, err
+	}
+
+	output, err := a.output(len(names))
+	if err != nil {
+		return a, err
+	}
+
+	a.positional = append(a.positional[:len(names)], output)
+
+	return a, nil
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	parser "USMparser"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// overwritePolicy says what to do with outputs which already exist
+type overwritePolicy int
+
+const (
+	// existing output is an error
+	overwriteRefuse overwritePolicy = iota
+	// existing output is replaced
+	overwriteForce
+	// existing output is kept and input is skipped
+	overwriteSkip
+)
+
+// verbosity is amount of log output
+type verbosity int
+
+const (
+	verbosityQuiet verbosity = iota - 1
+	verbosityNormal
+	verbosityVerbose
+)
+
+// cliSettings are global flags shared by all commands
+type cliSettings struct {
+	// nothing is written, outputs are only reported
+	dryRun    bool
+	overwrite overwritePolicy
+	verbosity verbosity
+}
+
+var settings cliSettings
+
+// outputFile is a file being written by command. Data goes to temporary file in the same folder,
+// which replaces path only when everything is written, so crash never leaves truncated output.
+// In dry run nothing is written
+type outputFile struct {
+	path string
+	// temporary file, nil in dry run
+	file *os.File
+	// position and size of file in dry run
+	pos, size int64
+}
+
+// checkOutput checks if path can be written according to overwrite policy.
+// Returned error wraps errSkipped if output should be kept
+func checkOutput(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+
+	switch settings.overwrite {
+	case overwriteForce:
+		return nil
+	case overwriteSkip:
+		return skip("%s already exists", path)
+	default:
+		return fmt.Errorf("%s already exists, pass --force to overwrite it or --skip-existing to keep it", path)
+	}
+}
+
+// createOutput starts writing of file at path, checking overwrite policy first
+func createOutput(path string) (*outputFile, error) {
+	if err := checkOutput(path); err != nil {
+		return nil, err
+	}
+
+	if settings.dryRun {
+		return &outputFile{path: path}, nil
+	}
+
+	return openOutput(path)
+}
+
+// openOutput starts writing of file at path regardless of settings
+func openOutput(path string) (*outputFile, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("can't create output file: %w", err)
+	}
+
+	return &outputFile{path: path, file: f}, nil
+}
+
+func (o *outputFile) Write(p []byte) (int, error) {
+	if o.file == nil {
+		o.pos += int64(len(p))
+		if o.pos > o.size {
+			o.size = o.pos
+		}
+		return len(p), nil
+	}
+
+	return o.file.Write(p)
+}
+
+func (o *outputFile) Seek(offset int64, whence int) (int64, error) {
+	if o.file != nil {
+		return o.file.Seek(offset, whence)
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.pos
+	case io.SeekEnd:
+		offset += o.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	o.pos = offset
+
+	return offset, nil
+}
+
+// Close flushes written data to disk and moves it to path. Output should be aborted if it fails
+func (o *outputFile) Close() error {
+	if o.file == nil {
+		return nil
+	}
+
+	if err := o.file.Chmod(0644); err != nil {
+		return err
+	}
+
+	if err := o.file.Sync(); err != nil {
+		return err
+	}
+
+	if err := o.file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(o.file.Name(), o.path)
+}
+
+// Abort removes temporary file, leaving path as it was
+func (o *outputFile) Abort() {
+	if o.file == nil {
+		return
+	}
+
+	_ = o.file.Close()
+	_ = os.Remove(o.file.Name())
+}
+
+// checkNotInput makes sure output isn't the same file as any of inputs,
+// as inputs are still read while output is written
+func checkNotInput(output string, inputs ...string) error {
+	out, err := os.Stat(output)
+	if err != nil {
+		return nil
+	}
+
+	for _, input := range inputs {
+		if in, err := os.Stat(input); err == nil && os.SameFile(in, out) {
+			return fmt.Errorf("output %s is the same file as input %s", output, input)
+		}
+	}
+
+	return nil
+}
+
+// makeOutputDir creates folder for outputs, except in dry run
+func makeOutputDir(path string) error {
+	if settings.dryRun {
+		return nil
+	}
+
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("can't create output folder: %w", err)
+	}
+
+	return nil
+}
+
+// removeOutputs removes outputs written before a failure, nothing is written in dry run
+func removeOutputs(paths []string) {
+	if settings.dryRun {
+		return
+	}
+
+	for _, path := range paths {
+		_ = os.Remove(path)
+	}
+}
+
+// writeUSM writes movie to file at outPath, output is removed if ctx is done before it's complete
+func writeUSM(ctx context.Context, info *parser.USMInfo, outPath string) error {
+	out, err := createOutput(outPath)
+	if err != nil {
+		return err
+	}
+
+	files := fileRecorderOf(ctx)
+	var streams []reportStream
+	if files != nil {
+		// streams and their durations go to the report
+		streams = reportStreams(info)
+	}
+
+	progress, done := fileProgress(ctx, "Writing", outPath)
+	err = info.PrepareStreams().WriteToContext(ctx, out, progress)
+	done()
+	var size int64
+	if err == nil {
+		size, err = out.Seek(0, io.SeekEnd)
+	}
+	if err != nil {
+		out.Abort()
+		return fmt.Errorf("can't write result to file: %w", err)
+	}
+
+	if err = out.Close(); err != nil {
+		out.Abort()
+		return fmt.Errorf("can't write result to file: %w", err)
+	}
+
+	if files != nil {
+		files.add(outPath, size, streams)
+	}
+
+	return nil
+}
+
+// defaultOutput returns output, or path of input with suffix instead of .usm when it's empty
+func defaultOutput(output, input, suffix string) string {
+	if output != "" {
+		return output
+	}
+
+	return strings.TrimSuffix(input, ".usm") + suffix
+}
+
+// logDone reports that output was written, with optional details.
+// In dry run it says what would be written instead
+func logDone(logger *log.Logger, path string, details string, args ...interface{}) {
+	if details != "" {
+		details = " (" + fmt.Sprintf(details, args...) + ")"
+	}
+
+	if settings.dryRun {
+		action := "would be written"
+		if _, err := os.Stat(path); err == nil {
+			action = "would be overwritten"
+		}
+		logger.Printf("%s %s%s\n", path, action, details)
+		return
+	}
+
+	if settings.verbosity == verbosityQuiet {
+		return
+	}
+
+	if settings.verbosity == verbosityVerbose {
+		if stat, err := os.Stat(path); err == nil {
+			details += fmt.Sprintf(" [%d bytes]", stat.Size())
+		}
+	}
+
+	logger.Printf("%s ok!%s\n", path, details)
+}
+
+// logDetail writes to logger only in verbose mode
+func logDetail(logger *log.Logger, format string, args ...interface{}) {
+	if settings.verbosity == verbosityVerbose {
+		logger.Printf(format, args...)
+	}
+}
+
+// exitOnError stops program because of err. Skipped output isn't an error, so exit code is 0 then
+func exitOnError(err error) {
+	if errors.Is(err, errSkipped) {
+		log.Println(err)
+		os.Exit(0)
+	}
+
+	log.Fatalln(err)
+}
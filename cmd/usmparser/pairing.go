@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// defaultDonor is donor with the same name in the same sub-folder
+const defaultDonor = "{{dir}}/{{name}}"
+
+// pairing decides which files of batch go together
+type pairing struct {
+	// enter sub-folders, keeping their structure in output
+	recursive bool
+	// only inputs with relative path matching it are processed, donor can refer to its groups
+	match *regexp.Regexp
+	// template of donor path relative to donor folder, with {{dir}}, {{name}} and {{ext}} of input
+	donor string
+	// CSV file with input, donor and optional output columns, replaces all the above
+	manifest string
+}
+
+// batchPair is input file of batch together with its donor and output
+type batchPair struct {
+	// path of input relative to input folder, used as a name in logs
+	name   string
+	input  string
+	donor  string
+	output string
+	// reason to leave input as is, found while pairing
+	skip string
+}
+
+// listPairs finds inputs in folder in1 and pairs them with donors from folder in2
+func listPairs(in1, in2, out string, p pairing) ([]batchPair, error) {
+	if p.manifest != "" {
+		return readPairs(p.manifest, in1, in2, out)
+	}
+
+	names, err := listFiles(in1, out, p.recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]batchPair, 0, len(names))
+	for _, name := range names {
+		pair := batchPair{
+			name:   name,
+			input:  filepath.Join(in1, name),
+			output: filepath.Join(out, name),
+		}
+
+		donor, ok := p.donorOf(name)
+		if ok {
+			pair.donor = findDonor(filepath.Join(in2, donor))
+		} else {
+			pair.skip = "doesn't match " + p.match.String()
+		}
+
+		result = append(result, pair)
+	}
+
+	return result, nil
+}
+
+// listFiles returns paths of files inside folder relative to it, output folder is never entered
+func listFiles(folder, out string, recursive bool) ([]string, error) {
+	outAbs, err := filepath.Abs(out)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0)
+	err = filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if path == folder {
+				return nil
+			}
+
+			if abs, err := filepath.Abs(path); err == nil && abs == outAbs {
+				return filepath.SkipDir
+			}
+
+			if !recursive {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		rel, err := filepath.Rel(folder, path)
+		if err != nil {
+			return err
+		}
+
+		result = append(result, rel)
+		return nil
+	})
+
+	return result, err
+}
+
+// donorOf returns donor path relative to donor folder, false if input doesn't match pattern
+func (p pairing) donorOf(name string) (string, bool) {
+	template := p.donor
+	if template == "" {
+		template = defaultDonor
+	}
+
+	slashed := filepath.ToSlash(name)
+	if p.match != nil {
+		if !p.match.MatchString(slashed) {
+			return "", false
+		}
+
+		template = p.match.ReplaceAllString(slashed, template)
+	}
+
+	dir, base := filepath.Split(slashed)
+	ext := filepath.Ext(base)
+	if dir == "" {
+		dir = "."
+	}
+
+	donor := strings.NewReplacer(
+		"{{dir}}", strings.TrimSuffix(dir, "/"),
+		"{{name}}", strings.TrimSuffix(base, ext),
+		"{{ext}}", ext,
+	).Replace(template)
+
+	return filepath.Clean(filepath.FromSlash(donor)), true
+}
+
+// findDonor returns donor path, trying .usm and then .wav when it has no extension
+func findDonor(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".usm", ".wav":
+		return path
+	}
+
+	// donor can be either movie or its audio as wav
+	if _, err := os.Stat(path + ".usm"); os.IsNotExist(err) {
+		if _, err = os.Stat(path + ".wav"); err == nil {
+			return path + ".wav"
+		}
+	}
+
+	return path + ".usm"
+}
+
+// readPairs reads CSV file with input, donor and optional output columns.
+// Relative paths are relative to input, donor and output folders, first line can be a header
+func readPairs(manifest, in1, in2, out string) ([]batchPair, error) {
+	f, err := os.Open(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("can't open pairs file: %w", err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	result := make([]batchPair, 0)
+	for first := true; ; first = false {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can't read pairs file: %w", err)
+		}
+
+		if first && strings.EqualFold(record[0], "input") {
+			continue
+		}
+
+		if len(record) < 2 || len(record) > 3 {
+			line, _ := r.FieldPos(0)
+			return nil, fmt.Errorf("pairs file line %d: expected input, donor and optional output", line)
+		}
+
+		name := filepath.FromSlash(record[0])
+		pair := batchPair{
+			name:   name,
+			input:  resolve(in1, name),
+			donor:  resolve(in2, filepath.FromSlash(record[1])),
+			output: resolve(out, name),
+		}
+
+		// absolute input is still placed into output folder
+		if filepath.IsAbs(name) {
+			pair.output = filepath.Join(out, filepath.Base(name))
+		}
+
+		if len(record) == 3 && record[2] != "" {
+			pair.output = resolve(out, filepath.FromSlash(record[2]))
+		}
+
+		result = append(result, pair)
+	}
+
+	return result, nil
+}
+
+// resolve makes path relative to folder unless it's absolute
+func resolve(folder, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(folder, path)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	parser "USMparser"
+
+	"github.com/pterm/pterm"
+)
+
+// fileProgressTotal is the scale of single file bars, progress of bytes is shown in tenths of percent
+const fileProgressTotal = 1000
+
+// progressBar shows progress of long operation on console. Progress is hidden in quiet mode
+// and when stdout isn't a terminal, then bar is nil and its methods do nothing.
+// Methods are safe to call from several goroutines
+type progressBar struct {
+	mu  sync.Mutex
+	bar *pterm.ProgressbarPrinter
+}
+
+// newProgressBar starts bar titled title which is full at total, showCount adds "[current/total]" to it
+func newProgressBar(title string, total int, showCount bool) *progressBar {
+	if total <= 0 || !showProgress() {
+		return nil
+	}
+
+	bar, err := pterm.DefaultProgressbar.WithTitle(title).WithTotal(total).WithShowCount(showCount).
+		WithWriter(os.Stdout).WithRemoveWhenDone().Start()
+	if err != nil {
+		return nil
+	}
+
+	return &progressBar{bar: bar}
+}
+
+// showProgress checks if progress bars can be drawn
+func showProgress() bool {
+	if settings.verbosity == verbosityQuiet {
+		return false
+	}
+
+	stat, err := os.Stdout.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// set moves bar to current, it's redrawn only when value changes
+func (p *progressBar) set(current int) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.bar.IsActive && current > p.bar.Current {
+		p.bar.Add(current - p.bar.Current)
+	}
+}
+
+// add moves bar by n
+func (p *progressBar) add(n int) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.bar.IsActive {
+		p.bar.Add(n)
+	}
+}
+
+func (p *progressBar) title(title string) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.bar.IsActive {
+		p.bar.UpdateTitle(title)
+	}
+}
+
+// pause hides bar while print runs, so other console output isn't mixed with it
+func (p *progressBar) pause(print func()) {
+	if p == nil {
+		print()
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.bar.IsActive {
+		print()
+		return
+	}
+
+	pterm.Fprinto(os.Stdout, strings.Repeat(" ", pterm.GetTerminalWidth()))
+	pterm.Fprinto(os.Stdout)
+	print()
+	p.bar.UpdateTitle(p.bar.Title)
+}
+
+// stop removes bar from console
+func (p *progressBar) stop() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, _ = p.bar.Stop()
+}
+
+type hiddenProgressKey struct{}
+
+// hideFileProgress marks ctx of operations which don't show bars of single files,
+// e.g. batch jobs which share bar of the whole batch
+func hideFileProgress(ctx context.Context) context.Context {
+	return context.WithValue(ctx, hiddenProgressKey{}, true)
+}
+
+// fileProgress shows bar of single file operation, returned function removes it.
+// Reported progress is never nil, so library functions don't print their own progress
+func fileProgress(ctx context.Context, action, path string) (parser.ProgressFunc, func()) {
+	var bar *progressBar
+	if ctx.Value(hiddenProgressKey{}) == nil {
+		bar = newProgressBar(action+" "+filepath.Base(path), fileProgressTotal, false)
+	}
+
+	return func(p parser.Progress) {
+		if p.TotalBytes > 0 {
+			bar.set(int(p.Bytes * fileProgressTotal / p.TotalBytes))
+		}
+	}, bar.stop
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	parser "USMparser"
+)
+
+// Recover reads damaged file `path`, skipping broken chunks,
+// and writes everything which could be salvaged to `outPath`.
+// If outPath is empty, {{path}}-recovered.usm is used
+func Recover(ctx context.Context, path string, outPath string) {
+	outPath = defaultOutput(outPath, path, "-recovered.usm")
+	if err := checkNotInput(outPath, path); err != nil {
+		log.Fatalln(err)
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		log.Fatalln("can't open source file: ", err)
+	}
+	defer src.Close()
+
+	info, report, err := parser.ParseFileLenient(src)
+	if err != nil {
+		log.Fatalln("can't parse file: ", err)
+	}
+
+	fmt.Println(report.String())
+
+	if err = writeUSM(ctx, info, outPath); err != nil {
+		exitOnError(err)
+	}
+
+	logDone(log.Default(), outPath, "")
+}
@@ -2,15 +2,38 @@ package main
 
 import (
 	parser "USMparser"
+	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
 
-func ReplaceAudio(in1, in2, out string) {
+// replaceOptions are optional arguments of replaceaudio command
+type replaceOptions struct {
+	// encoding of wav donors
+	parser.AudioEncodeOptions
+	// amount of files processed at once in batch mode
+	jobs int
+	// how inputs are paired with donors in batch mode
+	pairing pairing
+	// path of JSON or JUnit XML report of batch, none if empty
+	report string
+}
+
+// newReplaceOptions returns defaults shared by command line and interactive mode
+func newReplaceOptions() replaceOptions {
+	return replaceOptions{jobs: 1}
+}
+
+// ReplaceAudio copies audio from in2 to in1, wav donors are encoded with opts
+func ReplaceAudio(ctx context.Context, in1, in2, out string, opts replaceOptions) {
 	var folderMode bool
 
 	f, isDir1 := openFile(in1)
@@ -25,75 +48,189 @@ func ReplaceAudio(in1, in2, out string) {
 		log.Fatalf("both inputs should be either folders or files")
 	}
 
+	if out == "" {
+		out = replaceAudioOutput(in1, folderMode)
+	}
+
 	if !folderMode {
-		_replaceAudio(f, f2, out, log.Default())
+		err := _replaceAudio(ctx, f, f2, out, opts.AudioEncodeOptions, log.Default())
+		if err != nil {
+			exitOnError(err)
+		}
 		return
 	}
 	f2.Close()
 
 	// entering batch mode, assuming all in1, in2 and out are folder names
-	f1Entries, err := os.ReadDir(in1)
+	pairs, err := listPairs(in1, in2, out, opts.pairing)
 	if err != nil {
-		log.Fatalf("can't read folder %s: %s\n", in1, err)
+		log.Fatalf("can't list files of %s: %s\n", in1, err)
 	}
 
-	if out == "" {
-		out = filepath.Join(in1, "out")
+	if err = makeOutputDir(out); err != nil {
+		log.Fatalln(err)
 	}
 
-	if err = os.MkdirAll(out, 0755); err != nil {
-		log.Fatalf("can't create output folder %s: %s", out, err)
-	}
+	// nothing is written in dry run, so its log goes to console
+	var logOut, summaryOut io.Writer = os.Stdout, os.Stdout
+	var fileLog *os.File
+	if !settings.dryRun {
+		logFileName := batchLogPath(out, opts.report)
+		fileLog, err = os.Create(logFileName)
+		if err != nil {
+			log.Fatalf("can't create log file %s: %s", logFileName, err)
+		}
+		defer fileLog.Close()
+		logOut, summaryOut = fileLog, io.MultiWriter(os.Stdout, fileLog)
 
-	logFileName := strings.ReplaceAll(fmt.Sprintf("log-%s.txt", time.Now().Format(time.Stamp)), ":", "_")
-	fileLog, err := os.Create(logFileName)
-	if err != nil {
-		log.Fatalf("can't create log file %s: %s", logFileName, err)
+		if settings.verbosity != verbosityQuiet {
+			log.Print("writing logs to ", logFileName)
+		}
 	}
 
-	log.Print("writing logs to ", logFileName)
-	newLog := log.New(fileLog, "", log.Ltime)
+	newLog := log.New(logOut, "", log.Ltime)
 	newLog.Printf("usmparser replaceaudio %s %s %s\n", in1, in2, out)
 
-	for _, entry := range f1Entries {
-		if entry.IsDir() {
-			// don't enter sub-folders
-			continue
+	jobs := make([]batchJob, 0, len(pairs))
+	for _, pair := range pairs {
+		pair := pair
+		inputs := []string{pair.input}
+		if pair.donor != "" {
+			inputs = append(inputs, pair.donor)
 		}
 
-		name := entry.Name()
+		jobs = append(jobs, batchJob{
+			name:   pair.name,
+			inputs: inputs,
+			output: pair.output,
+			run: func(ctx context.Context, logger *log.Logger) error {
+				return replaceAudioJob(ctx, pair, opts.AudioEncodeOptions, logger)
+			},
+		})
+	}
 
-		if ext := filepath.Ext(name); ext != ".usm" {
-			newLog.Printf("%s not usm file, skipping..\n", name)
-			continue
-		}
+	started := time.Now()
+	results := runBatch(ctx, jobs, opts.jobs, newLog)
 
-		output := filepath.Join(out, name)
-		_, err = os.Stat(output)
-		if err == nil {
-			newLog.Printf("%s already exists, skipping..\n", output)
-			continue
+	printSummary(results, summaryOut)
+	if opts.report != "" {
+		if err = writeReport(opts.report, "replaceaudio", started, results); err != nil {
+			log.Println(err)
 		}
-
-		entry1 := filepath.Join(in1, name)
-		f, err = os.Open(entry1)
-		if err != nil {
-			newLog.Printf("can't open file: %s, skipping..\n", err)
-			continue
+	}
+	if _, _, failed := countResults(results); failed > 0 {
+		if fileLog != nil {
+			fileLog.Close()
 		}
+		os.Exit(1)
+	}
+}
 
-		entry2 := filepath.Join(in2, name)
-		f2, err = os.Open(entry2)
-		if err != nil {
-			newLog.Printf("can't open file: %s, skipping..\n", err)
-			continue
-		}
+// batchLogPath returns path of log file for batch started now, it's kept next to report if there is one
+// or in output folder otherwise
+func batchLogPath(out, report string) string {
+	dir := out
+	if report != "" {
+		dir = filepath.Dir(report)
+	}
+
+	name := strings.ReplaceAll(fmt.Sprintf("log-%s.txt", time.Now().Format(time.Stamp)), ":", "_")
+	return filepath.Join(dir, name)
+}
+
+// replaceAudioOutput returns default output for input in1, which is either a movie or a folder of them
+func replaceAudioOutput(in1 string, isDir bool) string {
+	if isDir {
+		return filepath.Join(in1, "out")
+	}
+
+	return defaultOutput("", in1, "-new.usm")
+}
 
-		newLog.Print(name, ": ")
-		_replaceAudio(f, f2, output, newLog)
+// replaceAudioJob replaces audio of one input of batch
+func replaceAudioJob(ctx context.Context, pair batchPair, opts parser.AudioEncodeOptions, logger *log.Logger) error {
+	if pair.skip != "" {
+		return skip("%s", pair.skip)
 	}
 
-	fmt.Println("All done!")
+	if ext := filepath.Ext(pair.input); ext != ".usm" {
+		return skip("not usm file")
+	}
+
+	if err := checkNotInput(pair.output, pair.input, pair.donor); err != nil {
+		return err
+	}
+
+	if err := checkOutput(pair.output); err != nil {
+		return err
+	}
+
+	f, err := os.Open(pair.input)
+	if err != nil {
+		return fmt.Errorf("can't open file: %w", err)
+	}
+
+	f2, err := os.Open(pair.donor)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("can't open file: %w", err)
+	}
+
+	// sub-folders of input are recreated in output
+	if err = makeOutputDir(filepath.Dir(pair.output)); err != nil {
+		f.Close()
+		f2.Close()
+		return err
+	}
+
+	logDetail(logger, "%s: donor %s\n", pair.name, pair.donor)
+	return _replaceAudio(ctx, f, f2, pair.output, opts, logger)
+}
+
+// ReplaceSubs copies subtitles from movie in2 to in1 and writes result to out.
+// If out is empty, {{in1}}-new.usm is used
+func ReplaceSubs(ctx context.Context, in1, in2, out string) {
+	out = defaultOutput(out, in1, "-new.usm")
+	if err := replaceSubsFile(ctx, in1, in2, out); err != nil {
+		exitOnError(err)
+	}
+
+	logDone(log.Default(), out, "")
+}
+
+// replaceSubsFile copies subtitles from movie in2 to in1 and writes result to out
+func replaceSubsFile(ctx context.Context, in1, in2, out string) error {
+	if err := checkNotInput(out, in1, in2); err != nil {
+		return err
+	}
+
+	f, err := os.Open(in1)
+	if err != nil {
+		return fmt.Errorf("can't open source file: %w", err)
+	}
+	defer f.Close()
+
+	f2, err := os.Open(in2)
+	if err != nil {
+		return fmt.Errorf("can't open source file: %w", err)
+	}
+	defer f2.Close()
+
+	info, err := parseFile(ctx, f)
+	if err != nil {
+		return fmt.Errorf("can't parse file: %w", err)
+	}
+
+	donor, err := parseFile(ctx, f2)
+	if err != nil {
+		return fmt.Errorf("can't parse file: %w", err)
+	}
+
+	if info, err = parser.ReplaceSubtitles(info, donor); err != nil {
+		return fmt.Errorf("can't replace subtitles: %w", err)
+	}
+
+	return writeUSM(ctx, info, out)
 }
 
 func openFile(filename string) (f *os.File, isDir bool) {
@@ -111,35 +248,153 @@ func openFile(filename string) (f *os.File, isDir bool) {
 	return f, stat1.IsDir()
 }
 
-func _replaceAudio(f, f2 *os.File, out string, logger *log.Logger) {
-	origInfo, err := parser.ParseFile(f)
+func _replaceAudio(ctx context.Context, f, f2 *os.File, out string, opts parser.AudioEncodeOptions, logger *log.Logger) error {
+	// streams are read from both files during writing, so keep them open till the end
+	defer f.Close()
+	defer f2.Close()
+
+	if err := checkNotInput(out, f.Name(), f2.Name()); err != nil {
+		return err
+	}
+
+	origInfo, err := parseFile(ctx, f)
 	if err != nil {
-		logger.Fatalln("can't parse file: ", err)
+		return fmt.Errorf("can't parse file: %w", err)
+	}
+
+	var file2Info *parser.USMInfo
+	if isWAV(f2.Name()) {
+		if file2Info, err = audioFromWAV(origInfo, f2, opts); err != nil {
+			return fmt.Errorf("can't encode audio: %w", err)
+		}
+	} else if file2Info, err = parseFile(ctx, f2); err != nil {
+		return fmt.Errorf("can't parse file: %w", err)
 	}
-	f.Close()
 
-	file2Info, err := parser.ParseFile(f2)
+	warnings, err := parser.CheckAudio(origInfo, file2Info)
+	for _, w := range warnings {
+		logger.Println("warning:", w)
+	}
 	if err != nil {
-		logger.Fatalln("can't parse file: ", err)
+		return fmt.Errorf("incompatible donor: %w", err)
 	}
-	f.Close()
 
-	outF, err := os.Create(out)
+	origInfo = parser.ReplaceAudio(origInfo, file2Info)
+
+	if err = writeUSM(ctx, origInfo, out); err != nil {
+		return err
+	}
+
+	logDone(logger, out, "")
+
+	return nil
+}
+
+// parseFile indexes file without loading stream payloads into memory
+func parseFile(ctx context.Context, f *os.File) (*parser.USMInfo, error) {
+	progress, done := fileProgress(ctx, "Reading", f.Name())
+	r, err := parser.NewFileReaderContext(ctx, f, progress)
+	done()
 	if err != nil {
-		logger.Fatalf("can't create output file: %s\n", err)
+		return nil, err
 	}
 
-	if len(file2Info.AudioStreams) <= 0 {
-		logger.Println("input2 doesn't have any audio streams, skipping...")
-		return
+	info, err := r.Info()
+	if err != nil {
+		return nil, err
 	}
 
-	origInfo = parser.ReplaceAudio(origInfo, file2Info)
+	if files := fileRecorderOf(ctx); files != nil {
+		files.add(f.Name(), r.Size(), reportStreams(info))
+	}
+
+	return info, nil
+}
 
-	err = origInfo.PrepareStreams().WriteTo(outF)
+func isWAV(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".wav")
+}
+
+// audioFromWAV encodes wav file into audio stream suitable for target
+func audioFromWAV(target *parser.USMInfo, f *os.File, opts parser.AudioEncodeOptions) (*parser.USMInfo, error) {
+	wav, err := parser.ReadWAV(bufio.NewReader(f))
 	if err != nil {
-		logger.Fatalf("can't write result to file: %s\n", err)
+		return nil, err
+	}
+
+	return parser.AudioFromWAV(target, wav, opts)
+}
+
+// parseReplaceArgs reads both inputs, output and flags
+func parseReplaceArgs(args []string) (in1, in2, out string, opts replaceOptions, err error) {
+	opts = newReplaceOptions()
+
+	a, err := parseArgs(args,
+		[]string{"--output", "--bitrate", "--quality", "--key", "--jobs", "--match", "--donor", "--pairs", "--report"},
+		"--recursive")
+	if err != nil {
+		return in1, in2, out, opts, err
+	}
+
+	if err = a.need(1, "input", "file to copy audio from"); err != nil {
+		return in1, in2, out, opts, err
+	}
+
+	if out, err = a.output(2); err != nil {
+		return in1, in2, out, opts, err
+	}
+
+	if v, ok := a.value("--bitrate"); ok {
+		if opts.Bitrate, err = parseBitrate(v); err != nil {
+			return in1, in2, out, opts, err
+		}
+	}
+
+	if v, ok := a.value("--quality"); ok {
+		opts.Quality = strings.ToLower(v)
+		if _, ok = parser.HCAQualities[opts.Quality]; !ok {
+			return in1, in2, out, opts, fmt.Errorf("unknown quality %s", v)
+		}
+	}
+
+	if v, ok := a.value("--key"); ok {
+		if opts.Key, err = parseKey(v); err != nil {
+			return in1, in2, out, opts, err
+		}
+	}
+
+	if v, ok := a.value("--jobs"); ok {
+		if opts.jobs, err = strconv.Atoi(v); err != nil || opts.jobs <= 0 {
+			return in1, in2, out, opts, fmt.Errorf("wrong amount of jobs %s", v)
+		}
+	}
+
+	if v, ok := a.value("--match"); ok {
+		if opts.pairing.match, err = regexp.Compile(v); err != nil {
+			return in1, in2, out, opts, fmt.Errorf("wrong --match pattern: %w", err)
+		}
+	}
+
+	opts.pairing.recursive = a.has("--recursive")
+	opts.pairing.donor, _ = a.value("--donor")
+	opts.pairing.manifest, _ = a.value("--pairs")
+	opts.report, _ = a.value("--report")
+
+	return a.arg(0), a.arg(1), out, opts, nil
+}
+
+// parseBitrate reads bitrate in bits per second, "k" suffix means kilobits
+func parseBitrate(s string) (int, error) {
+	multiplier := 1
+	if strings.HasSuffix(strings.ToLower(s), "k") {
+		multiplier = 1000
+		s = s[:len(s)-1]
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("wrong bitrate %s", s)
 	}
 
-	logger.Println(out, "ok!")
+	return v * multiplier, nil
 }
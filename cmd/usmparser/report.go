@@ -0,0 +1,302 @@
+package main
+
+import (
+	parser "USMparser"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// batchReport is machine-readable outcome of batch, written as JSON
+type batchReport struct {
+	Command string       `json:"command"`
+	Started time.Time    `json:"started"`
+	Elapsed float64      `json:"elapsed"`
+	OK      int          `json:"ok"`
+	Skipped int          `json:"skipped"`
+	Failed  int          `json:"failed"`
+	Files   []fileReport `json:"files"`
+}
+
+// fileReport is outcome of a single job of batch
+type fileReport struct {
+	Name string `json:"name"`
+	// ok, skipped or failed
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+	// time spent on the job in seconds
+	Elapsed float64      `json:"elapsed"`
+	Inputs  []reportFile `json:"inputs"`
+	// only set when output was written
+	Output *reportFile `json:"output,omitempty"`
+	Log    string      `json:"log,omitempty"`
+}
+
+// reportFile is a file read or written by the job
+type reportFile struct {
+	Path    string         `json:"path"`
+	Size    int64          `json:"size"`
+	Streams []reportStream `json:"streams,omitempty"`
+}
+
+type reportStream struct {
+	Type     string  `json:"type"`
+	Channel  int     `json:"channel"`
+	Duration float64 `json:"duration"`
+}
+
+// writeReport writes report of batch to path, as JUnit XML for .xml files and as JSON otherwise
+func writeReport(path, command string, started time.Time, results []batchResult) error {
+	report := makeReport(command, started, results)
+
+	var data []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".xml") {
+		data, err = xml.MarshalIndent(junitReport(report), "", "\t")
+		data = append([]byte(xml.Header), data...)
+	} else {
+		data, err = json.MarshalIndent(report, "", "\t")
+	}
+	if err != nil {
+		return fmt.Errorf("can't encode report: %w", err)
+	}
+
+	out, err := openOutput(path)
+	if err != nil {
+		return fmt.Errorf("can't write report: %w", err)
+	}
+
+	if _, err = out.Write(data); err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		out.Abort()
+		return fmt.Errorf("can't write report: %w", err)
+	}
+
+	return nil
+}
+
+func makeReport(command string, started time.Time, results []batchResult) batchReport {
+	report := batchReport{
+		Command: command,
+		Started: started,
+		Elapsed: time.Since(started).Seconds(),
+		Files:   make([]fileReport, 0, len(results)),
+	}
+	report.OK, report.Skipped, report.Failed = countResults(results)
+
+	for _, r := range results {
+		file := fileReport{
+			Name:    r.job.name,
+			Status:  "ok",
+			Elapsed: r.elapsed.Seconds(),
+			Inputs:  make([]reportFile, 0, len(r.job.inputs)),
+			Log:     string(r.log),
+		}
+
+		if r.err != nil {
+			file.Status, file.Reason = "failed", r.err.Error()
+			if r.skipped() {
+				file.Status = "skipped"
+				file.Reason = strings.TrimSuffix(file.Reason, ", "+errSkipped.Error())
+			}
+		}
+
+		file.Inputs = append(file.Inputs, r.inputs...)
+		// jobs which never started have only paths of their files
+		for _, input := range r.job.inputs[len(r.inputs):] {
+			file.Inputs = append(file.Inputs, reportFile{Path: input})
+		}
+
+		if r.err == nil && r.job.output != "" {
+			output := reportFile{Path: r.job.output}
+			if r.output != nil {
+				output = *r.output
+			}
+			file.Output = &output
+		}
+
+		report.Files = append(report.Files, file)
+	}
+
+	return report
+}
+
+type fileRecorderKey struct{}
+
+// fileRecorder collects sizes and stream durations of files read and written by a batch job,
+// they are taken while files are loaded anyway, so report doesn't have to read them again
+type fileRecorder struct {
+	mu    sync.Mutex
+	files map[string]reportFile
+}
+
+// recordFiles makes ctx in which parseFile and writeUSM add their files to returned recorder
+func recordFiles(ctx context.Context) (context.Context, *fileRecorder) {
+	r := &fileRecorder{files: make(map[string]reportFile)}
+	return context.WithValue(ctx, fileRecorderKey{}, r), r
+}
+
+// fileRecorderOf returns recorder of ctx, or nil if files of ctx aren't recorded
+func fileRecorderOf(ctx context.Context) *fileRecorder {
+	r, _ := ctx.Value(fileRecorderKey{}).(*fileRecorder)
+	return r
+}
+
+// add records file at path
+func (r *fileRecorder) add(path string, size int64, streams []reportStream) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files[path] = reportFile{Path: path, Size: size, Streams: streams}
+}
+
+// reportStreams returns durations of streams of movie, or nothing if they can't be read
+func reportStreams(info *parser.USMInfo) []reportStream {
+	summary, err := parser.Summarize(info)
+	if err != nil {
+		return nil
+	}
+
+	var result []reportStream
+	for _, s := range summary.Streams {
+		result = append(result, reportStream{Type: s.Type, Channel: s.Channel, Duration: s.Duration})
+	}
+
+	return result
+}
+
+// input returns recorded input at path. Inputs which weren't read as movies, e.g. wav donors, get only their size
+func (r *fileRecorder) input(path string) reportFile {
+	r.mu.Lock()
+	file, ok := r.files[path]
+	r.mu.Unlock()
+	if ok {
+		return file
+	}
+
+	file = reportFile{Path: path}
+	if stat, err := os.Stat(path); err == nil {
+		file.Size = stat.Size()
+	}
+
+	return file
+}
+
+// output returns recorded output at path, or nil if it wasn't written
+func (r *fileRecorder) output(path string) *reportFile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if file, ok := r.files[path]; ok {
+		return &file
+	}
+
+	return nil
+}
+
+// junitSuites is the root of JUnit XML report, every file of batch is a test case
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     float64      `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      float64     `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name       string          `xml:"name,attr"`
+	ClassName  string          `xml:"classname,attr"`
+	Time       float64         `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Failure    *junitMessage   `xml:"failure,omitempty"`
+	Skipped    *junitMessage   `xml:"skipped,omitempty"`
+	SystemOut  string          `xml:"system-out,omitempty"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+}
+
+// junitReport converts report to JUnit XML, sizes and durations of files go to properties of test cases
+func junitReport(report batchReport) junitSuites {
+	suite := junitSuite{
+		Name:      report.Command,
+		Tests:     len(report.Files),
+		Failures:  report.Failed,
+		Skipped:   report.Skipped,
+		Time:      report.Elapsed,
+		Timestamp: report.Started.Format("2006-01-02T15:04:05"),
+	}
+
+	for _, file := range report.Files {
+		c := junitCase{
+			Name:      file.Name,
+			ClassName: report.Command,
+			Time:      file.Elapsed,
+			SystemOut: file.Log,
+		}
+
+		switch file.Status {
+		case "failed":
+			c.Failure = &junitMessage{Message: file.Reason}
+		case "skipped":
+			c.Skipped = &junitMessage{Message: file.Reason}
+		}
+
+		files := append([]reportFile{}, file.Inputs...)
+		if file.Output != nil {
+			files = append(files, *file.Output)
+		}
+
+		for i, f := range files {
+			role := fmt.Sprintf("input%d", i+1)
+			if i >= len(file.Inputs) {
+				role = "output"
+			}
+
+			c.Properties = append(c.Properties,
+				junitProperty{Name: role, Value: f.Path},
+				junitProperty{Name: role + ".size", Value: fmt.Sprint(f.Size)})
+			for _, s := range f.Streams {
+				c.Properties = append(c.Properties, junitProperty{
+					Name:  fmt.Sprintf("%s.%s%d.duration", role, s.Type, s.Channel),
+					Value: fmt.Sprint(s.Duration),
+				})
+			}
+		}
+
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	return junitSuites{
+		Name:     "usmparser",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitSuite{suite},
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	parser "USMparser"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// manifest describes batch of jobs for run command
+type manifest struct {
+	// amount of jobs run at once, 1 by default
+	Workers int           `json:"workers" yaml:"workers"`
+	Jobs    []manifestJob `json:"jobs" yaml:"jobs"`
+}
+
+// manifestJob is a single operation of manifest.
+// Relative paths are relative to folder of manifest, output has the same default as the command
+type manifestJob struct {
+	Operation string   `json:"operation" yaml:"operation"`
+	Inputs    []string `json:"inputs" yaml:"inputs"`
+	// values of options by their names, numbers and lists are allowed along with strings
+	Options map[string]interface{} `json:"options" yaml:"options"`
+	Output  string                 `json:"output" yaml:"output"`
+}
+
+// jobOptions keeps track of options read by operation, so unknown ones can be reported
+type jobOptions struct {
+	values map[string]interface{}
+	read   map[string]bool
+}
+
+// runOptions are arguments of run command
+type runOptions struct {
+	// overrides workers of manifest if not 0
+	workers int
+	// path of JSON or JUnit XML report, none if empty
+	report string
+}
+
+// Run runs all jobs from manifest file `path`, up to `opts.workers` of them at once.
+// If workers is 0, amount from manifest is used
+func Run(ctx context.Context, path string, opts runOptions) {
+	m, err := readManifest(path)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	workers := opts.workers
+	if workers == 0 {
+		workers = m.Workers
+	}
+
+	// all jobs are checked before running any of them, so typos don't stop the batch halfway
+	base := filepath.Dir(path)
+	jobs := make([]batchJob, 0, len(m.Jobs))
+	for i, job := range m.Jobs {
+		prepared, err := job.prepare(base)
+		if err != nil {
+			log.Fatalf("job %d: %s\n", i+1, err)
+		}
+
+		prepared.name = fmt.Sprintf("#%d %s %s", i+1, job.Operation, strings.Join(job.Inputs, " "))
+		jobs = append(jobs, prepared)
+	}
+
+	started := time.Now()
+	results := runBatch(ctx, jobs, workers, log.Default())
+
+	printSummary(results, os.Stdout)
+	if opts.report != "" {
+		if err = writeReport(opts.report, "run", started, results); err != nil {
+			log.Println(err)
+		}
+	}
+	if _, _, failed := countResults(results); failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func readManifest(path string) (manifest, error) {
+	var m manifest
+
+	f, err := os.Open(path)
+	if err != nil {
+		return m, fmt.Errorf("can't open manifest: %w", err)
+	}
+	defer f.Close()
+
+	// format is picked by extension, everything except YAML is read as JSON
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		d := yaml.NewDecoder(f)
+		d.KnownFields(true)
+		err = d.Decode(&m)
+	default:
+		d := json.NewDecoder(f)
+		d.DisallowUnknownFields()
+		err = d.Decode(&m)
+	}
+	if err != nil {
+		return m, fmt.Errorf("can't read manifest: %w", err)
+	}
+
+	if len(m.Jobs) == 0 {
+		return m, errors.New("manifest has no jobs")
+	}
+
+	return m, nil
+}
+
+// prepare checks job and returns it ready to run, without name
+func (j manifestJob) prepare(base string) (batchJob, error) {
+	inputs := make([]string, len(j.Inputs))
+	for i, input := range j.Inputs {
+		inputs[i] = resolve(base, filepath.FromSlash(input))
+	}
+
+	output := j.Output
+	if output != "" {
+		output = resolve(base, filepath.FromSlash(output))
+	}
+
+	opts := jobOptions{values: j.Options, read: make(map[string]bool)}
+	var run func(ctx context.Context, logger *log.Logger) error
+
+	switch j.Operation {
+	case "replaceaudio":
+		if len(inputs) != 2 {
+			return batchJob{}, errors.New("replaceaudio needs movie and donor as inputs")
+		}
+
+		var encode parser.AudioEncodeOptions
+		var err error
+		if v, ok := opts.value("bitrate"); ok {
+			if encode.Bitrate, err = parseBitrate(v); err != nil {
+				return batchJob{}, err
+			}
+		}
+		if v, ok := opts.value("quality"); ok {
+			encode.Quality = strings.ToLower(v)
+			if _, ok = parser.HCAQualities[encode.Quality]; !ok {
+				return batchJob{}, fmt.Errorf("unknown quality %s", v)
+			}
+		}
+		if v, ok := opts.value("key"); ok {
+			if encode.Key, err = parseKey(v); err != nil {
+				return batchJob{}, err
+			}
+		}
+
+		output = defaultOutput(output, inputs[0], "-new.usm")
+		run = func(ctx context.Context, logger *log.Logger) error {
+			f, err := os.Open(inputs[0])
+			if err != nil {
+				return fmt.Errorf("can't open file: %w", err)
+			}
+
+			f2, err := os.Open(inputs[1])
+			if err != nil {
+				f.Close()
+				return fmt.Errorf("can't open file: %w", err)
+			}
+
+			return _replaceAudio(ctx, f, f2, output, encode, logger)
+		}
+	case "replacesubs":
+		if len(inputs) != 2 {
+			return batchJob{}, errors.New("replacesubs needs movie and donor as inputs")
+		}
+
+		output = defaultOutput(output, inputs[0], "-new.usm")
+		run = func(ctx context.Context, logger *log.Logger) error {
+			if err := replaceSubsFile(ctx, inputs[0], inputs[1], output); err != nil {
+				return err
+			}
+
+			logDone(logger, output, "")
+			return nil
+		}
+	case "strip":
+		if len(inputs) != 1 {
+			return batchJob{}, errors.New("strip needs one input")
+		}
+
+		v, ok := opts.value("streams")
+		if !ok {
+			return batchJob{}, errors.New("strip needs streams option")
+		}
+		streams := strings.Split(v, ",")
+		for i := range streams {
+			streams[i] = strings.TrimSpace(streams[i])
+		}
+
+		output = defaultOutput(output, inputs[0], "-new.usm")
+		run = func(ctx context.Context, logger *log.Logger) error {
+			if err := stripFile(ctx, inputs[0], output, streams); err != nil {
+				return err
+			}
+
+			logDone(logger, output, "")
+			return nil
+		}
+	case "cut":
+		if len(inputs) != 1 {
+			return batchJob{}, errors.New("cut needs one input")
+		}
+
+		var from, to float64
+		var err error
+		if v, ok := opts.value("from"); ok {
+			if from, err = parseTimestamp(v); err != nil {
+				return batchJob{}, err
+			}
+		}
+		if v, ok := opts.value("to"); ok {
+			if to, err = parseTimestamp(v); err != nil {
+				return batchJob{}, err
+			}
+		}
+
+		output = defaultOutput(output, inputs[0], "-cut.usm")
+		run = func(ctx context.Context, logger *log.Logger) error {
+			start, err := cutFile(ctx, inputs[0], output, from, to)
+			if err != nil {
+				return err
+			}
+
+			logDone(logger, output, "starts from keyframe at %s", formatTimestamp(start))
+			return nil
+		}
+	default:
+		return batchJob{}, fmt.Errorf("unknown operation %q", j.Operation)
+	}
+
+	if unknown := opts.unknown(); len(unknown) > 0 {
+		return batchJob{}, fmt.Errorf("unknown options of %s: %s", j.Operation, strings.Join(unknown, ", "))
+	}
+
+	return batchJob{
+		inputs: inputs,
+		output: output,
+		run: func(ctx context.Context, logger *log.Logger) error {
+			if err := makeOutputDir(filepath.Dir(output)); err != nil {
+				return err
+			}
+
+			return run(ctx, logger)
+		},
+	}, nil
+}
+
+// value returns option as string, lists are joined with commas
+func (o jobOptions) value(name string) (string, bool) {
+	o.read[name] = true
+
+	v, ok := o.values[name]
+	if !ok {
+		return "", false
+	}
+
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i := range v {
+			parts[i] = fmt.Sprint(v[i])
+		}
+		return strings.Join(parts, ","), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// unknown returns names of options which weren't read
+func (o jobOptions) unknown() []string {
+	result := make([]string, 0)
+	for name := range o.values {
+		if !o.read[name] {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// parseRunArgs reads manifest path and flags
+func parseRunArgs(args []string) (path string, opts runOptions, err error) {
+	a, err := parseArgs(args, []string{"--jobs", "--report"})
+	if err != nil {
+		return path, opts, err
+	}
+
+	if err = a.need(0, "manifest"); err != nil {
+		return path, opts, err
+	}
+
+	if v, ok := a.value("--jobs"); ok {
+		if opts.workers, err = strconv.Atoi(v); err != nil || opts.workers <= 0 {
+			return path, opts, fmt.Errorf("wrong amount of jobs %s", v)
+		}
+	}
+
+	opts.report, _ = a.value("--report")
+
+	return a.arg(0), opts, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const jsonManifest = `{
+  "workers": 2,
+  "jobs": [
+    {"operation": "replaceaudio", "inputs": ["intro.usm", "ja/intro.wav"], "options": {"quality": "high", "bitrate": 128, "key": "0x1234"}, "output": "out/intro.usm"},
+    {"operation": "strip", "inputs": ["credits.usm"], "options": {"streams": ["subtitles", "cues"]}},
+    {"operation": "cut", "inputs": ["full.usm"], "options": {"from": "00:00:05", "to": 30.5}, "output": "out/trailer.usm"}
+  ]
+}`
+
+const yamlManifest = `workers: 2
+jobs:
+  - operation: replaceaudio
+    inputs: [intro.usm, ja/intro.wav]
+    options:
+      quality: high
+      bitrate: 128
+      key: "0x1234"
+    output: out/intro.usm
+  - operation: strip
+    inputs: [credits.usm]
+    options:
+      streams:
+        - subtitles
+        - cues
+  - operation: cut
+    inputs: [full.usm]
+    options: {from: "00:00:05", to: 30.5}
+    output: out/trailer.usm
+`
+
+func TestReadManifest(t *testing.T) {
+	dir := t.TempDir()
+
+	read := func(name, content string) manifest {
+		t.Helper()
+
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		m, err := readManifest(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return m
+	}
+
+	fromJSON := read("build.json", jsonManifest)
+	fromYAML := read("build.yaml", yamlManifest)
+
+	if fromJSON.Workers != 2 || fromYAML.Workers != 2 {
+		t.Fatalf("got %d workers from JSON, %d from YAML", fromJSON.Workers, fromYAML.Workers)
+	}
+	if len(fromJSON.Jobs) != 3 || len(fromYAML.Jobs) != 3 {
+		t.Fatalf("got %d jobs from JSON, %d from YAML", len(fromJSON.Jobs), len(fromYAML.Jobs))
+	}
+
+	for i := range fromJSON.Jobs {
+		j, y := fromJSON.Jobs[i], fromYAML.Jobs[i]
+		if j.Operation != y.Operation || !reflect.DeepEqual(j.Inputs, y.Inputs) || j.Output != y.Output {
+			t.Fatalf("job %d: got %+v from JSON, %+v from YAML", i+1, j, y)
+		}
+
+		// numbers are decoded to different types, so options are compared the way jobs read them
+		jOpts := jobOptions{values: j.Options, read: make(map[string]bool)}
+		yOpts := jobOptions{values: y.Options, read: make(map[string]bool)}
+		if len(j.Options) != len(y.Options) {
+			t.Fatalf("job %d: got %d options from JSON, %d from YAML", i+1, len(j.Options), len(y.Options))
+		}
+		for name := range j.Options {
+			jv, _ := jOpts.value(name)
+			yv, ok := yOpts.value(name)
+			if !ok || jv != yv {
+				t.Fatalf("job %d: option %s is %q in JSON, %q in YAML", i+1, name, jv, yv)
+			}
+		}
+
+		jJob, err := j.prepare(dir)
+		if err != nil {
+			t.Fatalf("job %d from JSON: %s", i+1, err)
+		}
+		yJob, err := y.prepare(dir)
+		if err != nil {
+			t.Fatalf("job %d from YAML: %s", i+1, err)
+		}
+		if !reflect.DeepEqual(jJob.inputs, yJob.inputs) || jJob.output != yJob.output {
+			t.Fatalf("job %d: JSON one reads %v and writes %s, YAML one reads %v and writes %s",
+				i+1, jJob.inputs, jJob.output, yJob.inputs, yJob.output)
+		}
+	}
+}
+
+func TestReadManifestUnknownField(t *testing.T) {
+	dir := t.TempDir()
+
+	for name, content := range map[string]string{
+		"build.json": `{"jobs": [{"operation": "strip", "input": ["a.usm"]}]}`,
+		"build.yml":  "jobs:\n  - operation: strip\n    input: [a.usm]\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := readManifest(path); err == nil {
+			t.Fatalf("%s: expected error for unknown field", name)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	parser "USMparser"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// splitOptions are arguments of split command, either at or every is set
+type splitOptions struct {
+	// folder for parts
+	output string
+	// times in seconds to split at
+	at []float64
+	// length of parts in seconds
+	every float64
+}
+
+// Split writes parts of file `path` to `opts.output` as {{name}}-1.usm, {{name}}-2.usm and so on.
+// If output is empty, folder of the file is used
+func Split(ctx context.Context, path string, opts splitOptions) {
+	if err := splitFile(ctx, path, opts); err != nil {
+		exitOnError(err)
+	}
+}
+
+// splitFile writes parts of file `path`, all of them or none, except ones skipped because they exist
+func splitFile(ctx context.Context, path string, opts splitOptions) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("can't open source file: %w", err)
+	}
+	defer src.Close()
+
+	info, err := parseFile(ctx, src)
+	if err != nil {
+		return fmt.Errorf("can't parse file: %w", err)
+	}
+
+	var parts []*parser.USMInfo
+	var starts []float64
+	if opts.every > 0 {
+		parts, starts, err = info.SplitEvery(opts.every)
+	} else {
+		parts, starts, err = info.Split(opts.at)
+	}
+	if err != nil {
+		return fmt.Errorf("can't split file: %w", err)
+	}
+
+	outDir := opts.output
+	if outDir == "" {
+		outDir = filepath.Dir(path)
+	}
+
+	// outputs are checked before writing any of them, so a problem with one doesn't leave only some parts
+	name := strings.TrimSuffix(filepath.Base(path), ".usm")
+	outPaths := make([]string, len(parts))
+	for i := range parts {
+		outPaths[i] = filepath.Join(outDir, fmt.Sprintf("%s-%d.usm", name, i+1))
+		if err = checkNotInput(outPaths[i], path); err != nil {
+			return err
+		}
+		if err = checkOutput(outPaths[i]); err != nil && !errors.Is(err, errSkipped) {
+			return err
+		}
+	}
+
+	if err = makeOutputDir(outDir); err != nil {
+		return err
+	}
+
+	written := make([]string, 0, len(parts))
+	for i, part := range parts {
+		if err = writeUSM(ctx, part, outPaths[i]); errors.Is(err, errSkipped) {
+			log.Println(err)
+			continue
+		} else if err != nil {
+			removeOutputs(written)
+			return err
+		}
+
+		written = append(written, outPaths[i])
+		logDone(log.Default(), outPaths[i], "starts from keyframe at %s", formatTimestamp(starts[i]))
+	}
+
+	return nil
+}
+
+// parseSplitArgs reads input, output folder and where to split
+func parseSplitArgs(args []string) (path string, opts splitOptions, err error) {
+	a, err := parseArgs(args, []string{"--output", "--at", "--every"})
+	if err != nil {
+		return path, opts, err
+	}
+
+	if err = a.need(1, "input"); err != nil {
+		return path, opts, err
+	}
+
+	if opts.output, err = a.output(1); err != nil {
+		return path, opts, err
+	}
+
+	if v, ok := a.value("--every"); ok {
+		if opts.every, err = parseTimestamp(v); err != nil {
+			return path, opts, err
+		}
+		if opts.every <= 0 {
+			return path, opts, errors.New("--every needs positive length")
+		}
+	}
+
+	if v, ok := a.value("--at"); ok {
+		for _, s := range strings.Split(v, ",") {
+			t, err := parseTimestamp(strings.TrimSpace(s))
+			if err != nil {
+				return path, opts, err
+			}
+			opts.at = append(opts.at, t)
+		}
+	}
+
+	if len(opts.at) == 0 && opts.every == 0 {
+		return path, opts, errors.New("need to specify where to split with --at or --every")
+	}
+
+	if len(opts.at) > 0 && opts.every > 0 {
+		return path, opts, errors.New("--at and --every can't be used together")
+	}
+
+	return a.arg(0), opts, nil
+}
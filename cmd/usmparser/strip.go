@@ -0,0 +1,73 @@
+package main
+
+import (
+	parser "USMparser"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Strip removes `streams` from file `path` and writes result to `output`.
+// Streams are names of stream types, optionally followed by channel number, e.g. "audio:1".
+// If output is empty, {{path}}-new.usm is used
+func Strip(ctx context.Context, path string, streams []string, output string) {
+	output = defaultOutput(output, path, "-new.usm")
+	if err := stripFile(ctx, path, output, streams); err != nil {
+		exitOnError(err)
+	}
+
+	logDone(log.Default(), output, "")
+}
+
+// stripFile removes streams from file `path` and writes result to outPath
+func stripFile(ctx context.Context, path, outPath string, streams []string) error {
+	type target struct {
+		id      [4]byte
+		channel int
+	}
+
+	// names are checked before doing anything
+	targets := make([]target, 0, len(streams))
+	for _, stream := range streams {
+		name, channel, err := parseStreamName(stream)
+		if err != nil {
+			return err
+		}
+
+		id, ok := parser.StreamTypes[name]
+		if !ok {
+			return fmt.Errorf("unknown stream type: %s", name)
+		}
+
+		t := target{id: id, channel: int(channel)}
+		if !strings.Contains(stream, ":") {
+			t.channel = -1
+		}
+		targets = append(targets, t)
+	}
+
+	if err := checkNotInput(outPath, path); err != nil {
+		return err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("can't open source file: %w", err)
+	}
+	defer src.Close()
+
+	info, err := parseFile(ctx, src)
+	if err != nil {
+		return fmt.Errorf("can't parse file: %w", err)
+	}
+
+	for _, t := range targets {
+		if err = info.Strip(t.id, t.channel); err != nil {
+			return fmt.Errorf("can't remove stream: %w", err)
+		}
+	}
+
+	return writeUSM(ctx, info, outPath)
+}
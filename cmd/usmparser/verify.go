@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	parser "USMparser"
+)
+
+// Verify checks structural integrity of file `path` and prints found issues.
+// Exits with non-zero code if file has errors
+func Verify(ctx context.Context, path string) {
+	src, err := os.Open(path)
+	if err != nil {
+		log.Fatalln("can't open source file: ", err)
+	}
+	defer src.Close()
+
+	progress, done := fileProgress(ctx, "Reading", path)
+	r, err := parser.NewFileReaderContext(ctx, src, progress)
+	done()
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+
+	info, err := r.Info()
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+
+	report := parser.Validate(info)
+	fmt.Println(report.String())
+
+	if report.HasErrors() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,356 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Concat joins movies one after another, result is built in the first of them.
+// Movies need the same video codec, resolution and frame rate and the same audio streams.
+// Frame times of later movies are shifted by duration of the previous ones, every audio stream
+// keeps only one codec header. Audio of every movie starts at the codec frame nearest to its video,
+// silence is added or extra frames are dropped to keep it in sync. Key is needed for encrypted HCA
+// when silence has to be added. Seek info is regenerated on writing
+func Concat(segments []*USMInfo, key uint64) (*USMInfo, error) {
+	if len(segments) == 0 {
+		return nil, errors.New("nothing to concatenate")
+	}
+
+	result := segments[0]
+	for i, seg := range segments[1:] {
+		if err := checkConcat(result, seg); err != nil {
+			return nil, fmt.Errorf("movie %d: %w", i+2, err)
+		}
+	}
+
+	// start of every movie in seconds
+	offsets := make([]float64, len(segments))
+	for i, seg := range segments[:len(segments)-1] {
+		video, err := seg.summarizeStream(keyOf(seg.VideoStreams[0]))
+		if err != nil {
+			return nil, fmt.Errorf("movie %d: can't read video: %w", i+1, err)
+		}
+		offsets[i+1] = offsets[i] + video.Duration
+	}
+
+	for _, channel := range result.audioChannels() {
+		if err := concatAudio(segments, offsets, channel, key); err != nil {
+			return nil, fmt.Errorf("audio %d: %w", channel, err)
+		}
+	}
+
+	cues, err := result.CuePoints()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, seg := range segments[1:] {
+		offset := offsets[i+1]
+
+		result.VideoStreams = append(result.VideoStreams, shiftChunks(seg.VideoStreams, offset)...)
+		result.AlphaStreams = append(result.AlphaStreams, shiftChunks(seg.AlphaStreams, offset)...)
+		result.UnknownStreams = append(result.UnknownStreams, shiftChunks(seg.UnknownStreams, offset)...)
+
+		subs, err := shiftSubtitles(seg.SubtitleStreams, offset)
+		if err != nil {
+			return nil, fmt.Errorf("movie %d: %w", i+2, err)
+		}
+		result.SubtitleStreams = append(result.SubtitleStreams, subs...)
+
+		segCues, err := seg.CuePoints()
+		if err != nil {
+			return nil, fmt.Errorf("movie %d: %w", i+2, err)
+		}
+		for _, cue := range segCues {
+			cue.Time += uint64(math.Round(offset * 1000))
+			cues = append(cues, cue)
+		}
+
+		// streams which the first movie doesn't have still need their header info
+		for id, c := range seg.HDRInfo {
+			if _, ok := result.HDRInfo[id]; !ok {
+				result.HDRInfo[id] = c
+			}
+		}
+		for id, c := range seg.Metadata {
+			if _, ok := result.Metadata[id]; !ok {
+				result.Metadata[id] = c
+			}
+		}
+	}
+
+	if len(cues) > 0 {
+		if err = result.SetCuePoints(cues); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, id := range [][4]byte{_SFV, _ALP} {
+		if err = result.setHeaderFields(id, map[string]uint64{"total_frames": uint64(countFrames(result.framesOf(id)))}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = result.updateCRID(); err != nil {
+		return nil, err
+	}
+
+	return result, result.updateBitrates()
+}
+
+// checkConcat verifies that movie can go after the first one without breaking playback
+func checkConcat(first, next *USMInfo) error {
+	if len(first.VideoStreams) == 0 || len(next.VideoStreams) == 0 {
+		return errors.New("no video streams")
+	}
+
+	if (len(first.AlphaStreams) == 0) != (len(next.AlphaStreams) == 0) {
+		return errors.New("only one of the movies has alpha")
+	}
+
+	video, err := first.summarizeStream(keyOf(first.VideoStreams[0]))
+	if err != nil {
+		return fmt.Errorf("can't read video: %w", err)
+	}
+
+	nextVideo, err := next.summarizeStream(keyOf(next.VideoStreams[0]))
+	if err != nil {
+		return fmt.Errorf("can't read video: %w", err)
+	}
+
+	if video.Codec != nextVideo.Codec {
+		return fmt.Errorf("video is %s, but first movie has %s", nextVideo.Codec, video.Codec)
+	}
+
+	if video.Width != nextVideo.Width || video.Height != nextVideo.Height {
+		return fmt.Errorf("video is %dx%d, but first movie has %dx%d",
+			nextVideo.Width, nextVideo.Height, video.Width, video.Height)
+	}
+
+	if video.FrameRate != nextVideo.FrameRate {
+		return fmt.Errorf("video has %g fps, but first movie has %g fps", nextVideo.FrameRate, video.FrameRate)
+	}
+
+	// movie is decoded as a single stream, so it has to start from the picture which doesn't need previous ones
+	frames := next.streamOf(_SFV, next.VideoStreams[0].Data.PayloadHeader.ChannelNumber)
+	if len(frames) > 0 {
+		payload, err := frames[0].ReadPayload()
+		if err != nil {
+			return err
+		}
+
+		// keyframes of unknown codecs can't be checked
+		if key, err := isKeyframe(first.headerValue(_SFV, "mpeg_codec"), payload); err == nil && !key {
+			return errors.New("video doesn't start from keyframe")
+		}
+	}
+
+	channels, nextChannels := first.audioChannels(), next.audioChannels()
+	if !bytes.Equal(channels, nextChannels) {
+		return fmt.Errorf("movie has audio streams %v, but first movie has %v", nextChannels, channels)
+	}
+
+	for _, channel := range channels {
+		props, err := first.AudioProperties(channel)
+		if err != nil {
+			return fmt.Errorf("audio %d: %w", channel, err)
+		}
+
+		nextProps, err := next.AudioProperties(channel)
+		if err != nil {
+			return fmt.Errorf("audio %d: %w", channel, err)
+		}
+
+		if props.Codec != nextProps.Codec || props.SampleRate != nextProps.SampleRate || props.Channels != nextProps.Channels {
+			return fmt.Errorf("audio %d is %s %d Hz with %d channels, but first movie has %s %d Hz with %d channels",
+				channel, codecName(nextProps.Codec), nextProps.SampleRate, nextProps.Channels,
+				codecName(props.Codec), props.SampleRate, props.Channels)
+		}
+	}
+
+	return nil
+}
+
+// concatAudio joins frames of audio stream with provided channel from all movies into the first one.
+// Frames of every movie start at the frame nearest to its offset
+func concatAudio(segments []*USMInfo, offsets []float64, channel byte, key uint64) error {
+	result, err := segments[0].readAudioFrames(channel)
+	if err != nil {
+		return err
+	}
+
+	rate := float64(result.sampleRate)
+	var delay, samples uint64
+	// compares codec parameters of stream, ignoring its length
+	var layout func([]byte) ([]byte, error)
+	// makes silent frame, only when it's needed
+	var silence func() ([]byte, error)
+
+	switch result.codec {
+	case audioCodecHCA:
+		h, err := ParseHCAHeader(result.header)
+		if err != nil {
+			return err
+		}
+
+		delay, samples = uint64(h.EncoderDelay), h.Samples()
+		layout = func(header []byte) ([]byte, error) {
+			return patchHCAFormat(header, 0, 0, 0)
+		}
+		silence = func() ([]byte, error) {
+			return silentHCABlock(h, key)
+		}
+	case audioCodecADX:
+		h, err := ParseADXHeader(result.header)
+		if err != nil {
+			return err
+		}
+
+		// key stream of encrypted ADX depends on position of the frame
+		if h.Encrypted() {
+			return errors.New("encrypted ADX streams can't be concatenated")
+		}
+
+		samples = uint64(h.TotalSamples)
+		layout = func(header []byte) ([]byte, error) {
+			header = append([]byte{}, header...)
+			binary.BigEndian.PutUint32(header[0xC:], 0)
+			return header, nil
+		}
+		silence = func() ([]byte, error) {
+			// all nibbles are zero, so samples are only prediction from previous ones, which fades out
+			return make([]byte, adxBlockSize*h.Channels), nil
+		}
+	}
+
+	expected, err := layout(result.header)
+	if err != nil {
+		return err
+	}
+
+	var silent []byte
+	for i, seg := range segments[1:] {
+		a, err := seg.readAudioFrames(channel)
+		if err != nil {
+			return fmt.Errorf("movie %d: %w", i+2, err)
+		}
+
+		got, err := layout(a.header)
+		if err != nil {
+			return fmt.Errorf("movie %d: %w", i+2, err)
+		}
+
+		if !bytes.Equal(got, expected) {
+			return fmt.Errorf("movie %d: codec parameters differ from the first movie", i+2)
+		}
+
+		var segDelay uint64
+		if a.codec == audioCodecHCA {
+			h, err := ParseHCAHeader(a.header)
+			if err != nil {
+				return fmt.Errorf("movie %d: %w", i+2, err)
+			}
+			segDelay, samples = uint64(h.EncoderDelay), h.Samples()
+		} else {
+			h, err := ParseADXHeader(a.header)
+			if err != nil {
+				return fmt.Errorf("movie %d: %w", i+2, err)
+			}
+			samples = uint64(h.TotalSamples)
+		}
+
+		// first sample of the movie has to be played at its offset
+		start := offsets[i+1]*rate + float64(delay) - float64(segDelay)
+		first := int(math.Round(start / float64(result.frameSamples)))
+		if first < 0 {
+			first = 0
+		}
+
+		if first < len(result.frames) {
+			result.frames = result.frames[:first]
+		}
+
+		for len(result.frames) < first {
+			if silent == nil {
+				if silent, err = silence(); err != nil {
+					return err
+				}
+			}
+			result.frames = append(result.frames, silent)
+		}
+
+		result.frames = append(result.frames, a.frames...)
+		// samples of the previous movies are everything before the first frame of the last one
+		samples += uint64(first*result.frameSamples) + segDelay - delay
+	}
+
+	switch result.codec {
+	case audioCodecHCA:
+		padding := uint64(len(result.frames)*result.frameSamples) - delay - samples
+		if result.header, err = patchHCAFormat(result.header, uint32(len(result.frames)), uint16(delay), uint16(padding)); err != nil {
+			return err
+		}
+	case audioCodecADX:
+		result.header = append([]byte{}, result.header...)
+		binary.BigEndian.PutUint32(result.header[0xC:], uint32(samples))
+	}
+
+	segments[0].setAudioStream(channel, result.chunks(channel))
+
+	return segments[0].setHeaderFields(_SFA, map[string]uint64{"total_samples": samples})
+}
+
+// shiftChunks returns copy of stream chunks with frame times moved by offset seconds
+func shiftChunks(src []Chunk, offset float64) []Chunk {
+	result := make([]Chunk, 0, len(src))
+	for _, c := range src {
+		ph := &c.Data.PayloadHeader
+		if ph.PayloadType != PayloadTypeStream {
+			continue
+		}
+
+		ph.FrameTime += int32(math.Round(offset * float64(ph.FrameRate)))
+		result = append(result, c)
+	}
+
+	return result
+}
+
+// shiftSubtitles returns copy of subtitle chunks with frame times moved by offset seconds,
+// both in chunk and in subtitle header
+func shiftSubtitles(src []Chunk, offset float64) ([]Chunk, error) {
+	result := make([]Chunk, 0, len(src))
+	for _, c := range src {
+		if c.Data.PayloadHeader.PayloadType != PayloadTypeStream {
+			continue
+		}
+
+		payload, err := c.ReadPayload()
+		if err != nil {
+			return nil, err
+		}
+
+		sub, err := ReadSubtitleData(payload)
+		if err != nil {
+			return nil, locate(err, c.payloadOffset(), c.Header.ID)
+		}
+
+		rate := float64(sub.SubtitleHeader.FrameRate)
+		if rate == 0 {
+			rate = 1000
+		}
+
+		// text is kept as is, only time in the header is changed
+		payload = append([]byte{}, payload...)
+		binary.LittleEndian.PutUint32(payload[8:], sub.SubtitleHeader.FrameTime+uint32(math.Round(offset*rate)))
+
+		ph := c.Data.PayloadHeader
+		result = append(result, makeStreamChunk(c.Header.ID, ph.ChannelNumber,
+			ph.FrameTime+int32(math.Round(offset*float64(ph.FrameRate))), ph.FrameRate, payload))
+	}
+
+	return result, nil
+}
@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestConcat(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []float64
+	}{
+		{name: "two parts", points: []float64{1}},
+		{name: "three parts", points: []float64{0.3, 1.4}},
+		{name: "one part"},
+	}
+
+	source, err := testMovie(t).readAudioFrames(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, _, err := testMovie(t).Split(tt.points)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			joined, err := Concat(parts, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkFrames(t, joined, 0, testFrames)
+
+			// parts of split movie overlap by a block, joining them gives back blocks of the source
+			a, err := joined.readAudioFrames(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(a.frames) != len(source.frames) {
+				t.Fatalf("got %d blocks, expected %d", len(a.frames), len(source.frames))
+			}
+			for i := range a.frames {
+				if !bytes.Equal(a.frames[i], source.frames[i]) {
+					t.Fatalf("block %d differs from the source", i)
+				}
+			}
+
+			h, err := ParseHCAHeader(a.header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.Samples() != testSamples || h.EncoderDelay != hcaEncoderDelay {
+				t.Fatalf("got %d samples with delay %d, expected %d with delay %d", h.Samples(), h.EncoderDelay, testSamples, hcaEncoderDelay)
+			}
+			if n := joined.headerValue(_SFA, "total_samples"); n != testSamples {
+				t.Fatalf("total_samples is %d, expected %d", n, testSamples)
+			}
+		})
+	}
+}
+
+func TestConcatMismatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, s *USMInfo)
+	}{
+		{
+			name: "resolution",
+			change: func(t *testing.T, s *USMInfo) {
+				if err := s.setHeaderFields(_SFV, map[string]uint64{"width": 128}); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "starts between keyframes",
+			change: func(t *testing.T, s *USMInfo) {
+				s.VideoStreams = s.VideoStreams[1:]
+			},
+		},
+		{
+			name: "no audio",
+			change: func(t *testing.T, s *USMInfo) {
+				s.AudioStreams = nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := testMovie(t)
+			tt.change(t, next)
+
+			if _, err := Concat([]*USMInfo{testMovie(t), next}, 0); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
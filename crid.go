@@ -0,0 +1,251 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// updateCRID makes sure CRID lists every stream present in the file and doesn't list removed ones.
+// New entries copy layout of existing ones
+func (s *USMInfo) updateCRID() error {
+	if s.CRID.Header.ID != CRID {
+		return errors.New("no CRID chunk")
+	}
+
+	name, rows, err := s.CRID.Table()
+	if err != nil {
+		return fmt.Errorf("can't read CRID: %w", err)
+	}
+
+	if len(rows) == 0 {
+		return errors.New("CRID table is empty")
+	}
+
+	present := make(map[streamKey]bool)
+	for _, key := range streamKeys(s.streams()) {
+		present[key] = true
+	}
+
+	// first entry describes the file itself
+	result := [][]Entry{rows[0]}
+	listed := make(map[streamKey]bool)
+	for _, row := range rows[1:] {
+		key, ok := cridKey(row)
+		if !ok || !present[key] {
+			continue
+		}
+
+		listed[key] = true
+		result = append(result, row)
+	}
+
+	// unknown streams are kept in CRID if they were there, but not added
+	template := rows[len(rows)-1]
+	for _, key := range streamKeys(s.knownStreams()) {
+		if listed[key] {
+			continue
+		}
+
+		result = append(result, s.newCRIDEntry(template, key, rows[0]))
+	}
+
+	s.CRID, err = makeTableChunk(s.CRID, name, result)
+	return err
+}
+
+// cridKey returns stream described by CRID entry
+func cridKey(row []Entry) (streamKey, bool) {
+	stmid, okID := GetEntry(row, "stmid")
+	chno, okCh := GetEntry(row, "chno")
+	if !okID || !okCh {
+		return streamKey{}, false
+	}
+
+	var key streamKey
+	binary.BigEndian.PutUint32(key.ID[:], uint32(stmid.Uint()))
+	key.Channel = byte(chno.Uint())
+
+	return key, true
+}
+
+// newCRIDEntry makes entry for the stream using template for layout.
+// Sizes and bitrates are unknown, so they are left empty
+func (s *USMInfo) newCRIDEntry(template []Entry, key streamKey, fileEntry []Entry) []Entry {
+	row := make([]Entry, len(template))
+	for i, e := range template {
+		e.Value = append([]byte(nil), e.Value...)
+
+		switch {
+		case e.Key == "stmid":
+			setUint(&e, uint64(binary.BigEndian.Uint32(key.ID[:])))
+		case e.Key == "chno":
+			setUint(&e, uint64(key.Channel))
+		case e.Key == "filename":
+			base := "stream"
+			if fileName, ok := GetEntry(fileEntry, "filename"); ok {
+				base = strings.TrimSuffix(string(fileName.Value), path.Ext(string(fileName.Value)))
+			}
+			e.Value = []byte(fmt.Sprintf("%s.%s", base, s.StreamExtension(key.ID)))
+		case !e.Recurring && e.Type.Name != "String" && e.Type.Name != "Bytes":
+			setUint(&e, 0)
+		}
+
+		row[i] = e
+	}
+
+	return row
+}
+
+// setUint puts number into numeric entry, keeping its size
+func setUint(e *Entry, v uint64) {
+	e.Value = make([]byte, e.Type.Size)
+	switch e.Type.Size {
+	case 1:
+		e.Value[0] = byte(v)
+	case 2:
+		binary.BigEndian.PutUint16(e.Value, uint16(v))
+	case 4:
+		binary.BigEndian.PutUint32(e.Value, uint32(v))
+	case 8:
+		binary.BigEndian.PutUint64(e.Value, v)
+	}
+}
+
+// updateBitrates refreshes sizes and bitrates of streams in CRID after their contents changed.
+// Only fields CRID already has are updated
+func (s *USMInfo) updateBitrates() error {
+	name, rows, err := s.CRID.Table()
+	if err != nil {
+		return fmt.Errorf("can't read CRID: %w", err)
+	}
+
+	if len(rows) == 0 {
+		return errors.New("CRID table is empty")
+	}
+
+	var total int64
+	for _, row := range rows[1:] {
+		key, ok := cridKey(row)
+		if !ok {
+			continue
+		}
+
+		summary, err := s.summarizeStream(key)
+		if err != nil {
+			return fmt.Errorf("%s: %w", idToString(key.ID), err)
+		}
+		total += summary.Bitrate
+
+		for i := range row {
+			// shared values can't differ between streams
+			if row[i].Recurring {
+				continue
+			}
+
+			switch row[i].Key {
+			case "filesize":
+				setUint(&row[i], uint64(summary.Size))
+			case "avbps":
+				setUint(&row[i], uint64(summary.Bitrate))
+			}
+		}
+	}
+
+	for i := range rows[0] {
+		if rows[0][i].Key == "avbps" {
+			setUint(&rows[0][i], uint64(total))
+		}
+	}
+
+	s.CRID, err = makeTableChunk(s.CRID, name, rows)
+	return err
+}
+
+// cridWithFileSize returns copy of CRID with size of the whole file in its first entry, and whether it has changed.
+// The value is overwritten in place, so the chunk keeps its size and can be written over the old one.
+// CRID which can't be read, e.g. in recovered files, is left as is
+func cridWithFileSize(crid Chunk, size int64) (Chunk, bool, error) {
+	_, rows, err := crid.Table()
+	if err != nil || len(rows) == 0 {
+		return crid, false, nil
+	}
+
+	e, ok := GetEntry(rows[0], "filesize")
+	if !ok || e.Uint() == uint64(size) {
+		return crid, false, nil
+	}
+
+	// value shared by all entries would change sizes of streams as well
+	if e.Recurring && len(rows) > 1 {
+		return crid, false, errors.New("can't set file size in CRID: it's shared by all entries")
+	}
+
+	raw, err := crid.ReadPayload()
+	if err != nil {
+		return crid, false, err
+	}
+
+	offset, err := tableValueOffset(raw, "filesize")
+	if err != nil {
+		return crid, false, fmt.Errorf("can't set file size in CRID: %w", err)
+	}
+
+	setUint(&e, uint64(size))
+	payload := append([]byte{}, raw...)
+	copy(payload[offset:], e.Value)
+	crid.Data.Payload = payload
+
+	return crid, true, nil
+}
+
+// tableValueOffset returns position of value with provided key of the first row in raw @UTF table
+func tableValueOffset(raw []byte, key string) (int, error) {
+	payload, err := ParsePayload(raw)
+	if err != nil {
+		return 0, err
+	}
+
+	fixed := payload.PayloadData.PayloadFixedData
+	flex := payload.PayloadData.PayloadFlexData
+	strs := bytes.NewReader(flex.StringArray)
+
+	// every column has type and key in shared array followed by value if it's the same in all rows,
+	// values of the first row go at the start of unique array
+	shared, unique := 0, 0
+	for i := 0; i < int(fixed.ItemsPerDictionary); i++ {
+		if shared+5 > len(flex.SharedArray) {
+			return 0, errors.New("shared array is too short")
+		}
+
+		valueType, isUnique := GetValue(flex.SharedArray[shared])
+		name, err := ReadStringAt(strs, int(binary.BigEndian.Uint32(flex.SharedArray[shared+1:])))
+		if err != nil {
+			return 0, err
+		}
+		shared += 5
+
+		size := valueType.Size
+		if valueType.Name == "Bytes" {
+			size *= 2
+		}
+
+		if name == key {
+			if isUnique {
+				return 8 + int(fixed.UniqueArrayOffset) + unique, nil
+			}
+			return 8 + int(fixed.Length()) + shared, nil
+		}
+
+		if isUnique {
+			unique += size
+		} else {
+			shared += size
+		}
+	}
+
+	return 0, fmt.Errorf("no %s in table", key)
+}
@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCRIDFileSize(t *testing.T) {
+	s := testMovie(t)
+	if _, err := s.Cut(0.5, 1.5); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.usm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err = s.PrepareStreams().WriteTo(f); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewFileReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := r.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, rows, err := info.CRID.Table()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size, _ := GetEntry(rows[0], "filesize"); size.Uint() != uint64(r.Size()) {
+		t.Fatalf("CRID has file size %d, file has %d bytes", size.Uint(), r.Size())
+	}
+
+	// streams have sizes of their payloads
+	for _, row := range rows[1:] {
+		key, _ := cridKey(row)
+		summary, err := info.summarizeStream(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if size, _ := GetEntry(row, "filesize"); size.Uint() != uint64(summary.Size) {
+			t.Fatalf("CRID has size %d of %s, stream has %d bytes", size.Uint(), idToString(key.ID), summary.Size)
+		}
+	}
+}
+
+func TestCRIDFileSizeInPlace(t *testing.T) {
+	s := testMovie(t).PrepareStreams()
+
+	// table written by other tools may have data which isn't kept when it's rebuilt, here it's extra bytes at the end
+	raw := append(append([]byte{}, s.CRID.Data.Payload...), make([]byte, 0x10)...)
+	binary.BigEndian.PutUint32(raw[4:], binary.BigEndian.Uint32(raw[4:])+0x10)
+	s.CRID.Data.Payload = raw
+	s.CRID.Header.Size += 0x10
+	original := s.CRID
+
+	dir := t.TempDir()
+	write := func(name string) []byte {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		if err = s.WriteTo(f); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	first := write("first.usm")
+	if !bytes.Equal(first, write("second.usm")) {
+		t.Fatal("second write differs from the first one")
+	}
+	if s.CRID.Header != original.Header || !bytes.Equal(s.CRID.Data.Payload, original.Data.Payload) {
+		t.Fatal("CRID of the movie has changed while writing")
+	}
+
+	r, err := NewReader(bytes.NewReader(first), int64(len(first)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := r.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.CRID.Header.Size != original.Header.Size {
+		t.Fatalf("CRID has size %#x, expected %#x", info.CRID.Header.Size, original.Header.Size)
+	}
+	_, rows, err := info.CRID.Table()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := GetEntry(rows[0], "filesize"); size.Uint() != uint64(len(first)) {
+		t.Fatalf("CRID has file size %d, file has %d bytes", size.Uint(), len(first))
+	}
+}
@@ -0,0 +1,191 @@
+package parser
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// CuePoint is a named event, which game reacts to during playback.
+//
+// Cue points are stored in @CUE stream chunks as @UTF table with a row per cue point:
+// cue_name (String), time (Unsigned long long), tunit (Unsigned Integer, time units per second),
+// type (Unsigned Integer) and param_string (String)
+type CuePoint struct {
+	Name string `json:"name"`
+	// Time when cue point fires, in milliseconds
+	Time  uint64 `json:"time"`
+	Type  uint32 `json:"type"`
+	Param string `json:"param,omitempty"`
+}
+
+const cueTableName = "CUEPOINT_INFO"
+
+// DecodeCuePoints reads cue points from payload of @CUE stream chunk
+func DecodeCuePoints(raw []byte) ([]CuePoint, error) {
+	payload, err := ParsePayload(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	_, rows, err := BuildDict(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]CuePoint, 0, len(rows))
+	for i, row := range rows {
+		name, ok := GetEntry(row, "cue_name")
+		if !ok {
+			return nil, &ErrBadUTFTable{ChunkID: _CUE, Reason: fmt.Sprintf("cue point #%d has no name", i)}
+		}
+
+		t, ok := GetEntry(row, "time")
+		if !ok {
+			return nil, &ErrBadUTFTable{ChunkID: _CUE, Reason: fmt.Sprintf("cue point #%d has no time", i)}
+		}
+
+		cue := CuePoint{Name: string(name.Value), Time: t.Uint()}
+
+		// convert time to milliseconds
+		if unit, ok := GetEntry(row, "tunit"); ok && unit.Uint() != 0 && unit.Uint() != 1000 {
+			cue.Time = cue.Time * 1000 / unit.Uint()
+		}
+
+		if cueType, ok := GetEntry(row, "type"); ok {
+			cue.Type = uint32(cueType.Uint())
+		}
+
+		if param, ok := GetEntry(row, "param_string"); ok {
+			cue.Param = string(param.Value)
+		}
+
+		result = append(result, cue)
+	}
+
+	return result, nil
+}
+
+// EncodeCuePoints makes payload for @CUE stream chunk
+func EncodeCuePoints(cues []CuePoint) ([]byte, error) {
+	if len(cues) == 0 {
+		return nil, fmt.Errorf("no cue points to encode")
+	}
+
+	rows := make([][]Entry, 0, len(cues))
+	for _, cue := range cues {
+		var t = make([]byte, 8)
+		var unit = make([]byte, 4)
+		var cueType = make([]byte, 4)
+		binary.BigEndian.PutUint64(t, cue.Time)
+		binary.BigEndian.PutUint32(unit, 1000)
+		binary.BigEndian.PutUint32(cueType, cue.Type)
+
+		rows = append(rows, []Entry{
+			{Key: "cue_name", Type: values[0x1A], Recurring: false, Value: []byte(cue.Name)},
+			{Key: "time", Type: values[0x17], Recurring: false, Value: t},
+			{Key: "tunit", Type: values[0x15], Recurring: true, Value: unit},
+			{Key: "type", Type: values[0x15], Recurring: false, Value: cueType},
+			{Key: "param_string", Type: values[0x1A], Recurring: false, Value: []byte(cue.Param)},
+		})
+	}
+
+	payloadContent := compressDict(cueTableName, rows)
+
+	return compressPayload(Payload{
+		Header:      Header{ID: _UTF, Size: int32(payloadContent.Size())},
+		PayloadData: payloadContent,
+	})
+}
+
+// CuePoints returns all cue points of the file, ordered by time
+func (s *USMInfo) CuePoints() ([]CuePoint, error) {
+	result := make([]CuePoint, 0)
+
+	for _, c := range s.CueStreams {
+		if c.Data.PayloadHeader.PayloadType != PayloadTypeStream {
+			continue
+		}
+
+		payload, err := c.ReadPayload()
+		if err != nil {
+			return nil, err
+		}
+
+		cues, err := DecodeCuePoints(payload)
+		if err != nil {
+			return nil, locate(err, c.payloadOffset(), c.Header.ID)
+		}
+
+		result = append(result, cues...)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time < result[j].Time
+	})
+
+	return result, nil
+}
+
+// SetCuePoints replaces all cue points of the file, each cue point gets its own chunk.
+// Pass empty list to remove cue points
+func (s *USMInfo) SetCuePoints(cues []CuePoint) error {
+	var channel byte
+	if len(s.CueStreams) > 0 {
+		channel = s.CueStreams[0].Data.PayloadHeader.ChannelNumber
+	}
+
+	frameRate := s.videoFrameRate()
+
+	streams := make([]Chunk, 0, len(cues))
+	for _, cue := range cues {
+		payload, err := EncodeCuePoints([]CuePoint{cue})
+		if err != nil {
+			return err
+		}
+
+		// frame time is in the same units as video, so cue goes together with its frame
+		frameTime := int32(cue.Time * uint64(frameRate) / 1000)
+		streams = append(streams, makeStreamChunk(_CUE, channel, frameTime, frameRate, payload))
+	}
+
+	s.CueStreams = streams
+
+	return s.updateCRID()
+}
+
+// videoFrameRate returns frame rate used in video chunks
+func (s *USMInfo) videoFrameRate() int32 {
+	for _, c := range s.VideoStreams {
+		if c.Data.PayloadHeader.PayloadType == PayloadTypeStream && c.Data.PayloadHeader.FrameRate != 0 {
+			return c.Data.PayloadHeader.FrameRate
+		}
+	}
+
+	// 29.97 fps
+	return 2997
+}
+
+// WriteCuePoints exports cue points as JSON
+func WriteCuePoints(out io.Writer, cues []CuePoint) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "\t")
+
+	return encoder.Encode(cues)
+}
+
+// ReadCuePoints imports cue points from JSON made by WriteCuePoints
+func ReadCuePoints(src io.Reader) ([]CuePoint, error) {
+	var cues []CuePoint
+	if err := json.NewDecoder(src).Decode(&cues); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(cues, func(i, j int) bool {
+		return cues[i].Time < cues[j].Time
+	})
+
+	return cues, nil
+}
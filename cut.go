@@ -0,0 +1,358 @@
+package parser
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Cut keeps only part of the movie between from and to seconds, to <= 0 means the end of the movie.
+// Video starts from the nearest keyframe at or before from, other streams are cut at the same time,
+// all frame times are rebased to zero. Seek info is regenerated on writing.
+// Returns time of the keyframe the result starts from
+func (s *USMInfo) Cut(from, to float64) (float64, error) {
+	if to > 0 && to <= from {
+		return 0, fmt.Errorf("end of range %s is not after its start %s", formatSeconds(to), formatSeconds(from))
+	}
+	if to <= 0 {
+		to = math.Inf(1)
+	}
+
+	start, err := s.cutVideo(from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, channel := range s.audioChannels() {
+		if err = s.cutAudio(channel, start, to); err != nil {
+			return 0, fmt.Errorf("audio %d: %w", channel, err)
+		}
+	}
+
+	if err = s.cutSubtitles(start, to); err != nil {
+		return 0, err
+	}
+
+	s.UnknownStreams = cutChunks(s.UnknownStreams, start, to)
+
+	if len(s.CueStreams) > 0 {
+		cues, err := s.CuePoints()
+		if err != nil {
+			return 0, err
+		}
+
+		kept := make([]CuePoint, 0, len(cues))
+		for _, cue := range cues {
+			t := float64(cue.Time) / 1000
+			if t >= start && t < to {
+				cue.Time -= uint64(math.Round(start * 1000))
+				kept = append(kept, cue)
+			}
+		}
+
+		if err = s.SetCuePoints(kept); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = s.updateCRID(); err != nil {
+		return 0, err
+	}
+
+	return start, s.updateBitrates()
+}
+
+// cutVideo keeps video and alpha frames in range, starting from keyframe. Returns start time
+func (s *USMInfo) cutVideo(from, to float64) (float64, error) {
+	start, err := s.keyframeAt(from)
+	if err != nil {
+		return 0, err
+	}
+
+	s.VideoStreams = cutChunks(s.VideoStreams, start, to)
+	s.AlphaStreams = cutChunks(s.AlphaStreams, start, to)
+
+	if countFrames(s.VideoStreams) == 0 {
+		return 0, fmt.Errorf("no video frames between %s and %s", formatSeconds(from), formatSeconds(to))
+	}
+
+	for _, id := range [][4]byte{_SFV, _ALP} {
+		if err := s.setHeaderFields(id, map[string]uint64{"total_frames": uint64(countFrames(s.framesOf(id)))}); err != nil {
+			return 0, err
+		}
+	}
+
+	return start, nil
+}
+
+// cutAudio keeps audio frames in range. Frames are copied as is, so encrypted HCA doesn't need a key
+func (s *USMInfo) cutAudio(channel byte, start, end float64) error {
+	a, err := s.readAudioFrames(channel)
+	if err != nil {
+		return err
+	}
+
+	rate := float64(a.sampleRate)
+	var samples uint64
+
+	switch a.codec {
+	case audioCodecHCA:
+		h, err := ParseHCAHeader(a.header)
+		if err != nil {
+			return err
+		}
+
+		first := uint64(math.Round(start * rate))
+		last := h.Samples()
+		if end*rate < float64(last) {
+			last = uint64(math.Round(end * rate))
+		}
+		if first >= last {
+			s.setAudioStream(channel, nil)
+			return nil
+		}
+		samples = last - first
+
+		delay := uint64(h.EncoderDelay)
+		// one more block before the start, since every block overlaps with the previous one
+		firstBlock := int((first+delay)/HCASamplesPerBlock) - 1
+		if firstBlock < 0 {
+			firstBlock = 0
+		}
+		lastBlock := int((last + delay + HCASamplesPerBlock - 1) / HCASamplesPerBlock)
+		if lastBlock > len(a.frames) {
+			lastBlock = len(a.frames)
+		}
+
+		a.frames = a.frames[firstBlock:lastBlock]
+		delay = first + delay - uint64(firstBlock)*HCASamplesPerBlock
+		padding := uint64(len(a.frames))*HCASamplesPerBlock - delay - samples
+
+		if a.header, err = patchHCAFormat(a.header, uint32(len(a.frames)), uint16(delay), uint16(padding)); err != nil {
+			return err
+		}
+	case audioCodecADX:
+		h, err := ParseADXHeader(a.header)
+		if err != nil {
+			return err
+		}
+
+		// key stream of encrypted ADX depends on position of the frame
+		if h.Encrypted() {
+			return errors.New("encrypted ADX streams can't be cut")
+		}
+
+		// ADX has no encoder delay, so it starts from the beginning of the frame, up to 31 samples earlier
+		firstFrame := int(math.Round(start*rate)) / adxBlockSamples
+		last := uint64(h.TotalSamples)
+		if end*rate < float64(last) {
+			last = uint64(math.Round(end * rate))
+		}
+		if uint64(firstFrame*adxBlockSamples) >= last {
+			s.setAudioStream(channel, nil)
+			return nil
+		}
+		samples = last - uint64(firstFrame*adxBlockSamples)
+
+		lastFrame := int((last + adxBlockSamples - 1) / adxBlockSamples)
+		if lastFrame > len(a.frames) {
+			lastFrame = len(a.frames)
+		}
+		a.frames = a.frames[firstFrame:lastFrame]
+
+		a.header = append([]byte{}, a.header...)
+		binary.BigEndian.PutUint32(a.header[0xC:], uint32(samples))
+	}
+
+	s.setAudioStream(channel, a.chunks(channel))
+
+	return s.setHeaderFields(_SFA, map[string]uint64{"total_samples": samples})
+}
+
+// keyframeAt returns time of the last video keyframe at or before provided time
+func (s *USMInfo) keyframeAt(t float64) (float64, error) {
+	// times are given in milliseconds, while frames of 29.97 fps video don't start at whole ones
+	keyframes, err := s.keyframes(t + 0.0005)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(keyframes) == 0 {
+		return 0, fmt.Errorf("no keyframe at or before %s", formatSeconds(t))
+	}
+
+	return keyframes[len(keyframes)-1], nil
+}
+
+// keyframes returns times of video keyframes up to provided time
+func (s *USMInfo) keyframes(until float64) ([]float64, error) {
+	if len(s.VideoStreams) == 0 {
+		return nil, errors.New("no video streams")
+	}
+
+	codec := s.headerValue(_SFV, "mpeg_codec")
+	frames := s.streamOf(_SFV, s.VideoStreams[0].Data.PayloadHeader.ChannelNumber)
+
+	result := make([]float64, 0)
+	for _, c := range frames {
+		t := chunkTime(c)
+		if t > until {
+			break
+		}
+
+		payload, err := c.ReadPayload()
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := isKeyframe(codec, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		if key {
+			result = append(result, t)
+		}
+	}
+
+	return result, nil
+}
+
+// patchHCAFormat updates block count, encoder delay and padding in fmt section of HCA header
+func patchHCAFormat(header []byte, blocks uint32, delay, padding uint16) ([]byte, error) {
+	// fmt section always goes right after the version and header size
+	if len(header) < 0x18 || unmaskID(header[8:]) != hcaFmt {
+		return nil, &ErrBadHCAHeader{Reason: "no fmt section"}
+	}
+
+	result := append([]byte{}, header...)
+	binary.BigEndian.PutUint32(result[0x10:], blocks)
+	binary.BigEndian.PutUint16(result[0x14:], delay)
+	binary.BigEndian.PutUint16(result[0x16:], padding)
+
+	crc := crc16(result[:len(result)-2])
+	binary.BigEndian.PutUint16(result[len(result)-2:], crc)
+
+	return result, nil
+}
+
+// cutSubtitles keeps subtitles which are shown in range, cutting their times to it
+func (s *USMInfo) cutSubtitles(start, end float64) error {
+	result := make([]Chunk, 0, len(s.SubtitleStreams))
+	for _, c := range s.SubtitleStreams {
+		if c.Data.PayloadHeader.PayloadType != PayloadTypeStream {
+			continue
+		}
+
+		payload, err := c.ReadPayload()
+		if err != nil {
+			return err
+		}
+
+		sub, err := ReadSubtitleData(payload)
+		if err != nil {
+			return locate(err, c.payloadOffset(), c.Header.ID)
+		}
+
+		h := sub.SubtitleHeader
+		rate := float64(h.FrameRate)
+		if rate == 0 {
+			rate = 1000
+		}
+
+		from, to := float64(h.FrameTime)/rate, float64(h.FrameTime+h.FrameEnd)/rate
+		if to <= start || from >= end {
+			continue
+		}
+
+		from, to = math.Max(from, start), math.Min(to, end)
+
+		// text is kept as is, only times in the header are changed
+		payload = append([]byte{}, payload...)
+		binary.LittleEndian.PutUint32(payload[8:], uint32(math.Round((from-start)*rate)))
+		binary.LittleEndian.PutUint32(payload[12:], uint32(math.Round((to-from)*rate)))
+
+		ph := c.Data.PayloadHeader
+		result = append(result, makeStreamChunk(c.Header.ID, ph.ChannelNumber,
+			int32(math.Round((from-start)*float64(ph.FrameRate))), ph.FrameRate, payload))
+	}
+
+	s.SubtitleStreams = result
+
+	return nil
+}
+
+// cutChunks keeps stream chunks in range and rebases their frame times
+func cutChunks(src []Chunk, start, end float64) []Chunk {
+	result := make([]Chunk, 0, len(src))
+	for _, c := range src {
+		ph := &c.Data.PayloadHeader
+		if ph.PayloadType != PayloadTypeStream {
+			continue
+		}
+
+		if ph.FrameRate != 0 {
+			if t := chunkTime(c); t < start || t >= end {
+				continue
+			}
+			ph.FrameTime -= int32(math.Round(start * float64(ph.FrameRate)))
+		}
+
+		result = append(result, c)
+	}
+
+	return result
+}
+
+// chunkTime returns frame time of chunk in seconds
+func chunkTime(c Chunk) float64 {
+	ph := c.Data.PayloadHeader
+	if ph.FrameRate == 0 {
+		return 0
+	}
+
+	return float64(ph.FrameTime) / float64(ph.FrameRate)
+}
+
+// headerValue returns numeric field of stream header info, 0 if there is no such field
+func (s *USMInfo) headerValue(id [4]byte, key string) uint64 {
+	hdr, ok := s.HDRInfo[id]
+	if !ok {
+		return 0
+	}
+
+	_, rows, err := hdr.Table()
+	if err != nil || len(rows) == 0 {
+		return 0
+	}
+
+	e, _ := GetEntry(rows[0], key)
+	return e.Uint()
+}
+
+// setHeaderFields updates numeric fields of stream header info, fields which header doesn't have are ignored
+func (s *USMInfo) setHeaderFields(id [4]byte, fields map[string]uint64) error {
+	hdr, ok := s.HDRInfo[id]
+	if !ok {
+		return nil
+	}
+
+	name, rows, err := hdr.Table()
+	if err != nil {
+		return fmt.Errorf("can't read %s header info: %w", idToString(id), err)
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	for i := range rows[0] {
+		if v, ok := fields[rows[0][i].Key]; ok {
+			setUint(&rows[0][i], v)
+		}
+	}
+
+	s.HDRInfo[id], err = makeTableChunk(hdr, name, rows)
+	return err
+}
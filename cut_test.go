@@ -0,0 +1,86 @@
+package parser
+
+import "testing"
+
+func TestCut(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to float64
+		// keyframe the result starts from
+		start      int
+		frames     int
+		blocks     uint32
+		delay      uint16
+		padding    uint16
+		firstAudio int
+		samples    int
+	}{
+		{
+			name: "snaps to keyframe before start",
+			from: 0.5, to: 1.5,
+			start: 10, frames: 35,
+			// one more block before the start for overlap
+			blocks: 57, delay: 1792, padding: 576,
+			firstAudio: 16000, samples: 56000,
+		},
+		{
+			name:  "starts at keyframe, till the end",
+			from:  1,
+			start: 30, frames: 30,
+			blocks: 48, delay: 1024, padding: 128,
+			firstAudio: 48000, samples: 48000,
+		},
+		{
+			name:  "from the beginning",
+			to:    0.9,
+			start: 0, frames: 27,
+			blocks: 43, delay: 128, padding: 704,
+			firstAudio: 0, samples: 43200,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testMovie(t)
+
+			start, err := s.Cut(tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := float64(tt.start) / 30; start != expected {
+				t.Fatalf("starts at %g, expected %g", start, expected)
+			}
+
+			checkFrames(t, s, tt.start, tt.frames)
+
+			a, err := s.readAudioFrames(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h, err := ParseHCAHeader(a.header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.BlockCount != tt.blocks || h.EncoderDelay != tt.delay || h.EncoderPadding != tt.padding {
+				t.Fatalf("got %d blocks, delay %d, padding %d, expected %d blocks, delay %d, padding %d",
+					h.BlockCount, h.EncoderDelay, h.EncoderPadding, tt.blocks, tt.delay, tt.padding)
+			}
+			if n := s.headerValue(_SFA, "total_samples"); n != uint64(tt.samples) {
+				t.Fatalf("total_samples is %d, expected %d", n, tt.samples)
+			}
+
+			// blocks are copied as is, so decoded audio is the same part of the source
+			_, samples := decodeHCABlocks(t, a.header, a.frames, 0)
+			original := testTone(testSampleRate, 1, testSamples)[tt.firstAudio : tt.firstAudio+tt.samples]
+			if ratio := snr(original, samples); ratio < 30 {
+				t.Fatalf("SNR of cut audio is %.1f dB", ratio)
+			}
+		})
+	}
+}
+
+func TestCutBadRange(t *testing.T) {
+	if _, err := testMovie(t).Cut(1, 0.5); err == nil {
+		t.Fatal("expected error for end before start")
+	}
+}
@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"errors"
+	"math"
+)
+
+// DelayAudio shifts audio stream with provided channel by delay seconds, negative delay makes audio play earlier.
+// Stream is shifted by whole codec frames: silent frames are inserted at one edge and the same number of frames
+// is dropped from the other one, so length of the stream stays the same. Key is needed for encrypted HCA.
+// Returns delay which was actually applied
+func (s *USMInfo) DelayAudio(channel byte, delay float64, key uint64) (float64, error) {
+	a, err := s.readAudioFrames(channel)
+	if err != nil {
+		return 0, err
+	}
+
+	var silence []byte
+	switch a.codec {
+	case audioCodecHCA:
+		h, err := ParseHCAHeader(a.header)
+		if err != nil {
+			return 0, err
+		}
+
+		if silence, err = silentHCABlock(h, key); err != nil {
+			return 0, err
+		}
+	case audioCodecADX:
+		h, err := ParseADXHeader(a.header)
+		if err != nil {
+			return 0, err
+		}
+
+		// key stream of encrypted ADX depends on position of the frame
+		if h.Encrypted() {
+			return 0, errors.New("encrypted ADX streams can't be shifted")
+		}
+
+		// all nibbles are zero, so samples are only prediction from previous ones, which fades out
+		silence = make([]byte, adxBlockSize*h.Channels)
+	}
+
+	frames := a.frames
+	shift := int(math.Round(delay * float64(a.sampleRate) / float64(a.frameSamples)))
+	if shift > len(frames) {
+		shift = len(frames)
+	} else if shift < -len(frames) {
+		shift = -len(frames)
+	}
+
+	silent := make([][]byte, abs(shift))
+	for i := range silent {
+		silent[i] = silence
+	}
+
+	shifted := make([][]byte, 0, len(frames))
+	if shift >= 0 {
+		shifted = append(append(shifted, silent...), frames[:len(frames)-shift]...)
+	} else {
+		shifted = append(append(shifted, frames[-shift:]...), silent...)
+	}
+
+	a.frames = shifted
+	s.setAudioStream(channel, a.chunks(channel))
+
+	return float64(shift*a.frameSamples) / float64(a.sampleRate), nil
+}
+
+// silentHCABlock makes block without any coded bands, encrypted the same way as the stream
+func silentHCABlock(h HCAHeader, key uint64) ([]byte, error) {
+	decrypt, err := hcaCipherTable(h.CipherType, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var encrypt [256]byte
+	for i, v := range decrypt {
+		encrypt[v] = byte(i)
+	}
+
+	block := make([]byte, h.BlockSize)
+	// sync word followed by zeroes: no noise level, no scalefactors and no intensity
+	block[0], block[1] = 0xFF, 0xFF
+	for i := 0; i < len(block)-2; i++ {
+		block[i] = encrypt[block[i]]
+	}
+
+	crc := crc16(block[:len(block)-2])
+	block[len(block)-2], block[len(block)-1] = byte(crc>>8), byte(crc)
+
+	return block, nil
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+// adxMovie is the synthetic movie with its audio encoded to ADX, flags go to the codec header
+func adxMovie(t *testing.T, flags byte) *USMInfo {
+	t.Helper()
+
+	// codec of the movie is detected from its audio, without it ADX is used
+	s := testMovie(t)
+	s.AudioStreams = nil
+	delete(s.HDRInfo, _SFA)
+
+	wav := WAVAudio{SampleRate: testSampleRate, Channels: 1, Samples: testTone(testSampleRate, 1, testSamples)}
+	donor, err := AudioFromWAV(s, &wav, AudioEncodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.AudioStreams, s.HDRInfo[_SFA] = donor.AudioStreams, donor.HDRInfo[_SFA]
+	header := append([]byte{}, s.AudioStreams[0].Data.Payload...)
+	header[0x13] = flags
+	s.AudioStreams[0].Data.Payload = header
+
+	return s
+}
+
+func TestDelayAudio(t *testing.T) {
+	hca := testMovie
+	adx := func(t *testing.T) *USMInfo {
+		return adxMovie(t, 0)
+	}
+
+	tests := []struct {
+		name  string
+		movie func(t *testing.T) *USMInfo
+		delay float64
+		// expected shift in frames, positive ones have silence at the start
+		shift int
+	}{
+		// HCA frames have 1024 samples, about 21 ms at 48 kHz
+		{name: "HCA later", movie: hca, delay: 0.05, shift: 2},
+		{name: "HCA earlier", movie: hca, delay: -0.03, shift: -1},
+		{name: "HCA less than half a frame", movie: hca, delay: 0.01},
+		{name: "HCA longer than the stream", movie: hca, delay: -10, shift: -94},
+		// ADX frames have 32 samples
+		{name: "ADX later", movie: adx, delay: 0.01, shift: 15},
+		{name: "ADX earlier", movie: adx, delay: -0.0101, shift: -15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.movie(t)
+			before, err := s.readAudioFrames(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			applied, err := s.DelayAudio(0, tt.delay, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := float64(tt.shift*before.frameSamples) / float64(before.sampleRate); applied != expected {
+				t.Fatalf("applied delay %g, expected %g", applied, expected)
+			}
+
+			after, err := s.readAudioFrames(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(after.frames) != len(before.frames) {
+				t.Fatalf("got %d frames, expected %d", len(after.frames), len(before.frames))
+			}
+
+			silence := make([]byte, adxBlockSize)
+			if after.codec == audioCodecHCA {
+				h, err := ParseHCAHeader(after.header)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if silence, err = silentHCABlock(h, 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// silence goes before the start when audio is delayed and after the end when it's advanced
+			n := len(after.frames)
+			for i, frame := range after.frames {
+				expected := silence
+				if tt.shift >= 0 && i >= tt.shift {
+					expected = before.frames[i-tt.shift]
+				} else if tt.shift < 0 && i < n+tt.shift {
+					expected = before.frames[i-tt.shift]
+				}
+
+				if !bytes.Equal(frame, expected) {
+					t.Fatalf("frame %d differs, shifted by %d frames", i, tt.shift)
+				}
+			}
+
+			if after.codec == audioCodecHCA && tt.shift > 0 {
+				// decoded silence is exact, encoder delay is dropped by decoding
+				_, samples := decodeHCABlocks(t, after.header, after.frames, 0)
+				for i, v := range samples[:tt.shift*HCASamplesPerBlock-hcaEncoderDelay] {
+					if v != 0 {
+						t.Fatalf("sample %d of silence is %d", i, v)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDelayAudioEncryptedADX(t *testing.T) {
+	s := adxMovie(t, 0x08)
+	before := append([]Chunk{}, s.AudioStreams...)
+
+	if _, err := s.DelayAudio(0, 0.1, 0); err == nil {
+		t.Fatal("expected error for encrypted ADX")
+	}
+
+	if len(s.AudioStreams) != len(before) {
+		t.Fatalf("got %d audio chunks, expected %d", len(s.AudioStreams), len(before))
+	}
+	for i, c := range s.AudioStreams {
+		if !bytes.Equal(c.Data.Payload, before[i].Data.Payload) {
+			t.Fatalf("audio chunk %d has changed", i)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors below describe malformed files.
+// Offset is absolute position in the file when error is returned from ReadChunk, ParseFile or Reader.
+// Functions working with already extracted data (ReadChunkData, ParsePayload, BuildDict, ReadSubtitleData)
+// don't know where that data came from, so they report Offset relative to the start of their input.
+
+// ErrTruncatedChunk means there is less data than chunk header promises
+type ErrTruncatedChunk struct {
+	Offset   int64
+	ChunkID  [4]byte
+	Expected int
+	Actual   int
+}
+
+func (e *ErrTruncatedChunk) Error() string {
+	return fmt.Sprintf("truncated chunk %s at %#x: expected %d bytes but got %d",
+		idToString(e.ChunkID), e.Offset, e.Expected, e.Actual)
+}
+
+func (e *ErrTruncatedChunk) locate(offset int64, id [4]byte) {
+	e.Offset += offset
+	if e.ChunkID == [4]byte{} {
+		e.ChunkID = id
+	}
+}
+
+// ErrBadChunkSize means sizes from chunk header contradict each other
+type ErrBadChunkSize struct {
+	Offset      int64
+	ChunkID     [4]byte
+	Size        int32
+	PaddingSize uint16
+}
+
+func (e *ErrBadChunkSize) Error() string {
+	return fmt.Sprintf("bad size of chunk %s at %#x: size %#x, padding %#x",
+		idToString(e.ChunkID), e.Offset, e.Size, e.PaddingSize)
+}
+
+func (e *ErrBadChunkSize) locate(offset int64, id [4]byte) {
+	e.Offset += offset
+	if e.ChunkID == [4]byte{} {
+		e.ChunkID = id
+	}
+}
+
+// ErrUnknownChunkID means there is no valid chunk signature where chunk should start,
+// usually because file is corrupted or chunk sizes went out of sync
+type ErrUnknownChunkID struct {
+	Offset  int64
+	ChunkID [4]byte
+}
+
+func (e *ErrUnknownChunkID) Error() string {
+	return fmt.Sprintf("unknown chunk id % x at %#x", e.ChunkID, e.Offset)
+}
+
+func (e *ErrUnknownChunkID) locate(offset int64, _ [4]byte) {
+	e.Offset += offset
+}
+
+// ErrBadUTFTable means @UTF table inside chunk payload can't be decoded
+type ErrBadUTFTable struct {
+	Offset   int64
+	ChunkID  [4]byte
+	Reason   string
+	Expected int
+	Actual   int
+}
+
+func (e *ErrBadUTFTable) Error() string {
+	msg := fmt.Sprintf("bad @UTF table in chunk %s at %#x: %s",
+		idToString(e.ChunkID), e.Offset, e.Reason)
+	if e.Expected != e.Actual {
+		msg += fmt.Sprintf(" (expected %d bytes but got %d)", e.Expected, e.Actual)
+	}
+
+	return msg
+}
+
+func (e *ErrBadUTFTable) locate(offset int64, id [4]byte) {
+	e.Offset += offset
+	if e.ChunkID == [4]byte{} {
+		e.ChunkID = id
+	}
+}
+
+// locatedError is implemented by errors which position can be adjusted
+// once caller knows where the data came from
+type locatedError interface {
+	locate(offset int64, id [4]byte)
+}
+
+// locate shifts offset of typed error by base and sets chunk id if it's unknown.
+// Other errors are returned as is
+func locate(err error, base int64, id [4]byte) error {
+	var le locatedError
+	if errors.As(err, &le) {
+		le.locate(base, id)
+	}
+
+	return err
+}
+
+func idToString(id [4]byte) string {
+	if id == [4]byte{} {
+		return "<unknown>"
+	}
+
+	return string(id[:])
+}
+
+// isValidID checks if id looks like chunk signature: CRID or '@' followed by 3 uppercase letters or digits
+func isValidID(id [4]byte) bool {
+	if id == CRID {
+		return true
+	}
+
+	if id[0] != '@' {
+		return false
+	}
+
+	for _, b := range id[1:] {
+		if (b < 'A' || b > 'Z') && (b < '0' || b > '9') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkSizes validates that chunk size is big enough to hold payload header and padding
+func checkSizes(h Header, ph PayloadHeader) error {
+	if int(h.Size) < ph.Len() || int(h.Size)-ph.Len() < int(ph.PaddingSize) {
+		return &ErrBadChunkSize{ChunkID: h.ID, Size: h.Size, PaddingSize: ph.PaddingSize}
+	}
+
+	return nil
+}
+
+// ErrBadHCAHeader means HCA header in audio stream can't be decoded
+type ErrBadHCAHeader struct {
+	Offset  int64
+	ChunkID [4]byte
+	Reason  string
+}
+
+func (e *ErrBadHCAHeader) Error() string {
+	return fmt.Sprintf("bad HCA header in chunk %s at %#x: %s", idToString(e.ChunkID), e.Offset, e.Reason)
+}
+
+func (e *ErrBadHCAHeader) locate(offset int64, id [4]byte) {
+	e.Offset += offset
+	if e.ChunkID == [4]byte{} {
+		e.ChunkID = id
+	}
+}
+
+// ErrBadADXHeader means ADX header in audio stream can't be decoded
+type ErrBadADXHeader struct {
+	Offset  int64
+	ChunkID [4]byte
+	Reason  string
+}
+
+func (e *ErrBadADXHeader) Error() string {
+	return fmt.Sprintf("bad ADX header in chunk %s at %#x: %s", idToString(e.ChunkID), e.Offset, e.Reason)
+}
+
+func (e *ErrBadADXHeader) locate(offset int64, id [4]byte) {
+	e.Offset += offset
+	if e.ChunkID == [4]byte{} {
+		e.ChunkID = id
+	}
+}
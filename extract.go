@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// StreamTypes maps stream names to ids of their chunks
+var StreamTypes = map[string][4]byte{
+	"video":     _SFV,
+	"alpha":     _ALP,
+	"audio":     _SFA,
+	"subtitles": _SBT,
+	"cues":      _CUE,
+}
+
+// values of mpeg_codec field from VIDEO_HDRINFO
+const (
+	videoCodecMPEG1 = 1
+	videoCodecMPEG2 = 2
+	videoCodecH264  = 5
+	videoCodecVP9   = 9
+)
+
+// streamOf returns stream chunks of provided type and channel, ordered by frame time
+func (s *USMInfo) streamOf(id [4]byte, channel byte) []Chunk {
+	var src []Chunk
+	switch id {
+	case _SFV:
+		src = s.VideoStreams
+	case _ALP:
+		src = s.AlphaStreams
+	case _SFA:
+		src = s.AudioStreams
+	case _SBT:
+		src = s.SubtitleStreams
+	case _CUE:
+		src = s.CueStreams
+	}
+
+	result := make([]Chunk, 0, len(src))
+	for _, c := range src {
+		if c.Data.PayloadHeader.PayloadType == PayloadTypeStream && c.Data.PayloadHeader.ChannelNumber == channel {
+			result = append(result, c)
+		}
+	}
+
+	if id == _SFA {
+		return sortAudio(result)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Data.PayloadHeader.FrameTime < result[j].Data.PayloadHeader.FrameTime
+	})
+
+	return result
+}
+
+// ExtractStream writes raw data of the stream to out.
+// For video and alpha it's elementary video stream, for audio - HCA or ADX file (with header)
+func (s *USMInfo) ExtractStream(id [4]byte, channel byte, out io.Writer) error {
+	chunks := s.streamOf(id, channel)
+	if len(chunks) == 0 {
+		return fmt.Errorf("file has no %s stream with channel %d", idToString(id), channel)
+	}
+
+	for _, c := range chunks {
+		payload, err := c.ReadPayload()
+		if err != nil {
+			return err
+		}
+
+		if err = safeWriter(out, payload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StreamExtension returns file extension suitable for extracted stream, based on its codec
+func (s *USMInfo) StreamExtension(id [4]byte) string {
+	if id == _SFA {
+		if s.detectAudioCodec() == audioCodecADX {
+			return "adx"
+		}
+		return "hca"
+	}
+
+	if id == _SBT {
+		return "sbt"
+	}
+
+	if id == _CUE {
+		return "cue"
+	}
+
+	hdr, ok := s.HDRInfo[id]
+	if !ok {
+		return "m2v"
+	}
+
+	_, rows, err := hdr.Table()
+	if err != nil || len(rows) == 0 {
+		return "m2v"
+	}
+
+	codec, _ := GetEntry(rows[0], "mpeg_codec")
+	switch codec.Uint() {
+	case videoCodecH264:
+		return "h264"
+	case videoCodecVP9:
+		return "vp9"
+	default:
+		return "m2v"
+	}
+}
@@ -0,0 +1,318 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// HCASamplesPerBlock is number of samples per channel every HCA block decodes to
+const HCASamplesPerBlock = 1024
+
+// HCAHeader is decoded header of HCA audio stream.
+//
+// Header starts with HCA signature, version and header size, followed by sections:
+// fmt (format), comp or dec (compression parameters), and optional vbr, ath, loop, ciph, rva, comm and pad.
+// Header ends with CRC16 of everything before it. Encrypted files have signatures masked with 0x80
+type HCAHeader struct {
+	Version    uint16
+	HeaderSize uint16
+
+	Channels   int
+	SampleRate int
+	BlockCount uint32
+	// samples added by encoder at the start and at the end of the stream
+	EncoderDelay   uint16
+	EncoderPadding uint16
+
+	// size of every block in bytes, 0 for VBR streams
+	BlockSize uint16
+	Comp      HCACompParams
+
+	// present only for VBR streams
+	VBRMaxBlockSize uint16
+	VBRNoiseLevel   uint16
+
+	ATHType uint16
+
+	Loop *HCALoop
+
+	// 0 - no encryption, 1 - static key, 56 - keyed encryption
+	CipherType uint16
+
+	Volume  float32
+	Comment string
+}
+
+// HCACompParams describes how spectrum is coded in blocks
+type HCACompParams struct {
+	MinResolution    byte
+	MaxResolution    byte
+	TrackCount       byte
+	ChannelConfig    byte
+	TotalBandCount   byte
+	BaseBandCount    byte
+	StereoBandCount  byte
+	BandsPerHFRGroup byte
+	MSStereo         byte
+}
+
+// HCALoop is loop region of the stream in blocks
+type HCALoop struct {
+	StartBlock uint32
+	EndBlock   uint32
+	// samples to skip in the first block and to drop from the last one
+	StartDelay uint16
+	EndPadding uint16
+}
+
+// Samples returns number of samples per channel, without encoder delay and padding
+func (h HCAHeader) Samples() uint64 {
+	total := uint64(h.BlockCount) * HCASamplesPerBlock
+	trim := uint64(h.EncoderDelay) + uint64(h.EncoderPadding)
+	if trim > total {
+		return 0
+	}
+
+	return total - trim
+}
+
+// Duration returns length of the stream in seconds
+func (h HCAHeader) Duration() float64 {
+	if h.SampleRate == 0 {
+		return 0
+	}
+
+	return float64(h.Samples()) / float64(h.SampleRate)
+}
+
+// Encrypted reports whether blocks need a key to be decoded
+func (h HCAHeader) Encrypted() bool {
+	return h.CipherType != 0
+}
+
+var (
+	hcaFmt  = [4]byte{'f', 'm', 't', 0}
+	hcaComp = [4]byte{'c', 'o', 'm', 'p'}
+	hcaDec  = [4]byte{'d', 'e', 'c', 0}
+	hcaVBR  = [4]byte{'v', 'b', 'r', 0}
+	hcaATH  = [4]byte{'a', 't', 'h', 0}
+	hcaLoop = [4]byte{'l', 'o', 'o', 'p'}
+	hcaCiph = [4]byte{'c', 'i', 'p', 'h'}
+	hcaRVA  = [4]byte{'r', 'v', 'a', 0}
+	hcaComm = [4]byte{'c', 'o', 'm', 'm'}
+	hcaPad  = [4]byte{'p', 'a', 'd', 0}
+)
+
+// hcaSectionSizes lists sizes of fixed sections, without signature
+var hcaSectionSizes = map[[4]byte]int{
+	hcaFmt:  0x0C,
+	hcaComp: 0x0C,
+	hcaDec:  0x08,
+	hcaVBR:  0x04,
+	hcaATH:  0x02,
+	hcaLoop: 0x0C,
+	hcaCiph: 0x02,
+	hcaRVA:  0x04,
+}
+
+// ParseHCAHeader decodes HCA header from the start of data
+func ParseHCAHeader(data []byte) (HCAHeader, error) {
+	var h HCAHeader
+
+	if len(data) < 8 || unmaskID(data) != HCA_ {
+		return h, &ErrBadHCAHeader{Reason: "no HCA signature"}
+	}
+
+	h.Version = binary.BigEndian.Uint16(data[4:])
+	h.HeaderSize = binary.BigEndian.Uint16(data[6:])
+	if int(h.HeaderSize) > len(data) || h.HeaderSize < 8+2 {
+		return h, &ErrBadHCAHeader{Reason: fmt.Sprintf("header size %#x doesn't fit into %#x bytes", h.HeaderSize, len(data))}
+	}
+
+	data = data[:h.HeaderSize]
+	if crc16(data) != 0 {
+		return h, &ErrBadHCAHeader{Reason: "checksum mismatch"}
+	}
+
+	// old versions use ATH table by default
+	if h.Version < 0x200 {
+		h.ATHType = 1
+	}
+
+	var hasFmt, hasComp bool
+	// last 2 bytes are checksum
+	end := len(data) - 2
+	pos := 8
+	for pos+4 <= end {
+		id := unmaskID(data[pos:])
+		if id == hcaPad {
+			break
+		}
+
+		body := data[pos+4 : end]
+		size, known := hcaSectionSizes[id]
+		switch {
+		case id == hcaComm:
+			if len(body) < 1 || len(body) < 1+int(body[0]) {
+				return h, &ErrBadHCAHeader{Offset: int64(pos), Reason: "comm section is truncated"}
+			}
+			size = 1 + int(body[0])
+			h.Comment = string(trimZero(body[1:size]))
+		case !known:
+			return h, &ErrBadHCAHeader{Offset: int64(pos), Reason: fmt.Sprintf("unknown section % x", id)}
+		case len(body) < size:
+			return h, &ErrBadHCAHeader{Offset: int64(pos), Reason: fmt.Sprintf("%s section is truncated", trimZero(id[:]))}
+		}
+
+		switch id {
+		case hcaFmt:
+			hasFmt = true
+			h.Channels = int(body[0])
+			h.SampleRate = int(binary.BigEndian.Uint32(body) & 0xFFFFFF)
+			h.BlockCount = binary.BigEndian.Uint32(body[4:])
+			h.EncoderDelay = binary.BigEndian.Uint16(body[8:])
+			h.EncoderPadding = binary.BigEndian.Uint16(body[10:])
+		case hcaComp:
+			hasComp = true
+			h.BlockSize = binary.BigEndian.Uint16(body)
+			h.Comp = HCACompParams{
+				MinResolution:    body[2],
+				MaxResolution:    body[3],
+				TrackCount:       body[4],
+				ChannelConfig:    body[5],
+				TotalBandCount:   body[6],
+				BaseBandCount:    body[7],
+				StereoBandCount:  body[8],
+				BandsPerHFRGroup: body[9],
+				MSStereo:         body[10],
+			}
+		case hcaDec:
+			// older layout of compression parameters
+			hasComp = true
+			h.BlockSize = binary.BigEndian.Uint16(body)
+			h.Comp = HCACompParams{
+				MinResolution:  body[2],
+				MaxResolution:  body[3],
+				TotalBandCount: body[4] + 1,
+				BaseBandCount:  body[5] + 1,
+				TrackCount:     body[6] >> 4,
+				ChannelConfig:  body[6] & 0x0F,
+			}
+			// without stereo all bands are coded separately
+			if body[7] == 0 {
+				h.Comp.BaseBandCount = h.Comp.TotalBandCount
+			}
+			h.Comp.StereoBandCount = h.Comp.TotalBandCount - h.Comp.BaseBandCount
+		case hcaVBR:
+			h.VBRMaxBlockSize = binary.BigEndian.Uint16(body)
+			h.VBRNoiseLevel = binary.BigEndian.Uint16(body[2:])
+		case hcaATH:
+			h.ATHType = binary.BigEndian.Uint16(body)
+		case hcaLoop:
+			h.Loop = &HCALoop{
+				StartBlock: binary.BigEndian.Uint32(body),
+				EndBlock:   binary.BigEndian.Uint32(body[4:]),
+				StartDelay: binary.BigEndian.Uint16(body[8:]),
+				EndPadding: binary.BigEndian.Uint16(body[10:]),
+			}
+		case hcaCiph:
+			h.CipherType = binary.BigEndian.Uint16(body)
+		case hcaRVA:
+			h.Volume = math.Float32frombits(binary.BigEndian.Uint32(body))
+		}
+
+		pos += 4 + size
+	}
+
+	if !hasFmt || !hasComp {
+		return h, &ErrBadHCAHeader{Reason: "fmt or comp section is missing"}
+	}
+
+	if h.Channels == 0 || h.SampleRate == 0 {
+		return h, &ErrBadHCAHeader{Reason: fmt.Sprintf("bad format: %d channels, %d Hz", h.Channels, h.SampleRate)}
+	}
+
+	switch h.CipherType {
+	case 0, 1, 56:
+	default:
+		return h, &ErrBadHCAHeader{Reason: fmt.Sprintf("unknown cipher type %d", h.CipherType)}
+	}
+
+	return h, nil
+}
+
+// HCAHeader decodes HCA header of audio stream with provided channel
+func (s *USMInfo) HCAHeader(channel byte) (HCAHeader, error) {
+	for _, c := range s.AudioStreams {
+		if c.Data.PayloadHeader.PayloadType != PayloadTypeStream || c.Data.PayloadHeader.ChannelNumber != channel {
+			continue
+		}
+
+		if isHCAHeader(c) {
+			return readHCAHeader(c)
+		}
+	}
+
+	return HCAHeader{}, fmt.Errorf("audio stream %d has no HCA header", channel)
+}
+
+func readHCAHeader(c Chunk) (HCAHeader, error) {
+	payload, err := c.ReadPayload()
+	if err != nil {
+		return HCAHeader{}, err
+	}
+
+	h, err := ParseHCAHeader(payload)
+	if err != nil {
+		return h, locate(err, c.payloadOffset(), c.Header.ID)
+	}
+
+	return h, nil
+}
+
+// unmaskID reads section signature, ignoring encryption mask
+func unmaskID(data []byte) (id [4]byte) {
+	for i := range id {
+		id[i] = data[i] & 0x7F
+	}
+
+	return id
+}
+
+func trimZero(b []byte) []byte {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+
+	return b
+}
+
+// crc16 calculates checksum used in HCA headers and blocks.
+// Data including its stored checksum gives 0
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^b]
+	}
+
+	return crc
+}
+
+var crc16Table = makeCRC16Table(0x8005)
+
+func makeCRC16Table(poly uint16) (table [256]uint16) {
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+
+	return table
+}
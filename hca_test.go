@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCRC16(t *testing.T) {
+	// check value of CRC-16/UMTS, the variant HCA uses
+	if crc := crc16([]byte("123456789")); crc != 0xFEE8 {
+		t.Fatalf("got %#x", crc)
+	}
+
+	data := []byte{0xFF, 0xFF, 0x12, 0x34, 0, 0}
+	crc := crc16(data[:4])
+	data[4], data[5] = byte(crc>>8), byte(crc)
+	if crc16(data) != 0 {
+		t.Fatal("data with its checksum doesn't give 0")
+	}
+}
+
+func TestHCAHeader(t *testing.T) {
+	h := HCAHeader{
+		Version:        0x200,
+		HeaderSize:     hcaHeaderSize,
+		Channels:       2,
+		SampleRate:     48000,
+		BlockCount:     17,
+		EncoderDelay:   hcaEncoderDelay,
+		EncoderPadding: 300,
+		BlockSize:      0x155,
+		Comp: HCACompParams{
+			MinResolution:  1,
+			MaxResolution:  15,
+			TrackCount:     1,
+			TotalBandCount: 100,
+			BaseBandCount:  100,
+		},
+		CipherType: 56,
+	}
+
+	data := writeHCAHeader(h)
+	if len(data) != hcaHeaderSize {
+		t.Fatalf("header has %#x bytes", len(data))
+	}
+
+	parsed, err := ParseHCAHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Channels != h.Channels || parsed.SampleRate != h.SampleRate || parsed.BlockCount != h.BlockCount ||
+		parsed.EncoderDelay != h.EncoderDelay || parsed.EncoderPadding != h.EncoderPadding ||
+		parsed.BlockSize != h.BlockSize || parsed.Comp != h.Comp || parsed.CipherType != h.CipherType {
+		t.Fatalf("got %+v, expected %+v", parsed, h)
+	}
+	if parsed.Samples() != 17*HCASamplesPerBlock-hcaEncoderDelay-300 {
+		t.Fatalf("got %d samples", parsed.Samples())
+	}
+
+	// every byte matters, including masked signatures and the checksum itself
+	for _, pos := range []int{5, 0x10, len(data) - 1} {
+		damaged := append([]byte(nil), data...)
+		damaged[pos] ^= 0x40
+
+		_, err = ParseHCAHeader(damaged)
+		var headerErr *ErrBadHCAHeader
+		if !errors.As(err, &headerErr) || headerErr.Reason != "checksum mismatch" {
+			t.Fatalf("byte %#x: got %v", pos, err)
+		}
+	}
+}
@@ -0,0 +1,651 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	hcaSubframes          = 8
+	hcaSamplesPerSubframe = 128
+)
+
+// roles of channels in stereo pairs, secondary channel keeps only base bands and
+// restores the rest from primary one
+const (
+	hcaDiscrete = iota
+	hcaStereoPrimary
+	hcaStereoSecondary
+)
+
+type hcaChannel struct {
+	kind       int
+	codedCount int
+
+	intensity    [hcaSubframes]byte
+	scalefactors [hcaSamplesPerSubframe]byte
+	resolution   [hcaSamplesPerSubframe]byte
+	// indexes of bands without data first, and indexes of bands with data from the end
+	noises     [hcaSamplesPerSubframe]byte
+	noiseCount int
+	validCount int
+
+	gain     [hcaSamplesPerSubframe]float64
+	spectra  [hcaSubframes][hcaSamplesPerSubframe]float64
+	previous [hcaSamplesPerSubframe]float64
+	wave     [hcaSubframes][hcaSamplesPerSubframe]float64
+}
+
+// HCADecoder decodes HCA blocks into 16-bit PCM
+type HCADecoder struct {
+	header        HCAHeader
+	hfrGroupCount int
+	athCurve      [hcaSamplesPerSubframe]byte
+	cipher        [256]byte
+	random        uint32
+	channels      []hcaChannel
+}
+
+// NewHCADecoder prepares decoder for stream with provided header.
+// Key is needed only for streams with cipher type 56
+func NewHCADecoder(h HCAHeader, key uint64) (*HCADecoder, error) {
+	d := &HCADecoder{header: h, random: 1}
+
+	if h.BlockSize == 0 {
+		return nil, errors.New("VBR HCA streams are not supported")
+	}
+
+	if h.Channels > 16 {
+		return nil, fmt.Errorf("too many channels: %d", h.Channels)
+	}
+
+	comp := &d.header.Comp
+	if comp.TrackCount == 0 {
+		comp.TrackCount = 1
+	}
+
+	if int(comp.TrackCount) > h.Channels || h.Channels%int(comp.TrackCount) != 0 {
+		return nil, fmt.Errorf("%d tracks don't fit into %d channels", comp.TrackCount, h.Channels)
+	}
+
+	if comp.TotalBandCount > hcaSamplesPerSubframe ||
+		int(comp.BaseBandCount)+int(comp.StereoBandCount) > int(comp.TotalBandCount) {
+		return nil, fmt.Errorf("bad band counts: base %d, stereo %d, total %d",
+			comp.BaseBandCount, comp.StereoBandCount, comp.TotalBandCount)
+	}
+
+	if comp.MinResolution > comp.MaxResolution || comp.MaxResolution > 15 {
+		return nil, fmt.Errorf("bad resolution range %d-%d", comp.MinResolution, comp.MaxResolution)
+	}
+
+	if comp.BandsPerHFRGroup > 0 {
+		hfrBands := int(comp.TotalBandCount) - int(comp.BaseBandCount) - int(comp.StereoBandCount)
+		d.hfrGroupCount = (hfrBands + int(comp.BandsPerHFRGroup) - 1) / int(comp.BandsPerHFRGroup)
+	}
+
+	switch h.ATHType {
+	case 0:
+	case 1:
+		d.athCurve = hcaATHCurve(h.SampleRate)
+	default:
+		return nil, fmt.Errorf("ATH type %d is not supported", h.ATHType)
+	}
+
+	cipher, err := hcaCipherTable(h.CipherType, key)
+	if err != nil {
+		return nil, err
+	}
+	d.cipher = cipher
+
+	d.channels = make([]hcaChannel, h.Channels)
+	kinds := hcaChannelKinds(h.Channels, int(comp.TrackCount), int(comp.ChannelConfig), comp.StereoBandCount > 0)
+	for i := range d.channels {
+		d.channels[i].kind = kinds[i]
+		d.channels[i].codedCount = int(comp.BaseBandCount)
+		if kinds[i] != hcaStereoSecondary {
+			d.channels[i].codedCount += int(comp.StereoBandCount)
+		}
+	}
+
+	return d, nil
+}
+
+// hcaChannelKinds splits channels of every track into stereo pairs and discrete channels
+func hcaChannelKinds(channels, tracks, config int, stereo bool) []int {
+	kinds := make([]int, channels)
+	perTrack := channels / tracks
+	if !stereo || perTrack <= 1 {
+		return kinds
+	}
+
+	const p, s, d = hcaStereoPrimary, hcaStereoSecondary, hcaDiscrete
+	var layout []int
+	switch perTrack {
+	case 2:
+		layout = []int{p, s}
+	case 3:
+		layout = []int{p, s, d}
+	case 4:
+		layout = []int{p, s, p, s}
+		if config != 0 {
+			layout = []int{p, s, d, d}
+		}
+	case 5:
+		layout = []int{p, s, d, p, s}
+		if config > 2 {
+			layout = []int{p, s, d, d, d}
+		}
+	case 6:
+		layout = []int{p, s, d, d, p, s}
+	case 7:
+		layout = []int{p, s, d, d, p, s, d}
+	default:
+		layout = []int{p, s, d, d, p, s, p, s}
+	}
+
+	for i := range kinds {
+		if j := i % perTrack; j < len(layout) {
+			kinds[i] = layout[j]
+		}
+	}
+
+	return kinds
+}
+
+// DecodeBlock decodes single block into HCASamplesPerBlock samples per channel, channels are interleaved
+func (d *HCADecoder) DecodeBlock(block []byte) ([]int16, error) {
+	size := int(d.header.BlockSize)
+	if len(block) < size {
+		return nil, fmt.Errorf("block has %d bytes, expected %d", len(block), size)
+	}
+
+	if crc16(block[:size]) != 0 {
+		return nil, errors.New("block checksum mismatch")
+	}
+
+	// don't change caller's data during decryption
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = d.cipher[block[i]]
+	}
+
+	br := bitReader{data: data}
+	if br.read(16) != 0xFFFF {
+		return nil, errors.New("no block sync word")
+	}
+
+	comp := d.header.Comp
+	noiseLevel := br.read(9)
+	evaluationBoundary := br.read(7)
+	packedNoiseLevel := int(noiseLevel<<8) - int(evaluationBoundary)
+
+	for i := range d.channels {
+		ch := &d.channels[i]
+		if err := ch.unpackScalefactors(&br, d.hfrGroupCount, d.header.Version); err != nil {
+			return nil, err
+		}
+		if err := ch.unpackIntensity(&br, d.hfrGroupCount, d.header.Version); err != nil {
+			return nil, err
+		}
+		ch.calculateResolution(packedNoiseLevel, &d.athCurve, comp.MinResolution, comp.MaxResolution)
+		ch.calculateGain()
+	}
+
+	for sf := 0; sf < hcaSubframes; sf++ {
+		for i := range d.channels {
+			d.channels[i].dequantize(&br, sf)
+		}
+
+		for i := range d.channels {
+			ch := &d.channels[i]
+			ch.reconstructNoise(comp.MinResolution, comp.MSStereo, &d.random, sf)
+			ch.reconstructHighFrequency(d.hfrGroupCount, int(comp.BandsPerHFRGroup),
+				int(comp.BaseBandCount)+int(comp.StereoBandCount), int(comp.TotalBandCount), sf)
+		}
+
+		if comp.StereoBandCount > 0 {
+			for i := 0; i+1 < len(d.channels); i++ {
+				applyIntensityStereo(d.channels[i:i+2], sf, int(comp.BaseBandCount), int(comp.TotalBandCount))
+				applyMSStereo(d.channels[i:i+2], comp.MSStereo, sf, int(comp.BaseBandCount), int(comp.TotalBandCount))
+			}
+		}
+
+		for i := range d.channels {
+			d.channels[i].imdct(sf)
+		}
+	}
+
+	// last 16 bits are checksum
+	if br.bit > len(data)*8-16 {
+		return nil, errors.New("block data is longer than block")
+	}
+
+	out := make([]int16, 0, HCASamplesPerBlock*len(d.channels))
+	for sf := 0; sf < hcaSubframes; sf++ {
+		for i := 0; i < hcaSamplesPerSubframe; i++ {
+			for c := range d.channels {
+				out = append(out, toPCM16(d.channels[c].wave[sf][i]))
+			}
+		}
+	}
+
+	return out, nil
+}
+
+func toPCM16(v float64) int16 {
+	s := int(v * 32768)
+	if s > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if s < math.MinInt16 {
+		return math.MinInt16
+	}
+
+	return int16(s)
+}
+
+func (ch *hcaChannel) unpackScalefactors(br *bitReader, hfrGroupCount int, version uint16) error {
+	count := ch.codedCount
+	var extra int
+	// since v3.0 scalefactors of high frequency groups are coded together with the rest
+	if ch.kind != hcaStereoSecondary && hfrGroupCount > 0 && version > 0x200 {
+		extra = hfrGroupCount
+		count += extra
+		if count > hcaSamplesPerSubframe {
+			return errors.New("too many scalefactors")
+		}
+	}
+
+	deltaBits := br.read(3)
+	switch {
+	case deltaBits >= 6:
+		for i := 0; i < count; i++ {
+			ch.scalefactors[i] = byte(br.read(6))
+		}
+	case deltaBits > 0:
+		expected := int(1<<deltaBits) - 1
+		value := int(br.read(6))
+		ch.scalefactors[0] = byte(value)
+		for i := 1; i < count; i++ {
+			delta := int(br.read(int(deltaBits)))
+			if delta == expected {
+				value = int(br.read(6))
+			} else {
+				value += delta - expected>>1
+				if value < 0 || value >= 64 {
+					return errors.New("scalefactor out of range, wrong key?")
+				}
+			}
+			ch.scalefactors[i] = byte(value)
+		}
+	default:
+		ch.scalefactors = [hcaSamplesPerSubframe]byte{}
+	}
+
+	// high frequency scalefactors are kept at the end
+	for i := 0; i < extra; i++ {
+		ch.scalefactors[hcaSamplesPerSubframe-1-i] = ch.scalefactors[count-1-i]
+	}
+
+	return nil
+}
+
+func (ch *hcaChannel) unpackIntensity(br *bitReader, hfrGroupCount int, version uint16) error {
+	if ch.kind != hcaStereoSecondary {
+		// before v3.0 high frequency scalefactors are coded separately
+		if version <= 0x200 {
+			for i := 0; i < hfrGroupCount; i++ {
+				ch.scalefactors[hcaSamplesPerSubframe-hfrGroupCount+i] = byte(br.read(6))
+			}
+		}
+		return nil
+	}
+
+	value := byte(br.peek(4))
+	if version <= 0x200 {
+		ch.intensity[0] = value
+		if value < 15 {
+			br.skip(4)
+			for i := 1; i < hcaSubframes; i++ {
+				ch.intensity[i] = byte(br.read(4))
+			}
+		}
+		return nil
+	}
+
+	br.skip(4)
+	if value >= 15 {
+		for i := range ch.intensity {
+			ch.intensity[i] = 7
+		}
+		return nil
+	}
+
+	ch.intensity[0] = value
+	deltaBits := int(br.read(2))
+	if deltaBits == 3 {
+		for i := 1; i < hcaSubframes; i++ {
+			ch.intensity[i] = byte(br.read(4))
+		}
+		return nil
+	}
+
+	maxDelta := int(2<<deltaBits) - 1
+	v := int(value)
+	for i := 1; i < hcaSubframes; i++ {
+		delta := int(br.read(deltaBits + 1))
+		if delta == maxDelta {
+			v = int(br.read(4))
+		} else {
+			v += delta - maxDelta>>1
+			if v < 0 || v > 15 {
+				return errors.New("intensity out of range, wrong key?")
+			}
+		}
+		ch.intensity[i] = byte(v)
+	}
+
+	return nil
+}
+
+func (ch *hcaChannel) calculateResolution(packedNoiseLevel int, athCurve *[hcaSamplesPerSubframe]byte, minRes, maxRes byte) {
+	var noiseCount, validCount int
+
+	for i := 0; i < ch.codedCount; i++ {
+		var resolution byte
+		scalefactor := int(ch.scalefactors[i])
+
+		if scalefactor > 0 {
+			noiseLevel := int(athCurve[i]) + (packedNoiseLevel+i)>>8
+			position := noiseLevel + 1 - (5*scalefactor)>>1
+
+			switch {
+			case position < 0:
+				resolution = 15
+			case position < len(hcaInvertTable):
+				resolution = hcaInvertTable[position]
+			}
+
+			if resolution > maxRes {
+				resolution = maxRes
+			} else if resolution < minRes {
+				resolution = minRes
+			}
+
+			if resolution < 1 {
+				ch.noises[noiseCount] = byte(i)
+				noiseCount++
+			} else {
+				ch.noises[hcaSamplesPerSubframe-1-validCount] = byte(i)
+				validCount++
+			}
+		}
+
+		ch.resolution[i] = resolution
+	}
+
+	for i := ch.codedCount; i < hcaSamplesPerSubframe; i++ {
+		ch.resolution[i] = 0
+	}
+
+	ch.noiseCount, ch.validCount = noiseCount, validCount
+}
+
+func (ch *hcaChannel) calculateGain() {
+	for i := 0; i < ch.codedCount; i++ {
+		ch.gain[i] = hcaDequantizerScaling[ch.scalefactors[i]] * hcaQuantizerStep[ch.resolution[i]]
+	}
+}
+
+func (ch *hcaChannel) dequantize(br *bitReader, sf int) {
+	for i := 0; i < ch.codedCount; i++ {
+		resolution := ch.resolution[i]
+		bits := int(hcaMaxBits[resolution])
+		code := br.read(bits)
+
+		var value float64
+		if resolution > 7 {
+			// sign-magnitude, lowest bit is sign, zero doesn't have it
+			magnitude := int(code >> 1)
+			if code&1 != 0 {
+				magnitude = -magnitude
+			}
+			if magnitude == 0 {
+				br.skip(-1)
+			}
+			value = float64(magnitude)
+		} else {
+			br.skip(int(hcaReadBits[resolution][code]) - bits)
+			value = float64(hcaReadValues[resolution][code])
+		}
+
+		ch.spectra[sf][i] = ch.gain[i] * value
+	}
+
+	for i := ch.codedCount; i < hcaSamplesPerSubframe; i++ {
+		ch.spectra[sf][i] = 0
+	}
+}
+
+// reconstructNoise fills bands without data using random bands with data
+func (ch *hcaChannel) reconstructNoise(minRes, msStereo byte, random *uint32, sf int) {
+	if minRes > 0 || ch.validCount == 0 || ch.noiseCount == 0 {
+		return
+	}
+
+	if msStereo != 0 && ch.kind != hcaStereoPrimary {
+		return
+	}
+
+	r := *random
+	for i := 0; i < ch.noiseCount; i++ {
+		r = 0x343FD*r + 0x269EC3
+
+		randomIndex := hcaSamplesPerSubframe - ch.validCount + int((r&0x7FFF)*uint32(ch.validCount)>>15)
+		noiseIndex := ch.noises[i]
+		validIndex := ch.noises[randomIndex]
+
+		index := int(ch.scalefactors[noiseIndex]) - int(ch.scalefactors[validIndex]) + 62
+		if index < 0 {
+			index = 0
+		}
+
+		ch.spectra[sf][noiseIndex] = hcaScaleConversion[index] * ch.spectra[sf][validIndex]
+	}
+	*random = r
+}
+
+// reconstructHighFrequency mirrors lower bands into bands above coded ones
+func (ch *hcaChannel) reconstructHighFrequency(hfrGroupCount, bandsPerGroup, startBand, totalBands, sf int) {
+	if bandsPerGroup == 0 || ch.kind == hcaStereoSecondary {
+		return
+	}
+
+	spectra := &ch.spectra[sf]
+	scales := ch.scalefactors[hcaSamplesPerSubframe-hfrGroupCount:]
+	high, low := startBand, startBand-1
+	for group := 0; group < hfrGroupCount; group++ {
+		for i := 0; i < bandsPerGroup && high < totalBands && low >= 0; i++ {
+			index := int(scales[group]) - int(ch.scalefactors[low]) + 63
+			if index < 0 {
+				index = 0
+			} else if index > 127 {
+				index = 127
+			}
+
+			spectra[high] = hcaScaleConversion[index] * spectra[low]
+			high++
+			low--
+		}
+	}
+
+	if high > 0 {
+		spectra[high-1] = 0
+	}
+}
+
+func applyIntensityStereo(pair []hcaChannel, sf, baseBands, totalBands int) {
+	if pair[0].kind != hcaStereoPrimary {
+		return
+	}
+
+	ratioL := hcaIntensityRatio[pair[1].intensity[sf]]
+	ratioR := 2 - ratioL
+	left, right := &pair[0].spectra[sf], &pair[1].spectra[sf]
+	for band := baseBands; band < totalBands; band++ {
+		left[band], right[band] = left[band]*ratioL, left[band]*ratioR
+	}
+}
+
+func applyMSStereo(pair []hcaChannel, msStereo byte, sf, baseBands, totalBands int) {
+	if msStereo == 0 || pair[0].kind != hcaStereoPrimary {
+		return
+	}
+
+	left, right := &pair[0].spectra[sf], &pair[1].spectra[sf]
+	for band := baseBands; band < totalBands; band++ {
+		l, r := left[band], right[band]
+		left[band], right[band] = (l+r)*math.Sqrt2/2, (l-r)*math.Sqrt2/2
+	}
+}
+
+// imdct turns spectra of subframe into samples, overlapping them with previous subframe
+func (ch *hcaChannel) imdct(sf int) {
+	const half = hcaSamplesPerSubframe / 2
+
+	var dct [hcaSamplesPerSubframe]float64
+	dst4(ch.spectra[sf][:], dct[:])
+
+	w := &hcaWindow
+	for i := 0; i < half; i++ {
+		ch.wave[sf][i] = w[i]*dct[i+half] + ch.previous[i]
+		ch.wave[sf][i+half] = w[i+half]*dct[hcaSamplesPerSubframe-1-i] - ch.previous[i+half]
+		ch.previous[i] = w[hcaSamplesPerSubframe-1-i] * dct[half-1-i]
+		ch.previous[i+half] = w[half-1-i] * dct[i]
+	}
+}
+
+// dst4 is orthonormal DST-IV of 128 values, it's inverse of itself.
+// Together with the way halves are overlapped in imdct it gives MDCT with continuous basis
+func dst4(in, out []float64) {
+	for k := range out {
+		var sum float64
+		for n, v := range in {
+			sum += v * hcaSinTable[k][n]
+		}
+		out[k] = sum
+	}
+}
+
+// bitReader reads big-endian bit fields, reading past the end gives zeroes
+type bitReader struct {
+	data []byte
+	bit  int
+}
+
+func (r *bitReader) peek(n int) uint32 {
+	if r.bit+n > len(r.data)*8 {
+		return 0
+	}
+
+	var v uint32
+	for i := r.bit; i < r.bit+n; i++ {
+		v = v<<1 | uint32(r.data[i>>3]>>(7-(i&7))&1)
+	}
+
+	return v
+}
+
+func (r *bitReader) read(n int) uint32 {
+	v := r.peek(n)
+	r.bit += n
+
+	return v
+}
+
+func (r *bitReader) skip(n int) {
+	r.bit += n
+}
+
+// hcaCipherTable makes table which maps encrypted bytes to decrypted ones
+func hcaCipherTable(cipherType uint16, key uint64) (table [256]byte, err error) {
+	switch cipherType {
+	case 0:
+		for i := range table {
+			table[i] = byte(i)
+		}
+	case 1:
+		var v int
+		for i := 1; i < 255; i++ {
+			v = (v*13 + 11) & 0xFF
+			if v == 0 || v == 0xFF {
+				v = (v*13 + 11) & 0xFF
+			}
+			table[i] = byte(v)
+		}
+		table[0], table[0xFF] = 0, 0xFF
+	case 56:
+		if key == 0 {
+			return table, errors.New("stream is encrypted, key is required")
+		}
+		table = hcaKeyTable(key)
+	default:
+		return table, fmt.Errorf("unknown cipher type %d", cipherType)
+	}
+
+	return table, nil
+}
+
+// hcaKeyTable makes decryption table from 56-bit key
+func hcaKeyTable(key uint64) (table [256]byte) {
+	key--
+
+	var kc [7]byte
+	for i := range kc {
+		kc[i] = byte(key)
+		key >>= 8
+	}
+
+	seed := [16]byte{
+		kc[1], kc[1] ^ kc[6], kc[2] ^ kc[3], kc[2],
+		kc[2] ^ kc[1], kc[3] ^ kc[4], kc[3], kc[3] ^ kc[2],
+		kc[4] ^ kc[5], kc[4], kc[4] ^ kc[3], kc[5] ^ kc[6],
+		kc[5], kc[5] ^ kc[4], kc[6] ^ kc[1], kc[6],
+	}
+
+	var base [256]byte
+	rows := hcaNibbleTable(kc[0])
+	for r := 0; r < 16; r++ {
+		cols := hcaNibbleTable(seed[r])
+		for c := 0; c < 16; c++ {
+			base[r*16+c] = rows[r]<<4 | cols[c]
+		}
+	}
+
+	var x byte
+	pos := 1
+	for i := 0; i < 256; i++ {
+		x += 17
+		if base[x] != 0 && base[x] != 0xFF {
+			table[pos] = base[x]
+			pos++
+		}
+	}
+	table[0], table[0xFF] = 0, 0xFF
+
+	return table
+}
+
+func hcaNibbleTable(key byte) (table [16]byte) {
+	mul := (key&1)<<3 | 5
+	add := key&0xE | 1
+
+	key >>= 4
+	for i := range table {
+		key = (key*mul + add) & 0xF
+		table[i] = key
+	}
+
+	return table
+}
@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDST4(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	var in, transformed, out [hcaSamplesPerSubframe]float64
+	for i := range in {
+		in[i] = r.Float64()*2 - 1
+	}
+
+	dst4(in[:], transformed[:])
+	dst4(transformed[:], out[:])
+
+	// orthonormal transform keeps energy and is inverse of itself
+	var inEnergy, transformedEnergy float64
+	for i := range in {
+		inEnergy += in[i] * in[i]
+		transformedEnergy += transformed[i] * transformed[i]
+		if math.Abs(out[i]-in[i]) > 1e-9 {
+			t.Fatalf("value %d: got %g, expected %g", i, out[i], in[i])
+		}
+	}
+	if math.Abs(inEnergy-transformedEnergy) > 1e-9 {
+		t.Fatalf("energy changed from %g to %g", inEnergy, transformedEnergy)
+	}
+}
+
+func TestMDCTReconstruction(t *testing.T) {
+	const blocks = 3
+	r := rand.New(rand.NewSource(1))
+
+	input := make([]float64, blocks*HCASamplesPerBlock)
+	for i := range input {
+		input[i] = r.Float64()*2 - 1
+	}
+
+	// output of overlapping transform is delayed by one subframe
+	var ch hcaEncoderChannel
+	output := make([]float64, 0, len(input))
+	for block := 0; block < blocks; block++ {
+		ch.analyze(input[block*HCASamplesPerBlock : (block+1)*HCASamplesPerBlock])
+		for sf := 0; sf < hcaSubframes; sf++ {
+			ch.imdct(sf)
+			output = append(output, ch.wave[sf][:]...)
+		}
+	}
+
+	for i := hcaEncoderDelay; i < len(output); i++ {
+		if math.Abs(output[i]-input[i-hcaEncoderDelay]) > 1e-9 {
+			t.Fatalf("sample %d: got %g, expected %g", i, output[i], input[i-hcaEncoderDelay])
+		}
+	}
+}
+
+func TestATHCurve(t *testing.T) {
+	tests := []struct {
+		sampleRate int
+		// first band past the end of base curve, it and everything above is inaudible
+		cutoff int
+	}{
+		{sampleRate: 44100, cutoff: 121},
+		{sampleRate: 48000, cutoff: 111},
+		{sampleRate: 16000, cutoff: hcaSamplesPerSubframe},
+	}
+
+	for _, tt := range tests {
+		curve := hcaATHCurve(tt.sampleRate)
+
+		acc := 0
+		for i, v := range curve {
+			acc += tt.sampleRate
+			if i >= tt.cutoff {
+				if v != 0xFF {
+					t.Fatalf("%d Hz: band %d is %#x, expected 0xFF", tt.sampleRate, i, v)
+				}
+				continue
+			}
+
+			if expected := hcaATHBaseCurve[acc>>13]; v != expected {
+				t.Fatalf("%d Hz: band %d is %#x, expected %#x", tt.sampleRate, i, v, expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,512 @@
+package parser
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// HCAQualities maps quality names to bitrate of a single channel
+var HCAQualities = map[string]int{
+	"highest": 128000,
+	"high":    96000,
+	"middle":  64000,
+	"low":     48000,
+	"lowest":  32000,
+}
+
+// AudioEncodeOptions configures audio encoding, it's used only for HCA
+type AudioEncodeOptions struct {
+	// bits per second of all channels, overrides quality
+	Bitrate int
+	// one of HCAQualities, "high" is used if both quality and bitrate aren't set
+	Quality string
+	// 56-bit key for encryption, 0 means no encryption
+	Key uint64
+}
+
+const (
+	// samples are delayed by one subframe because of overlapping transform
+	hcaEncoderDelay = hcaSamplesPerSubframe
+	hcaHeaderSize   = 0x60
+	// samples below this level are silence in 16 bits
+	hcaSilenceLevel = 1.0 / (1 << 16)
+)
+
+type hcaEncoderChannel struct {
+	hcaChannel
+	// input of the previous subframe, first half of the next transform
+	history [hcaSamplesPerSubframe]float64
+	// scalefactors picked by analysis, quiet bands are dropped from them depending on noise level
+	scales [hcaSamplesPerSubframe]byte
+	// quantized coefficients
+	quantized [hcaSubframes][hcaSamplesPerSubframe]int
+}
+
+// EncodeHCA encodes audio into HCA header and blocks
+func EncodeHCA(wav *WAVAudio, opts AudioEncodeOptions) ([]byte, [][]byte, error) {
+	if wav.Channels <= 0 || wav.Channels > 16 || wav.SampleRate <= 0 || wav.SampleRate > 0xFFFFFF {
+		return nil, nil, fmt.Errorf("bad format: %d channels, %d Hz", wav.Channels, wav.SampleRate)
+	}
+
+	bitrate := opts.Bitrate
+	if bitrate == 0 {
+		quality := opts.Quality
+		if quality == "" {
+			quality = "high"
+		}
+
+		perChannel, ok := HCAQualities[quality]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown quality %s", quality)
+		}
+		bitrate = perChannel * wav.Channels
+	}
+
+	blockSize := bitrate * HCASamplesPerBlock / 8 / wav.SampleRate
+	if blockSize > 0xFFFF {
+		blockSize = 0xFFFF
+	}
+
+	// every channel needs at least a few bytes for its scalefactors
+	if blockSize < 8+wav.Channels*16 {
+		return nil, nil, fmt.Errorf("bitrate %d is too low", bitrate)
+	}
+
+	// bits available for every channel, without sync, noise level and checksum
+	channelBits := (blockSize*8 - 16 - 16 - 16) / wav.Channels
+	// leave room for at least 1 bit per coefficient and scalefactors, higher bands are cut at low bitrates
+	bands := channelBits * 3 / 4 / (hcaSubframes + 3)
+	if bands > hcaSamplesPerSubframe {
+		bands = hcaSamplesPerSubframe
+	}
+
+	total := wav.Len()
+	blocks := (total + hcaEncoderDelay + HCASamplesPerBlock - 1) / HCASamplesPerBlock
+
+	h := HCAHeader{
+		Version:        0x200,
+		HeaderSize:     hcaHeaderSize,
+		Channels:       wav.Channels,
+		SampleRate:     wav.SampleRate,
+		BlockCount:     uint32(blocks),
+		EncoderDelay:   hcaEncoderDelay,
+		EncoderPadding: uint16(blocks*HCASamplesPerBlock - total - hcaEncoderDelay),
+		BlockSize:      uint16(blockSize),
+		Comp: HCACompParams{
+			MinResolution:  1,
+			MaxResolution:  15,
+			TrackCount:     1,
+			TotalBandCount: byte(bands),
+			BaseBandCount:  byte(bands),
+		},
+	}
+
+	// encryption table maps plain bytes to encrypted ones
+	var cipher [256]byte
+	for i := range cipher {
+		cipher[i] = byte(i)
+	}
+	if opts.Key != 0 {
+		h.CipherType = 56
+		for i, v := range hcaKeyTable(opts.Key) {
+			cipher[v] = byte(i)
+		}
+	}
+
+	header := writeHCAHeader(h)
+
+	channels := make([]hcaEncoderChannel, wav.Channels)
+	for i := range channels {
+		channels[i].codedCount = bands
+	}
+
+	result := make([][]byte, 0, blocks)
+	var input [hcaSubframes * hcaSamplesPerSubframe]float64
+	for block := 0; block < blocks; block++ {
+		for c := range channels {
+			for i := range input {
+				pos := block*HCASamplesPerBlock + i
+				if pos < total {
+					input[i] = float64(wav.Samples[pos*wav.Channels+c]) / 32768
+				} else {
+					input[i] = 0
+				}
+			}
+
+			channels[c].analyze(input[:])
+		}
+
+		data, err := encodeHCABlock(channels, blockSize)
+		if err != nil {
+			return nil, nil, fmt.Errorf("can't encode block %d: %w", block, err)
+		}
+
+		for i := 0; i < len(data)-2; i++ {
+			data[i] = cipher[data[i]]
+		}
+		binary.BigEndian.PutUint16(data[len(data)-2:], crc16(data[:len(data)-2]))
+
+		result = append(result, data)
+	}
+
+	return header, result, nil
+}
+
+// writeHCAHeader makes header with fmt, comp and ciph sections
+func writeHCAHeader(h HCAHeader) []byte {
+	b := make([]byte, 0, h.HeaderSize)
+	b = append(b, HCA_[:]...)
+	b = append(b, byte(h.Version>>8), byte(h.Version), byte(h.HeaderSize>>8), byte(h.HeaderSize))
+
+	b = append(b, hcaFmt[:]...)
+	b = append(b, byte(h.Channels), byte(h.SampleRate>>16), byte(h.SampleRate>>8), byte(h.SampleRate))
+	b = append(b, byte(h.BlockCount>>24), byte(h.BlockCount>>16), byte(h.BlockCount>>8), byte(h.BlockCount))
+	b = append(b, byte(h.EncoderDelay>>8), byte(h.EncoderDelay), byte(h.EncoderPadding>>8), byte(h.EncoderPadding))
+
+	comp := h.Comp
+	b = append(b, hcaComp[:]...)
+	b = append(b, byte(h.BlockSize>>8), byte(h.BlockSize),
+		comp.MinResolution, comp.MaxResolution, comp.TrackCount, comp.ChannelConfig,
+		comp.TotalBandCount, comp.BaseBandCount, comp.StereoBandCount, comp.BandsPerHFRGroup,
+		comp.MSStereo, 0)
+
+	b = append(b, hcaCiph[:]...)
+	b = append(b, byte(h.CipherType>>8), byte(h.CipherType))
+
+	// rest of the header is padding
+	b = append(b, hcaPad[:]...)
+	b = append(b, make([]byte, int(h.HeaderSize)-2-len(b))...)
+
+	crc := crc16(b)
+
+	return append(b, byte(crc>>8), byte(crc))
+}
+
+// analyze transforms block of samples into spectra of 8 subframes and picks scalefactors
+func (ch *hcaEncoderChannel) analyze(input []float64) {
+	const n = hcaSamplesPerSubframe
+
+	for sf := 0; sf < hcaSubframes; sf++ {
+		current := input[sf*n : (sf+1)*n]
+
+		// windowed block of previous and current subframe, folded for DST-IV
+		var x [2 * n]float64
+		for i := 0; i < n; i++ {
+			x[i] = ch.history[i] * hcaWindow[i]
+			x[n+i] = current[i] * hcaWindow[n-1-i]
+		}
+
+		var folded [n]float64
+		for j := n / 2; j < n; j++ {
+			folded[j] = x[j-n/2] + x[3*n/2-1-j]
+		}
+		for j := 0; j < n/2; j++ {
+			folded[j] = x[3*n/2-1-j] - x[3*n/2+j]
+		}
+
+		dst4(folded[:], ch.spectra[sf][:])
+		copy(ch.history[:], current)
+	}
+
+	for i := 0; i < hcaSamplesPerSubframe; i++ {
+		ch.scales[i] = 0
+		if i >= ch.codedCount {
+			continue
+		}
+
+		var peak float64
+		for sf := 0; sf < hcaSubframes; sf++ {
+			peak = math.Max(peak, math.Abs(ch.spectra[sf][i]))
+		}
+
+		if peak < hcaSilenceLevel {
+			continue
+		}
+
+		scale := byte(1)
+		for scale < 63 && hcaDequantizerScaling[scale] < peak {
+			scale++
+		}
+		ch.scales[i] = scale
+	}
+}
+
+// quantize calculates resolutions for noise level and returns number of bits the channel takes
+func (ch *hcaEncoderChannel) quantize(packedNoiseLevel int) int {
+	var zeroCurve [hcaSamplesPerSubframe]byte
+
+	// bands below noise level would get zero resolution, but minimal resolution is 1,
+	// so they are dropped instead of wasting bits
+	ch.scalefactors = ch.scales
+	ch.calculateResolution(packedNoiseLevel, &zeroCurve, 0, 15)
+	for i := 0; i < ch.codedCount; i++ {
+		if ch.resolution[i] == 0 {
+			ch.scalefactors[i] = 0
+		}
+	}
+
+	ch.calculateResolution(packedNoiseLevel, &zeroCurve, 1, 15)
+	ch.calculateGain()
+
+	_, bits := ch.scalefactorCoding()
+	for i := 0; i < ch.codedCount; i++ {
+		resolution := ch.resolution[i]
+		if resolution == 0 {
+			for sf := range ch.quantized {
+				ch.quantized[sf][i] = 0
+			}
+			continue
+		}
+
+		limit := hcaMaxValues[resolution]
+		for sf := range ch.quantized {
+			q := int(math.Round(ch.spectra[sf][i] / ch.gain[i]))
+			if q > limit {
+				q = limit
+			} else if q < -limit {
+				q = -limit
+			}
+
+			ch.quantized[sf][i] = q
+			_, n := hcaCode(resolution, q)
+			bits += n
+		}
+	}
+
+	return bits
+}
+
+// scalefactorCoding picks the shortest way to code scalefactors, returns delta bits and total size
+func (ch *hcaEncoderChannel) scalefactorCoding() (int, int) {
+	count := ch.codedCount
+
+	allZero := true
+	for _, s := range ch.scalefactors[:count] {
+		if s != 0 {
+			allZero = false
+			break
+		}
+	}
+	if allZero {
+		return 0, 3
+	}
+
+	bestBits, bestSize := 6, 3+6*count
+	for deltaBits := 1; deltaBits < 6; deltaBits++ {
+		expected := 1<<deltaBits - 1
+		size := 3 + 6
+		for i := 1; i < count; i++ {
+			delta := int(ch.scalefactors[i]) - int(ch.scalefactors[i-1]) + expected>>1
+			if delta >= 0 && delta < expected {
+				size += deltaBits
+			} else {
+				size += deltaBits + 6
+			}
+		}
+
+		if size < bestSize {
+			bestBits, bestSize = deltaBits, size
+		}
+	}
+
+	return bestBits, bestSize
+}
+
+func (ch *hcaEncoderChannel) writeScalefactors(w *bitWriter, deltaBits int) {
+	w.write(uint32(deltaBits), 3)
+
+	switch {
+	case deltaBits == 0:
+	case deltaBits >= 6:
+		for _, s := range ch.scalefactors[:ch.codedCount] {
+			w.write(uint32(s), 6)
+		}
+	default:
+		expected := 1<<deltaBits - 1
+		w.write(uint32(ch.scalefactors[0]), 6)
+		for i := 1; i < ch.codedCount; i++ {
+			delta := int(ch.scalefactors[i]) - int(ch.scalefactors[i-1]) + expected>>1
+			if delta >= 0 && delta < expected {
+				w.write(uint32(delta), deltaBits)
+			} else {
+				w.write(uint32(expected), deltaBits)
+				w.write(uint32(ch.scalefactors[i]), 6)
+			}
+		}
+	}
+}
+
+// encodeHCABlock picks the lowest noise level which fits into the block and writes it.
+// Checksum is left empty
+func encodeHCABlock(channels []hcaEncoderChannel, blockSize int) ([]byte, error) {
+	budget := blockSize*8 - 16 - 16 - 16
+
+	for {
+		cost := func(level int) int {
+			var bits int
+			for c := range channels {
+				bits += channels[c].quantize(level)
+			}
+			return bits
+		}
+
+		// noise level is coded as level<<8 - boundary with boundary up to 127,
+		// so only some values can be used, k-th of them goes in increasing order
+		levelOf := func(k int) (int, int) {
+			noise, boundary := k/128, 127-k%128
+			return noise<<8 - boundary, noise
+		}
+
+		lo, hi := 0, 512*128-1
+		if last, _ := levelOf(hi); cost(last) <= budget {
+			for lo < hi {
+				mid := (lo + hi) / 2
+				if level, _ := levelOf(mid); cost(level) <= budget {
+					hi = mid
+				} else {
+					lo = mid + 1
+				}
+			}
+
+			level, noise := levelOf(lo)
+			cost(level)
+
+			// bands quantized to zeroes only waste bits, drop them and try to give these bits to others
+			if dropSilentBands(channels) {
+				continue
+			}
+
+			return writeHCABlock(channels, blockSize, noise, noise<<8-level), nil
+		}
+
+		// doesn't fit even with the lowest resolutions, drop the highest coded band
+		dropped := false
+		for c := range channels {
+			ch := &channels[c]
+			for i := ch.codedCount - 1; i >= 0; i-- {
+				if ch.scales[i] != 0 {
+					ch.scales[i] = 0
+					dropped = true
+					break
+				}
+			}
+		}
+
+		if !dropped {
+			return nil, errors.New("block is too small")
+		}
+	}
+}
+
+// dropSilentBands clears scalefactors of bands with all coefficients quantized to zero
+func dropSilentBands(channels []hcaEncoderChannel) bool {
+	var dropped bool
+	for c := range channels {
+		ch := &channels[c]
+		for i := 0; i < ch.codedCount; i++ {
+			if ch.scalefactors[i] == 0 {
+				continue
+			}
+
+			silent := true
+			for sf := range ch.quantized {
+				if ch.quantized[sf][i] != 0 {
+					silent = false
+					break
+				}
+			}
+
+			if silent {
+				ch.scales[i] = 0
+				dropped = true
+			}
+		}
+	}
+
+	return dropped
+}
+
+func writeHCABlock(channels []hcaEncoderChannel, blockSize, noise, boundary int) []byte {
+	w := bitWriter{data: make([]byte, blockSize)}
+	w.write(0xFFFF, 16)
+	w.write(uint32(noise), 9)
+	w.write(uint32(boundary), 7)
+
+	for c := range channels {
+		deltaBits, _ := channels[c].scalefactorCoding()
+		channels[c].writeScalefactors(&w, deltaBits)
+	}
+
+	for sf := 0; sf < hcaSubframes; sf++ {
+		for c := range channels {
+			ch := &channels[c]
+			for i := 0; i < ch.codedCount; i++ {
+				if ch.resolution[i] == 0 {
+					continue
+				}
+
+				code, n := hcaCode(ch.resolution[i], ch.quantized[sf][i])
+				w.write(code, n)
+			}
+		}
+	}
+
+	return w.data
+}
+
+// hcaMaxValues is the biggest quantized value of every resolution
+var hcaMaxValues = [16]int{0, 1, 2, 3, 4, 5, 6, 7, 15, 31, 63, 127, 255, 511, 1023, 2047}
+
+// hcaCodes maps quantized values of resolutions up to 7 to their prefix codes
+var hcaCodes = func() (table [8]map[int][2]int) {
+	for resolution := 1; resolution < 8; resolution++ {
+		table[resolution] = make(map[int][2]int)
+		maxBits := int(hcaMaxBits[resolution])
+		for code := 0; code < 1<<maxBits; code++ {
+			value := int(hcaReadValues[resolution][code])
+			bits := int(hcaReadBits[resolution][code])
+			if _, ok := table[resolution][value]; !ok {
+				table[resolution][value] = [2]int{code >> (maxBits - bits), bits}
+			}
+		}
+	}
+
+	return table
+}()
+
+// hcaCode returns code of quantized value and its size in bits
+func hcaCode(resolution byte, value int) (uint32, int) {
+	if resolution < 8 {
+		c := hcaCodes[resolution][value]
+		return uint32(c[0]), c[1]
+	}
+
+	bits := int(hcaMaxBits[resolution])
+	if value == 0 {
+		// zero doesn't have sign bit
+		return 0, bits - 1
+	}
+
+	if value < 0 {
+		return uint32(-value<<1 | 1), bits
+	}
+
+	return uint32(value << 1), bits
+}
+
+// bitWriter writes big-endian bit fields into fixed buffer
+type bitWriter struct {
+	data []byte
+	bit  int
+}
+
+func (w *bitWriter) write(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if v>>i&1 != 0 {
+			w.data[w.bit>>3] |= 0x80 >> (w.bit & 7)
+		}
+		w.bit++
+	}
+}
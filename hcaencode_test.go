@@ -0,0 +1,131 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+// decodeHCABlocks decodes all blocks and drops encoder delay and padding
+func decodeHCABlocks(t *testing.T, header []byte, blocks [][]byte, key uint64) (HCAHeader, []int16) {
+	t.Helper()
+
+	h, err := ParseHCAHeader(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewHCADecoder(h, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var samples []int16
+	for i, block := range blocks {
+		decoded, err := d.DecodeBlock(block)
+		if err != nil {
+			t.Fatalf("block %d: %v", i, err)
+		}
+		samples = append(samples, decoded...)
+	}
+
+	start := int(h.EncoderDelay) * h.Channels
+	return h, samples[start : start+int(h.Samples())*h.Channels]
+}
+
+func TestHCARoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		wav    WAVAudio
+		opts   AudioEncodeOptions
+		minSNR float64
+	}{
+		{
+			name:   "mono",
+			wav:    WAVAudio{SampleRate: 44100, Channels: 1, Samples: testTone(44100, 1, 5000)},
+			minSNR: 35,
+		},
+		{
+			name:   "stereo, highest quality",
+			wav:    WAVAudio{SampleRate: 48000, Channels: 2, Samples: testTone(48000, 2, 3000)},
+			opts:   AudioEncodeOptions{Quality: "highest"},
+			minSNR: 45,
+		},
+		{
+			name:   "exact bitrate",
+			wav:    WAVAudio{SampleRate: 48000, Channels: 2, Samples: testTone(48000, 2, 2048)},
+			opts:   AudioEncodeOptions{Bitrate: 128000},
+			minSNR: 35,
+		},
+		{
+			name:   "encrypted",
+			wav:    WAVAudio{SampleRate: 48000, Channels: 2, Samples: testTone(48000, 2, 3000)},
+			opts:   AudioEncodeOptions{Key: 0x0123456789ABCD},
+			minSNR: 40,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, blocks, err := EncodeHCA(&tt.wav, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			h, samples := decodeHCABlocks(t, header, blocks, tt.opts.Key)
+			if h.Encrypted() != (tt.opts.Key != 0) {
+				t.Fatalf("cipher type %d", h.CipherType)
+			}
+			if int(h.BlockCount) != len(blocks) || int(h.Samples()) != tt.wav.Len() {
+				t.Fatalf("header has %d blocks and %d samples, encoded %d blocks of %d samples",
+					h.BlockCount, h.Samples(), len(blocks), tt.wav.Len())
+			}
+
+			if ratio := snr(tt.wav.Samples, samples); ratio < tt.minSNR {
+				t.Fatalf("SNR is %.1f dB", ratio)
+			}
+		})
+	}
+}
+
+func TestHCAEncryption(t *testing.T) {
+	const key = 0x0123456789ABCD
+	wav := WAVAudio{SampleRate: 48000, Channels: 2, Samples: testTone(48000, 2, 3000)}
+
+	plainHeader, plainBlocks, err := EncodeHCA(&wav, AudioEncodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, blocks, err := EncodeHCA(&wav, AudioEncodeOptions{Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(plainBlocks[0], blocks[0]) {
+		t.Fatal("block isn't encrypted")
+	}
+
+	_, plain := decodeHCABlocks(t, plainHeader, plainBlocks, 0)
+	_, decrypted := decodeHCABlocks(t, header, blocks, key)
+	if !equalSamples(plain, decrypted) {
+		t.Fatal("decrypted samples differ from unencrypted stream")
+	}
+
+	h, err := ParseHCAHeader(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewHCADecoder(h, 0); err == nil {
+		t.Fatal("expected error without key")
+	}
+
+	d, err := NewHCADecoder(h, key+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range blocks {
+		if _, err = d.DecodeBlock(block); err != nil {
+			return
+		}
+	}
+	t.Fatal("blocks decrypted with wrong key have no errors")
+}
@@ -0,0 +1,156 @@
+package parser
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// testTone makes interleaved samples of sines with different frequency in every channel
+func testTone(sampleRate, channels, samples int) []int16 {
+	result := make([]int16, samples*channels)
+	for i := 0; i < samples; i++ {
+		for c := 0; c < channels; c++ {
+			t := float64(i) / float64(sampleRate)
+			v := 0.4*math.Sin(2*math.Pi*440*float64(c+1)*t) + 0.2*math.Sin(2*math.Pi*1250*t)
+			result[i*channels+c] = int16(v * 32767)
+		}
+	}
+
+	return result
+}
+
+// snr returns signal to noise ratio of decoded samples in dB
+func snr(original, decoded []int16) float64 {
+	var signal, noise float64
+	for i, v := range original {
+		d := float64(v) - float64(decoded[i])
+		signal += float64(v) * float64(v)
+		noise += d * d
+	}
+
+	if noise == 0 {
+		return math.Inf(1)
+	}
+
+	return 10 * math.Log10(signal/noise)
+}
+
+func equalSamples(a, b []int16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+const (
+	testFrames        = 60
+	testKeyframeEvery = 10
+	// frame rate is fps multiplied by 100, so every frame adds 100 to frame time
+	testFrameRate  = 3000
+	testFrameTicks = 100
+	testSampleRate = 48000
+	testSamples    = 2 * testSampleRate
+)
+
+// tableEntry makes unique numeric entry of @UTF table
+func tableEntry(key string, valueType byte, v uint64) Entry {
+	e := Entry{Key: key, Type: values[valueType]}
+	setUint(&e, v)
+	return e
+}
+
+// testMovie makes 2 seconds of 30 fps H.264 video with keyframe every 10 frames and mono HCA audio of the same length
+func testMovie(t *testing.T) *USMInfo {
+	t.Helper()
+
+	s := &USMInfo{HDRInfo: make(map[[4]byte]Chunk), Metadata: make(map[[4]byte]Chunk)}
+
+	for i := 0; i < testFrames; i++ {
+		// slice NAL units, IDR ones are keyframes
+		payload := []byte{0, 0, 1, 0x41, byte(i)}
+		if i%testKeyframeEvery == 0 {
+			payload[3] = 0x65
+		}
+		s.VideoStreams = append(s.VideoStreams, makeStreamChunk(_SFV, 0, int32(i*testFrameTicks), testFrameRate, payload))
+	}
+
+	header := func(id [4]byte) Chunk {
+		return Chunk{
+			Header: Header{ID: id},
+			Data:   Data{PayloadHeader: PayloadHeader{Offset: 0x18, PayloadType: PayloadTypeHeader, FrameRate: 0x1e}},
+		}
+	}
+
+	var err error
+	s.HDRInfo[_SFV], err = makeTableChunk(header(_SFV), "VIDEO_HDRINFO", [][]Entry{{
+		tableEntry("width", 0x15, 64),
+		tableEntry("height", 0x15, 32),
+		tableEntry("total_frames", 0x15, testFrames),
+		tableEntry("framerate_n", 0x15, 30000),
+		tableEntry("framerate_d", 0x15, 1000),
+		tableEntry("mpeg_codec", 0x11, videoCodecH264),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wav := WAVAudio{SampleRate: testSampleRate, Channels: 1, Samples: testTone(testSampleRate, 1, testSamples)}
+	hca, blocks, err := EncodeHCA(&wav, AudioEncodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AudioStreams = makeAudioChunks(hca, blocks, HCASamplesPerBlock, testSampleRate, 0, 2997)
+
+	if s.HDRInfo[_SFA], err = s.audioHeaderInfo(audioCodecHCA, testSampleRate, 1, testSamples); err != nil {
+		t.Fatal(err)
+	}
+
+	crid := func(name string, id [4]byte, channel uint64) []Entry {
+		return []Entry{
+			{Key: "filename", Type: values[0x1A], Value: []byte(name)},
+			tableEntry("filesize", 0x15, 0),
+			tableEntry("stmid", 0x15, uint64(binary.BigEndian.Uint32(id[:]))),
+			tableEntry("chno", 0x13, channel),
+			tableEntry("avbps", 0x15, 0),
+		}
+	}
+	s.CRID, err = makeTableChunk(header(CRID), "CRIUSF_DIR_STREAM", [][]Entry{
+		crid("test.usm", [4]byte{}, 0xFFFF),
+		crid("test.264", _SFV, 0),
+		crid("test.hca", _SFA, 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// checkFrames checks that video has frames of the source starting from first, with frame times starting from zero
+func checkFrames(t *testing.T, s *USMInfo, first, count int) {
+	t.Helper()
+
+	if n := countFrames(s.VideoStreams); n != count {
+		t.Fatalf("got %d frames, expected %d", n, count)
+	}
+	if n := s.headerValue(_SFV, "total_frames"); n != uint64(count) {
+		t.Fatalf("total_frames is %d, expected %d", n, count)
+	}
+
+	for i, c := range s.VideoStreams {
+		if ft := c.Data.PayloadHeader.FrameTime; ft != int32(i*testFrameTicks) {
+			t.Fatalf("frame %d has frame time %d, expected %d", i, ft, i*testFrameTicks)
+		}
+		if c.Data.Payload[4] != byte(first+i) {
+			t.Fatalf("frame %d is frame %d of the source, expected %d", i, c.Data.Payload[4], first+i)
+		}
+	}
+}
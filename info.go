@@ -0,0 +1,349 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Summary describes file in a few lines, it's built from CRID, stream headers and stream chunks
+type Summary struct {
+	FileName string `json:"file_name,omitempty"`
+	Version  string `json:"version"`
+	// Duration of the longest stream, in seconds
+	Duration  float64 `json:"duration"`
+	Chunks    int     `json:"chunks"`
+	Encrypted bool    `json:"encrypted"`
+
+	Streams []StreamSummary `json:"streams"`
+}
+
+// StreamSummary describes single stream. Fields which don't make sense for stream type are left empty
+type StreamSummary struct {
+	Type    string `json:"type"`
+	ID      string `json:"id"`
+	Channel int    `json:"channel"`
+	Codec   string `json:"codec,omitempty"`
+
+	Chunks int `json:"chunks"`
+	// Size of all payloads, in bytes
+	Size int64 `json:"size"`
+	// Duration in seconds
+	Duration float64 `json:"duration"`
+	// Bitrate in bits per second
+	Bitrate int64 `json:"bitrate"`
+	// Encryption can be detected only for MPEG video, HCA and ADX audio
+	Encrypted bool `json:"encrypted"`
+
+	// video and alpha
+	Width     int     `json:"width,omitempty"`
+	Height    int     `json:"height,omitempty"`
+	FrameRate float64 `json:"frame_rate,omitempty"`
+	Frames    int     `json:"frames,omitempty"`
+
+	// audio
+	SampleRate int `json:"sample_rate,omitempty"`
+	Channels   int `json:"channels,omitempty"`
+
+	// subtitles
+	Languages []string `json:"languages,omitempty"`
+}
+
+var streamTypeNames = map[[4]byte]string{
+	_SFV: "video",
+	_ALP: "alpha",
+	_SFA: "audio",
+	_SBT: "subtitles",
+	_CUE: "cues",
+}
+
+var videoCodecNames = map[uint64]string{
+	videoCodecMPEG1: "MPEG-1",
+	videoCodecMPEG2: "MPEG-2",
+	videoCodecH264:  "H.264",
+	videoCodecVP9:   "VP9",
+}
+
+var audioCodecNames = map[uint64]string{
+	audioCodecADX: "ADX",
+	audioCodecHCA: "HCA",
+}
+
+// Summarize collects short description of the file
+func Summarize(info *USMInfo) (Summary, error) {
+	var result Summary
+	result.Chunks = len(info.allChunks())
+
+	if info.CRID.Header.ID == CRID {
+		_, rows, err := info.CRID.Table()
+		if err != nil {
+			return result, fmt.Errorf("can't read CRID: %w", err)
+		}
+
+		if len(rows) > 0 {
+			if name, ok := GetEntry(rows[0], "filename"); ok {
+				result.FileName = string(name.Value)
+			}
+			if ver, ok := GetEntry(rows[0], "fmtver"); ok {
+				v := ver.Uint()
+				result.Version = fmt.Sprintf("%d.%d.%d.%d", byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+			}
+		}
+	}
+
+	for _, key := range streamKeys(info.streams()) {
+		stream, err := info.summarizeStream(key)
+		if err != nil {
+			return result, fmt.Errorf("stream %s: %w", key, err)
+		}
+
+		if stream.Duration > result.Duration {
+			result.Duration = stream.Duration
+		}
+		result.Encrypted = result.Encrypted || stream.Encrypted
+		result.Streams = append(result.Streams, stream)
+	}
+
+	// keep the same order streams are written in
+	order := make(map[[4]byte]int)
+	for i := 0; i < len(customOrder); i++ {
+		order[customOrder[i]] = i + 1
+	}
+	sort.SliceStable(result.Streams, func(i, j int) bool {
+		oi, oj := order[idOf(result.Streams[i].ID)], order[idOf(result.Streams[j].ID)]
+		// unknown streams go last
+		if oi == 0 || oj == 0 {
+			return oi != 0 && oj == 0
+		}
+		return oi < oj
+	})
+
+	return result, nil
+}
+
+func idOf(s string) (id [4]byte) {
+	copy(id[:], s)
+	return id
+}
+
+func (s *USMInfo) summarizeStream(key streamKey) (StreamSummary, error) {
+	result := StreamSummary{
+		Type:    streamTypeNames[key.ID],
+		ID:      idToString(key.ID),
+		Channel: int(key.Channel),
+	}
+	if result.Type == "" {
+		result.Type = "unknown"
+	}
+
+	var chunks []Chunk
+	for _, c := range s.streams() {
+		if keyOf(c) == key && c.Data.PayloadHeader.PayloadType == PayloadTypeStream {
+			chunks = append(chunks, c)
+		}
+	}
+
+	// last frame time is used when header doesn't have duration
+	var lastTime float64
+	for _, c := range chunks {
+		result.Chunks++
+		result.Size += int64(c.payloadSize())
+
+		if ph := c.Data.PayloadHeader; ph.FrameRate > 0 {
+			if t := float64(ph.FrameTime) / float64(ph.FrameRate); t > lastTime {
+				lastTime = t
+			}
+		}
+	}
+
+	var header []Entry
+	if hdr, ok := s.HDRInfo[key.ID]; ok {
+		_, rows, err := hdr.Table()
+		if err != nil {
+			return result, fmt.Errorf("can't read header: %w", err)
+		}
+		if len(rows) > 0 {
+			header = rows[0]
+		}
+	}
+
+	value := func(key string) uint64 {
+		e, _ := GetEntry(header, key)
+		return e.Uint()
+	}
+
+	switch key.ID {
+	case _SFV, _ALP:
+		result.Codec = videoCodecNames[value("mpeg_codec")]
+		result.Width, result.Height = int(value("disp_width")), int(value("disp_height"))
+		if result.Width == 0 || result.Height == 0 {
+			result.Width, result.Height = int(value("width")), int(value("height"))
+		}
+
+		if d := value("framerate_d"); d != 0 {
+			result.FrameRate = float64(value("framerate_n")) / float64(d)
+		}
+
+		result.Frames = int(value("total_frames"))
+		if result.Frames == 0 {
+			result.Frames = result.Chunks
+		}
+
+		if result.FrameRate > 0 {
+			result.Duration = float64(result.Frames) / result.FrameRate
+		}
+
+		if len(chunks) > 0 && value("mpeg_codec") <= videoCodecMPEG2 {
+			payload, err := chunks[0].ReadPayload()
+			if err != nil {
+				return result, err
+			}
+			result.Encrypted = isEncryptedMPEG(payload)
+		}
+	case _SFA:
+		result.Codec = audioCodecNames[value("audio_codec")]
+		result.SampleRate = int(value("sampling_rate"))
+		result.Channels = int(value("num_channels"))
+
+		if result.SampleRate > 0 {
+			result.Duration = float64(value("total_samples")) / float64(result.SampleRate)
+		}
+
+		if len(chunks) == 0 {
+			break
+		}
+
+		// codec header is more reliable than header info
+		switch audioHeaderCodec(chunks[0]) {
+		case audioCodecHCA:
+			h, err := readHCAHeader(chunks[0])
+			if err != nil {
+				return result, err
+			}
+
+			result.Codec = audioCodecNames[audioCodecHCA]
+			result.SampleRate, result.Channels = h.SampleRate, h.Channels
+			result.Duration = h.Duration()
+			result.Encrypted = h.Encrypted()
+		case audioCodecADX:
+			h, err := readADXHeader(chunks[0])
+			if err != nil {
+				return result, err
+			}
+
+			result.Codec = audioCodecNames[audioCodecADX]
+			result.SampleRate, result.Channels = h.SampleRate, h.Channels
+			result.Duration = h.Duration()
+			result.Encrypted = h.Encrypted()
+		}
+	case _SBT:
+		langs := make(map[string]bool)
+		for _, c := range chunks {
+			payload, err := c.ReadPayload()
+			if err != nil {
+				return result, err
+			}
+
+			sub, err := ReadSubtitleData(payload)
+			if err != nil {
+				return result, locate(err, c.payloadOffset(), c.Header.ID)
+			}
+			langs[sub.SubtitleHeader.GetLang()] = true
+		}
+
+		for lang := range langs {
+			result.Languages = append(result.Languages, lang)
+		}
+		sort.Strings(result.Languages)
+	}
+
+	if result.Duration == 0 {
+		result.Duration = lastTime
+	}
+
+	if result.Duration > 0 {
+		result.Bitrate = int64(float64(result.Size*8) / result.Duration)
+	}
+
+	return result, nil
+}
+
+// isEncryptedMPEG guesses if MPEG video frame is encrypted.
+// Encryption keeps first 0x40 bytes intact, but after that there should be start codes of the slices
+func isEncryptedMPEG(payload []byte) bool {
+	if len(payload) < 0x240 {
+		return false
+	}
+
+	return !bytes.Contains(payload[0x40:], []byte{0x00, 0x00, 0x01})
+}
+
+func (s Summary) String() string {
+	var b strings.Builder
+
+	if s.FileName != "" {
+		_, _ = fmt.Fprintf(&b, "File: %s\n", s.FileName)
+	}
+	_, _ = fmt.Fprintf(&b, "Container version: %s\n", s.Version)
+	_, _ = fmt.Fprintf(&b, "Duration: %s\n", formatSeconds(s.Duration))
+	_, _ = fmt.Fprintf(&b, "Chunks: %d\n", s.Chunks)
+	_, _ = fmt.Fprintf(&b, "Encrypted: %s\n", yesNo(s.Encrypted))
+	b.WriteString("Streams:")
+
+	for _, stream := range s.Streams {
+		b.WriteString("\n\t")
+		b.WriteString(stream.String())
+	}
+
+	return b.String()
+}
+
+func (s StreamSummary) String() string {
+	parts := make([]string, 0)
+
+	if s.Codec != "" {
+		parts = append(parts, s.Codec)
+	}
+
+	switch s.Type {
+	case "video", "alpha":
+		parts = append(parts, fmt.Sprintf("%dx%d", s.Width, s.Height))
+		if s.FrameRate > 0 {
+			parts = append(parts, strconv.FormatFloat(s.FrameRate, 'f', -1, 64)+" fps")
+		}
+		parts = append(parts, fmt.Sprintf("%d frames", s.Frames))
+	case "audio":
+		parts = append(parts, fmt.Sprintf("%d Hz", s.SampleRate), fmt.Sprintf("%d channels", s.Channels))
+	case "subtitles":
+		parts = append(parts, "languages: "+strings.Join(s.Languages, ", "))
+	}
+
+	parts = append(parts,
+		formatSeconds(s.Duration),
+		fmt.Sprintf("%d kbps", s.Bitrate/1000),
+		fmt.Sprintf("%d chunks", s.Chunks),
+	)
+
+	if s.Encrypted {
+		parts = append(parts, "encrypted")
+	}
+
+	return fmt.Sprintf("%s #%d (%s): %s", s.Type, s.Channel, s.ID, strings.Join(parts, ", "))
+}
+
+// formatSeconds prints duration as hh:mm:ss.mmm
+func formatSeconds(seconds float64) string {
+	ms := int64(seconds*1000 + 0.5)
+
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+
+	return "no"
+}
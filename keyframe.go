@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	mpegPictureStart = 0x00
+	mpegPictureI     = 1
+	h264NALIDR       = 5
+)
+
+var startCode = []byte{0x00, 0x00, 0x01}
+
+// isKeyframe checks if video frame can be decoded without previous frames
+func isKeyframe(codec uint64, payload []byte) (bool, error) {
+	switch codec {
+	case videoCodecMPEG1, videoCodecMPEG2:
+		return isMPEGKeyframe(payload), nil
+	case videoCodecH264:
+		return isH264Keyframe(payload), nil
+	case videoCodecVP9:
+		return isVP9Keyframe(payload), nil
+	default:
+		return false, fmt.Errorf("keyframes of video codec %d are unknown", codec)
+	}
+}
+
+// isMPEGKeyframe looks for picture header with I picture coding type
+func isMPEGKeyframe(payload []byte) bool {
+	for {
+		i := bytes.Index(payload, startCode)
+		if i < 0 || i+5 >= len(payload) {
+			return false
+		}
+
+		payload = payload[i+3:]
+		if payload[0] == mpegPictureStart {
+			// 10 bits of temporal reference, then 3 bits of picture coding type
+			return (payload[2]>>3)&0x07 == mpegPictureI
+		}
+	}
+}
+
+// isH264Keyframe looks for IDR slice in Annex B stream
+func isH264Keyframe(payload []byte) bool {
+	for {
+		i := bytes.Index(payload, startCode)
+		if i < 0 || i+3 >= len(payload) {
+			return false
+		}
+
+		payload = payload[i+3:]
+		if payload[0]&0x1F == h264NALIDR {
+			return true
+		}
+	}
+}
+
+// isVP9Keyframe reads frame type from uncompressed header of VP9 frame
+func isVP9Keyframe(payload []byte) bool {
+	if len(payload) == 0 {
+		return false
+	}
+
+	b := payload[0]
+	// frame marker
+	if b>>6 != 2 {
+		return false
+	}
+
+	bit := 4
+	if profile := (b>>5)&1 | (b>>4)&1<<1; profile == 3 {
+		// reserved zero bit
+		bit++
+	}
+
+	// show_existing_frame repeats already decoded frame
+	if b>>(7-bit)&1 != 0 {
+		return false
+	}
+	bit++
+
+	// frame_type is 0 for keyframes
+	return b>>(7-bit)&1 == 0
+}
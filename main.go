@@ -2,8 +2,10 @@ package parser
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
@@ -11,6 +13,14 @@ import (
 )
 
 func DumpAllChunks(src io.Reader, out io.Writer) (err error) {
+	return DumpAllChunksContext(context.Background(), src, out, nil)
+}
+
+// DumpAllChunksContext is DumpAllChunks which stops when ctx is done and reports progress after every chunk.
+// Without progress every chunk is announced on stdout instead
+func DumpAllChunksContext(ctx context.Context, src io.Reader, out io.Writer, progress ProgressFunc) (err error) {
+	p := Progress{File: fileName(src), TotalBytes: fileSize(src)}
+
 	// start json array
 	if _, err = out.Write([]byte("[\n")); err != nil {
 		return fmt.Errorf("can't write result: %w", err)
@@ -19,6 +29,10 @@ func DumpAllChunks(src io.Reader, out io.Writer) (err error) {
 	var i = 0
 	var pos int
 	for {
+		if err = checkContext(ctx); err != nil {
+			return err
+		}
+
 		i++
 		chunkInfo, err := ReadChunk(src, pos)
 		if err != nil {
@@ -34,7 +48,9 @@ func DumpAllChunks(src io.Reader, out io.Writer) (err error) {
 			}
 		}
 
-		fmt.Printf("== Chunk #%d at %#x ==\n", i, pos)
+		if progress == nil {
+			fmt.Printf("== Chunk #%d at %#x ==\n", i, pos)
+		}
 
 		j := map[string]string{
 			"Offset":        strconv.Itoa(pos),
@@ -50,6 +66,7 @@ func DumpAllChunks(src io.Reader, out io.Writer) (err error) {
 		if chunkInfo.Data.PayloadHeader.PayloadType == PayloadTypeEnd {
 			payload, err := ParsePayloadEnd(chunkInfo.Data.Payload)
 			if err != nil {
+				err = locate(err, chunkInfo.payloadOffset(), chunkInfo.Header.ID)
 				fmt.Println("can't parse payload end: ", err)
 			} else {
 				j["Payload"] = payload
@@ -60,6 +77,7 @@ func DumpAllChunks(src io.Reader, out io.Writer) (err error) {
 			chunkInfo.Data.PayloadHeader.PayloadType == PayloadTypeSeek {
 			payload, err := ParsePayload(chunkInfo.Data.Payload)
 			if err != nil {
+				err = locate(err, chunkInfo.payloadOffset(), chunkInfo.Header.ID)
 				fmt.Println("can't parse payload: ", err)
 			} else {
 				j["Payload"] = payload.String()
@@ -67,6 +85,7 @@ func DumpAllChunks(src io.Reader, out io.Writer) (err error) {
 
 			name, dict, err := BuildDict(payload)
 			if err != nil {
+				err = locate(err, chunkInfo.payloadOffset(), chunkInfo.Header.ID)
 				fmt.Println("can't build dict: ", err)
 			} else {
 				j[name] = fmt.Sprintf("%+v", dict)
@@ -78,12 +97,24 @@ func DumpAllChunks(src io.Reader, out io.Writer) (err error) {
 			// we can parse subtitle stream data
 			sub, err := ReadSubtitleData(chunkInfo.Data.Payload)
 			if err != nil {
+				err = locate(err, chunkInfo.payloadOffset(), chunkInfo.Header.ID)
 				fmt.Println("can't read subtitle data: ", err)
 			} else {
 				j["SubtitleInfo"] = sub.String()
 			}
 		}
 
+		if chunkInfo.Data.PayloadHeader.PayloadType == PayloadTypeStream &&
+			chunkInfo.Header.ID == _CUE {
+			cues, err := DecodeCuePoints(chunkInfo.Data.Payload)
+			if err != nil {
+				err = locate(err, chunkInfo.payloadOffset(), chunkInfo.Header.ID)
+				fmt.Println("can't read cue points: ", err)
+			} else {
+				j["CuePoints"] = fmt.Sprintf("%+v", cues)
+			}
+		}
+
 		result, err := json.MarshalIndent(j, "", "\t")
 		if err != nil {
 			return fmt.Errorf("encoding err: %w", err)
@@ -93,6 +124,9 @@ func DumpAllChunks(src io.Reader, out io.Writer) (err error) {
 		if err != nil {
 			return fmt.Errorf("can't write result: %w", err)
 		}
+
+		p.Bytes, p.Chunks = int64(pos), i
+		progress.report(p)
 	}
 
 	if _, err = out.Write([]byte("\n]")); err != nil {
@@ -106,12 +140,21 @@ func ReadSubtitleData(raw []byte) (result Subtitle, err error) {
 	src := bytes.NewReader(raw)
 
 	head := new(SubtitleHeader)
-	if err = binary.Read(src, binary.LittleEndian, head); err != nil {
-		return
+	if err = readStruct(src, binary.LittleEndian, head); err == io.EOF {
+		return result, &ErrTruncatedChunk{ChunkID: _SBT, Expected: binary.Size(head)}
+	} else if err != nil {
+		return result, locate(err, 0, _SBT)
 	}
 
+	// only missing text means the payload is truncated, other errors are returned as is
 	var subText = make([]byte, head.StringSize)
-	if err = safeRead(src, subText); err != nil {
+	if _, err = io.ReadFull(src, subText); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return result, &ErrTruncatedChunk{
+			ChunkID:  _SBT,
+			Expected: binary.Size(head) + int(head.StringSize),
+			Actual:   len(raw),
+		}
+	} else if err != nil {
 		return
 	}
 
@@ -130,26 +173,67 @@ func ReadChunk(src io.Reader, offset int) (result Chunk, err error) {
 	result.offset = offset
 	result.Header, err = ReadHeader(src)
 	if err != nil {
-		return result, err
+		return result, locate(err, int64(offset), [4]byte{})
+	}
+
+	if !isValidID(result.Header.ID) {
+		return result, &ErrUnknownChunkID{Offset: int64(offset), ChunkID: result.Header.ID}
 	}
+
 	result.Data, err = ReadChunkData(src, result.Header.Size)
+	if err != nil {
+		var truncated *ErrTruncatedChunk
+		if errors.As(err, &truncated) {
+			// report size of the whole chunk, including its header
+			truncated.Expected += 8
+			truncated.Actual += 8
+			return result, locate(err, int64(offset), result.Header.ID)
+		}
 
-	return result, err
+		// sizes are from chunk header, so like Reader it reports start of the chunk
+		var badSize *ErrBadChunkSize
+		if errors.As(err, &badSize) {
+			return result, locate(err, int64(offset), result.Header.ID)
+		}
+
+		// other errors are relative to chunk data, which goes after 8 bytes of chunk header
+		return result, locate(err, int64(offset)+8, result.Header.ID)
+	}
+
+	return result, nil
 }
 
 func ReadChunkData(src io.Reader, size int32) (result Data, err error) {
-	result.PayloadHeader, err = ReadPayloadHeader(src)
+	if int(size) < result.PayloadHeader.Len() {
+		return result, &ErrBadChunkSize{Size: size}
+	}
+
+	// read whole chunk at once, buffer grows only as much as there is actual data
+	raw, err := io.ReadAll(io.LimitReader(src, int64(size)))
+	if err != nil {
+		return
+	}
+
+	if len(raw) != int(size) {
+		return result, &ErrTruncatedChunk{Expected: int(size), Actual: len(raw)}
+	}
+
+	rawReader := bytes.NewReader(raw)
+	result.PayloadHeader, err = ReadPayloadHeader(rawReader)
 	if err != nil {
 		return
 	}
 
+	if err = checkSizes(Header{Size: size}, result.PayloadHeader); err != nil {
+		return
+	}
+
 	_payload := make([]byte,
 		int(size)-int(result.PayloadHeader.PaddingSize)-result.PayloadHeader.Len())
-	err = safeRead(src, _payload)
+	err = safeRead(rawReader, _payload)
 	result.Payload = _payload
 
-	// skip padding
-	_ = safeRead(src, make([]byte, result.PayloadHeader.PaddingSize))
+	// padding is skipped, it's already read into raw
 
 	return result, err
 }
@@ -163,20 +247,51 @@ func ParsePayloadEnd(raw []byte) (string, error) {
 func ParsePayload(raw []byte) (result Payload, err error) {
 	src := bytes.NewReader(raw)
 
+	// 8 bytes of header and 24 bytes of fixed data
+	if len(raw) < 8+24 {
+		return result, &ErrBadUTFTable{Reason: "table header is truncated", Expected: 8 + 24, Actual: len(raw)}
+	}
+
 	if err = binary.Read(src, binary.BigEndian, &result.Header); err != nil {
 		return
 	}
 
+	if result.Header.ID != _UTF {
+		return result, &ErrBadUTFTable{Reason: fmt.Sprintf("unexpected signature % x", result.Header.ID)}
+	}
+
+	if result.Header.Size < 0 || int(result.Header.Size)+8 > len(raw) {
+		return result, &ErrBadUTFTable{
+			Reason:   "table is truncated",
+			Expected: int(result.Header.Size) + 8,
+			Actual:   len(raw),
+		}
+	}
+
 	fixedData := PayloadFixedData{}
 	if err = binary.Read(src, binary.BigEndian, &fixedData); err != nil {
 		return
 	}
 
+	// offsets are counted from the end of 8 bytes of header
+	if fixedData.UniqueArrayOffset < fixedData.Length() ||
+		fixedData.StringArrayOffset < fixedData.UniqueArrayOffset ||
+		fixedData.ByteArrayOffset < fixedData.StringArrayOffset ||
+		int64(fixedData.ByteArrayOffset) > int64(result.Header.Size) {
+		return result, &ErrBadUTFTable{
+			Offset: 8,
+			Reason: fmt.Sprintf("bad array offsets %#x, %#x, %#x for table of size %#x",
+				fixedData.UniqueArrayOffset, fixedData.StringArrayOffset, fixedData.ByteArrayOffset,
+				result.Header.Size),
+		}
+	}
+
 	_sharedArray := make([]byte, fixedData.UniqueArrayOffset-fixedData.Length())
 	_uniqueArray := make([]byte, fixedData.StringArrayOffset-fixedData.UniqueArrayOffset)
 	_stringArray := make([]byte, fixedData.ByteArrayOffset-fixedData.StringArrayOffset)
 	_byteArray := make([]byte, result.Header.Size-int32(fixedData.ByteArrayOffset))
 
+	// sizes are checked above, so these can't fail
 	_ = safeRead(src, _sharedArray)
 	_ = safeRead(src, _uniqueArray)
 	_ = safeRead(src, _stringArray)
@@ -196,70 +311,118 @@ func ParsePayload(raw []byte) (result Payload, err error) {
 }
 
 func ReadHeader(src io.Reader) (result Header, err error) {
-	return result, binary.Read(src, binary.BigEndian, &result)
+	return result, readStruct(src, binary.BigEndian, &result)
 }
 
 func ReadPayloadHeader(src io.Reader) (result PayloadHeader, err error) {
-	return result, binary.Read(src, binary.BigEndian, &result)
+	return result, readStruct(src, binary.BigEndian, &result)
+}
+
+// readStruct works like binary.Read, but reports how much data was available if src ends too early.
+// io.EOF is returned as is when there was no data at all
+func readStruct(src io.Reader, order binary.ByteOrder, data interface{}) error {
+	raw := make([]byte, binary.Size(data))
+	n, err := io.ReadFull(src, raw)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return &ErrTruncatedChunk{Expected: len(raw), Actual: n}
+		}
+		return err
+	}
+
+	return binary.Read(bytes.NewReader(raw), order, data)
 }
 
 func safeRead(src io.Reader, dst []byte) error {
-	dstLength := len(dst)
-	n, err := src.Read(dst)
-	if n != dstLength {
-		fmt.Printf("expected %d bytes but got %d", dstLength, n)
-		return nil
+	n, err := io.ReadFull(src, dst)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return &ErrTruncatedChunk{Expected: len(dst), Actual: n}
 	}
 
 	return err
 }
 
 func BuildDict(src Payload) (name string, result [][]Entry, err error) {
-	sharedArray := bytes.NewReader(src.PayloadData.PayloadFlexData.SharedArray)
-	uniqueArray := bytes.NewReader(src.PayloadData.PayloadFlexData.UniqueArray)
-	stringsArray := bytes.NewReader(src.PayloadData.PayloadFlexData.StringArray)
-	bytesArray := bytes.NewReader(src.PayloadData.PayloadFlexData.ByteArray)
+	fixedData := src.PayloadData.PayloadFixedData
+	flexData := src.PayloadData.PayloadFlexData
+
+	sharedArray := bytes.NewReader(flexData.SharedArray)
+	uniqueArray := bytes.NewReader(flexData.UniqueArray)
+	stringsArray := bytes.NewReader(flexData.StringArray)
+
+	// offsets of the arrays from the start of the table, used for error reporting
+	// (8 bytes of header go before offsets stored in fixed data)
+	sharedBase := int64(8 + fixedData.Length())
+	uniqueBase := int64(8 + fixedData.UniqueArrayOffset)
+	stringsBase := int64(8 + fixedData.StringArrayOffset)
+	bytesBase := int64(8 + fixedData.ByteArrayOffset)
+
+	readValue := func(isUnique bool, dst []byte) error {
+		array, base, arrayName := sharedArray, sharedBase, "shared"
+		if isUnique {
+			array, base, arrayName = uniqueArray, uniqueBase, "unique"
+		}
+
+		return readArray(array, dst, base, arrayName)
+	}
+
+	readString := func(addr []byte) (string, error) {
+		offset := binary.BigEndian.Uint32(addr)
+		if int(offset) >= len(flexData.StringArray) {
+			return "", &ErrBadUTFTable{
+				Offset: stringsBase,
+				Reason: fmt.Sprintf("string offset %#x is out of string array of size %#x",
+					offset, len(flexData.StringArray)),
+			}
+		}
+
+		return ReadStringAt(stringsArray, int(offset))
+	}
 
 	result = make([][]Entry, 0)
 
-	for i := 1; i <= int(src.PayloadData.PayloadFixedData.NumberOfDictionary); i++ {
+	for i := 1; i <= int(fixedData.NumberOfDictionary); i++ {
 		var dict = make([]Entry, 0)
 
-		for ii := 1; ii <= int(src.PayloadData.PayloadFixedData.ItemsPerDictionary); ii++ {
+		for ii := 1; ii <= int(fixedData.ItemsPerDictionary); ii++ {
+			itemTypeOffset := sharedBase + sharedArray.Size() - int64(sharedArray.Len())
+
 			var itemType byte
 			itemType, err = sharedArray.ReadByte()
 			if err != nil {
+				err = &ErrBadUTFTable{Offset: itemTypeOffset, Reason: "shared array is too short", Expected: 1}
 				return
 			}
 
 			valueType, isUnique := GetValue(itemType)
+			if valueType.Size == 0 {
+				err = &ErrBadUTFTable{
+					Offset: itemTypeOffset,
+					Reason: fmt.Sprintf("unknown value type %#x", itemType),
+				}
+				return
+			}
 
 			keyAddr := make([]byte, 4)
-			if err = safeRead(sharedArray, keyAddr); err != nil {
+			if err = readArray(sharedArray, keyAddr, sharedBase, "shared"); err != nil {
 				return
 			}
 
 			var key string
-			key, err = ReadStringAt(stringsArray, int(binary.BigEndian.Uint32(keyAddr)))
+			key, err = readString(keyAddr)
 			if err != nil {
 				return
 			}
 
 			valueInfo := make([]byte, valueType.Size)
-
-			if isUnique {
-				err = safeRead(uniqueArray, valueInfo)
-			} else {
-				err = safeRead(sharedArray, valueInfo)
-			}
-			if err != nil {
+			if err = readValue(isUnique, valueInfo); err != nil {
 				return
 			}
 
 			if valueType.Name == "String" {
 				// we have to find actual value in strings array
 				var actualValue string
-				actualValue, err = ReadStringAt(stringsArray, int(binary.BigEndian.Uint32(valueInfo)))
+				actualValue, err = readString(valueInfo)
 				if err != nil {
 					return
 				}
@@ -271,22 +434,24 @@ func BuildDict(src Payload) (name string, result [][]Entry, err error) {
 			if valueType.Name == "Bytes" {
 				// we need to find end of data as well
 				valueInfoEnd := make([]byte, valueType.Size)
-				if isUnique {
-					err = safeRead(uniqueArray, valueInfoEnd)
-				} else {
-					err = safeRead(sharedArray, valueInfoEnd)
-				}
-				if err != nil {
+				if err = readValue(isUnique, valueInfoEnd); err != nil {
 					return
 				}
 
-				length := binary.BigEndian.Uint32(valueInfoEnd) - binary.BigEndian.Uint32(valueInfo)
-				bytesVal := make([]byte, length)
-				_, err = bytesArray.ReadAt(bytesVal, int64(binary.BigEndian.Uint32(valueInfo)))
-				if err != nil {
+				start := binary.BigEndian.Uint32(valueInfo)
+				end := binary.BigEndian.Uint32(valueInfoEnd)
+				if end < start || int(end) > len(flexData.ByteArray) {
+					err = &ErrBadUTFTable{
+						Offset: bytesBase,
+						Reason: fmt.Sprintf("bytes value %#x-%#x is out of byte array of size %#x",
+							start, end, len(flexData.ByteArray)),
+					}
 					return
 				}
 
+				bytesVal := make([]byte, end-start)
+				copy(bytesVal, flexData.ByteArray[start:end])
+
 				dict = append(dict, Entry{key, valueType, !isUnique, bytesVal})
 				continue
 			}
@@ -303,10 +468,32 @@ func BuildDict(src Payload) (name string, result [][]Entry, err error) {
 		}
 	}
 
-	name, err = ReadStringAt(stringsArray, int(src.PayloadData.PayloadFixedData.PayloadNameOffset))
+	nameOffset := make([]byte, 4)
+	binary.BigEndian.PutUint32(nameOffset, fixedData.PayloadNameOffset)
+	name, err = readString(nameOffset)
 	return
 }
 
+// readArray reads next value from one of @UTF table arrays
+func readArray(array *bytes.Reader, dst []byte, base int64, arrayName string) error {
+	offset := base + array.Size() - int64(array.Len())
+
+	err := safeRead(array, dst)
+	if err != nil {
+		var truncated *ErrTruncatedChunk
+		if errors.As(err, &truncated) {
+			return &ErrBadUTFTable{
+				Offset:   offset,
+				Reason:   arrayName + " array is too short",
+				Expected: truncated.Expected,
+				Actual:   truncated.Actual,
+			}
+		}
+	}
+
+	return err
+}
+
 func ReadStringAt(src *bytes.Reader, offset int) (string, error) {
 	_, err := src.Seek(int64(offset), io.SeekStart)
 	if err != nil {
@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestReadSubtitleData(t *testing.T) {
+	subtitle := func(text string, size uint32) []byte {
+		b := make([]byte, 20, 20+len(text))
+		binary.LittleEndian.PutUint32(b[4:], 1000)
+		binary.LittleEndian.PutUint32(b[8:], 500)
+		binary.LittleEndian.PutUint32(b[12:], 1500)
+		binary.LittleEndian.PutUint32(b[16:], size)
+		return append(b, text...)
+	}
+
+	tests := []struct {
+		name string
+		raw  []byte
+		text string
+		// expected size of truncated payload, 0 if it's complete
+		truncated int
+	}{
+		{name: "text", raw: subtitle("hello\x00\x00", 7), text: "hello\r\n"},
+		{name: "empty text", raw: subtitle("", 0)},
+		{name: "truncated text", raw: subtitle("hel", 7), truncated: 27},
+		{name: "truncated header", raw: subtitle("", 0)[:12], truncated: 20},
+		{name: "empty payload", raw: []byte{}, truncated: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, err := ReadSubtitleData(tt.raw)
+
+			if tt.truncated != 0 {
+				var truncated *ErrTruncatedChunk
+				if !errors.As(err, &truncated) {
+					t.Fatalf("got %v, expected truncated chunk", err)
+				}
+				if truncated.ChunkID != _SBT || truncated.Expected != tt.truncated {
+					t.Fatalf("got %v, expected %d bytes", err, tt.truncated)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sub.SubtitleHeader.FrameTime != 500 || string(sub.SubtitleString) != tt.text {
+				t.Fatalf("got %+v", sub)
+			}
+		})
+	}
+}
+
+func TestBadChunkSizeOffset(t *testing.T) {
+	var b bytes.Buffer
+	good := makeStreamChunk(_SFV, 0, 0, 3000, make([]byte, 8))
+	if _, err := WriteChunk(good, &b); err != nil {
+		t.Fatal(err)
+	}
+	start := b.Len()
+
+	if _, err := WriteChunk(makeStreamChunk(_SFV, 0, 100, 3000, make([]byte, 8)), &b); err != nil {
+		t.Fatal(err)
+	}
+	// padding goes after 8 bytes of chunk header and 2 bytes of payload header, it's bigger than the chunk now
+	binary.BigEndian.PutUint16(b.Bytes()[start+10:], 0x100)
+
+	_, err := NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	var readerErr *ErrBadChunkSize
+	if !errors.As(err, &readerErr) {
+		t.Fatalf("got %v from Reader, expected bad chunk size", err)
+	}
+
+	_, err = ReadChunk(bytes.NewReader(b.Bytes()[start:]), start)
+	var chunkErr *ErrBadChunkSize
+	if !errors.As(err, &chunkErr) {
+		t.Fatalf("got %v from ReadChunk, expected bad chunk size", err)
+	}
+
+	if readerErr.Offset != int64(start) || chunkErr.Offset != int64(start) {
+		t.Fatalf("Reader reports %#x, ReadChunk reports %#x, chunk starts at %#x", readerErr.Offset, chunkErr.Offset, start)
+	}
+	if readerErr.ChunkID != _SFV || chunkErr.ChunkID != _SFV {
+		t.Fatalf("Reader reports %s, ReadChunk reports %s", idToString(readerErr.ChunkID), idToString(chunkErr.ChunkID))
+	}
+}
@@ -2,7 +2,9 @@ package parser
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -15,13 +17,23 @@ type USMInfo struct {
 	Metadata        map[[4]byte]Chunk
 	AudioStreams    []Chunk
 	VideoStreams    []Chunk
+	AlphaStreams    []Chunk
 	SubtitleStreams []Chunk
+	CueStreams      []Chunk
+	// UnknownStreams are chunks of types this package doesn't understand (@USR user data, vendor extensions).
+	// They are kept as is and written back according to their frame time
+	UnknownStreams []Chunk
+	// EndChunks are HEADER END, METADATA END and CONTENTS END markers as found in the source file.
+	// Writer generates its own markers, so these are used only for validation
+	EndChunks []Chunk
 }
 
 var customOrder = map[int][4]byte{
 	0: _SFV,
-	1: _SFA,
-	2: _SBT,
+	1: _ALP,
+	2: _SFA,
+	3: _SBT,
+	4: _CUE,
 }
 
 var (
@@ -29,6 +41,9 @@ var (
 	_SFV = [4]byte{0x40, 0x53, 0x46, 0x56}
 	_SFA = [4]byte{0x40, 0x53, 0x46, 0x41}
 	_SBT = [4]byte{0x40, 0x53, 0x42, 0x54}
+	_ALP = [4]byte{0x40, 0x41, 0x4C, 0x50}
+	_CUE = [4]byte{0x40, 0x43, 0x55, 0x45}
+	_USR = [4]byte{0x40, 0x55, 0x53, 0x52}
 	_UTF = [4]byte{0x40, 0x55, 0x54, 0x46}
 
 	HCA_ = [4]byte{0x48, 0x43, 0x41, 0x00}
@@ -53,12 +68,20 @@ var (
 )
 
 func ParseFile(src *os.File) (*USMInfo, error) {
-	var result USMInfo
-	result.HDRInfo = make(map[[4]byte]Chunk, 0)
-	result.Metadata = make(map[[4]byte]Chunk, 0)
+	return ParseFileContext(context.Background(), src, nil)
+}
+
+// ParseFileContext is ParseFile which stops when ctx is done and reports progress after every chunk
+func ParseFileContext(ctx context.Context, src *os.File, progress ProgressFunc) (*USMInfo, error) {
+	result := newUSMInfo()
+	p := Progress{File: src.Name(), TotalBytes: fileSize(src)}
 
 	var pos int
 	for {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+
 		chunkInfo, err := ReadChunk(src, pos)
 		if err != nil {
 			if err == io.EOF {
@@ -67,35 +90,67 @@ func ParseFile(src *os.File) (*USMInfo, error) {
 			return nil, fmt.Errorf("read chunk: %w", err)
 		}
 
-		if chunkInfo.Header.ID == CRID {
-			result.CRID = chunkInfo
-			continue
-		}
+		// 8 is the size of chunkHeader
+		pos += int(chunkInfo.Header.Size) + 8
 
-		if chunkInfo.Data.PayloadHeader.PayloadType == PayloadTypeHeader {
-			result.HDRInfo[chunkInfo.Header.ID] = chunkInfo
-			continue
-		}
+		result.add(chunkInfo)
 
-		if chunkInfo.Data.PayloadHeader.PayloadType == PayloadTypeSeek {
-			result.Metadata[chunkInfo.Header.ID] = chunkInfo
-			continue
-		}
+		p.Bytes, p.Chunks = int64(pos), p.Chunks+1
+		progress.report(p)
+	}
 
-		if chunkInfo.Data.PayloadHeader.PayloadType == PayloadTypeStream {
-			switch chunkInfo.Header.ID {
-			case _SFV:
-				result.VideoStreams = append(result.VideoStreams, chunkInfo)
-			case _SFA:
-				result.AudioStreams = append(result.AudioStreams, chunkInfo)
-			case _SBT:
-				result.SubtitleStreams = append(result.SubtitleStreams, chunkInfo)
-			}
-			continue
+	return result, nil
+}
+
+func newUSMInfo() *USMInfo {
+	return &USMInfo{
+		HDRInfo:  make(map[[4]byte]Chunk, 0),
+		Metadata: make(map[[4]byte]Chunk, 0),
+	}
+}
+
+// add puts chunk to the corresponding place of USMInfo
+func (s *USMInfo) add(chunkInfo Chunk) {
+	if chunkInfo.Header.ID == CRID {
+		s.CRID = chunkInfo
+		return
+	}
+
+	if chunkInfo.Data.PayloadHeader.PayloadType == PayloadTypeHeader {
+		s.HDRInfo[chunkInfo.Header.ID] = chunkInfo
+		return
+	}
+
+	if chunkInfo.Data.PayloadHeader.PayloadType == PayloadTypeSeek {
+		s.Metadata[chunkInfo.Header.ID] = chunkInfo
+		return
+	}
+
+	if chunkInfo.Data.PayloadHeader.PayloadType == PayloadTypeEnd {
+		s.EndChunks = append(s.EndChunks, chunkInfo)
+		return
+	}
+
+	if chunkInfo.Data.PayloadHeader.PayloadType == PayloadTypeStream {
+		switch chunkInfo.Header.ID {
+		case _SFV:
+			s.VideoStreams = append(s.VideoStreams, chunkInfo)
+		case _ALP:
+			s.AlphaStreams = append(s.AlphaStreams, chunkInfo)
+		case _SFA:
+			s.AudioStreams = append(s.AudioStreams, chunkInfo)
+		case _SBT:
+			s.SubtitleStreams = append(s.SubtitleStreams, chunkInfo)
+		case _CUE:
+			s.CueStreams = append(s.CueStreams, chunkInfo)
+		default:
+			s.UnknownStreams = append(s.UnknownStreams, chunkInfo)
 		}
+		return
 	}
 
-	return &result, nil
+	// unknown payload type
+	s.UnknownStreams = append(s.UnknownStreams, chunkInfo)
 }
 
 func (s *USMInfo) PrepareStreams() *USMInfo {
@@ -107,16 +162,15 @@ func (s *USMInfo) PrepareStreams() *USMInfo {
 
 	s.VideoStreams = addContentsEnd(s.VideoStreams)
 
-	sort.SliceStable(s.AudioStreams, func(i, j int) bool {
-		// audio streams include additional HCA header, which should be first
-		if bytes.HasPrefix(s.AudioStreams[i].Data.Payload, HCA_[:]) {
-			return true
-		}
-
-		return s.AudioStreams[i].Data.PayloadHeader.FrameTime <
-			s.AudioStreams[j].Data.PayloadHeader.FrameTime
+	// alpha is the same as video, but for transparency layer
+	sort.SliceStable(s.AlphaStreams, func(i, j int) bool {
+		return s.AlphaStreams[i].Data.PayloadHeader.FrameTime <
+			s.AlphaStreams[j].Data.PayloadHeader.FrameTime
 	})
 
+	s.AlphaStreams = addContentsEnd(s.AlphaStreams)
+
+	s.AudioStreams = sortAudio(s.AudioStreams)
 	s.AudioStreams = addContentsEnd(s.AudioStreams)
 
 	sort.SliceStable(s.SubtitleStreams, func(i, j int) bool {
@@ -136,9 +190,107 @@ func (s *USMInfo) PrepareStreams() *USMInfo {
 
 	s.SubtitleStreams = addContentsEnd(s.SubtitleStreams)
 
+	sort.SliceStable(s.CueStreams, func(i, j int) bool {
+		return s.CueStreams[i].Data.PayloadHeader.FrameTime <
+			s.CueStreams[j].Data.PayloadHeader.FrameTime
+	})
+
+	s.CueStreams = addContentsEnd(s.CueStreams)
+
+	s.UnknownStreams = prepareUnknown(s.UnknownStreams)
+
 	return s
 }
 
+// sortAudio orders audio chunks by frame time.
+// Audio streams include additional HCA or ADX header, which should be first
+func sortAudio(src []Chunk) []Chunk {
+	// checking payload might require reading from source, so do it only once per chunk
+	headers := make([]Chunk, 0, 1)
+	data := make([]Chunk, 0, len(src))
+	for _, c := range src {
+		if audioHeaderCodec(c) != 0 {
+			headers = append(headers, c)
+			continue
+		}
+		data = append(data, c)
+	}
+
+	sort.SliceStable(data, func(i, j int) bool {
+		return data[i].Data.PayloadHeader.FrameTime <
+			data[j].Data.PayloadHeader.FrameTime
+	})
+
+	return append(headers, data...)
+}
+
+// leadingAudio splits audio headers and the first data chunk from the rest of audio stream,
+// they are written right after the first video chunk
+func (s *USMInfo) leadingAudio() (leading, rest []Chunk) {
+	var headers int
+	for headers < len(s.AudioStreams) && s.AudioStreams[headers].Data.PayloadHeader.PayloadType == PayloadTypeStream &&
+		audioHeaderCodec(s.AudioStreams[headers]) != 0 {
+		headers++
+	}
+
+	// only CONTENTS END is left after the header, don't move it
+	if headers == 0 || headers+1 >= len(s.AudioStreams) {
+		return nil, s.AudioStreams
+	}
+
+	return s.AudioStreams[:headers+1], s.AudioStreams[headers+1:]
+}
+
+// isHCAHeader checks if chunk holds HCA header.
+// Encrypted files have signature masked with 0x80, so this bit is ignored
+func isHCAHeader(c Chunk) bool {
+	prefix := c.payloadPrefix(len(HCA_))
+	if len(prefix) != len(HCA_) {
+		return false
+	}
+
+	for i := range prefix {
+		if prefix[i]&0x7F != HCA_[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// prepareUnknown orders unknown chunks by frame time and adds CONTENTS END for each of their streams
+func prepareUnknown(src []Chunk) []Chunk {
+	streams := make(map[streamKey][]Chunk)
+	result := make([]Chunk, 0, len(src))
+	for _, c := range src {
+		if c.Data.PayloadHeader.PayloadType != PayloadTypeStream {
+			// chunks of unknown payload type don't belong to any stream
+			result = append(result, c)
+			continue
+		}
+
+		streams[keyOf(c)] = append(streams[keyOf(c)], c)
+	}
+
+	for _, key := range sortedKeys(keysOf(streams)) {
+		stream := streams[key]
+		sort.SliceStable(stream, func(i, j int) bool {
+			return stream[i].Data.PayloadHeader.FrameTime < stream[j].Data.PayloadHeader.FrameTime
+		})
+
+		stream = addContentsEnd(stream)
+		stream[len(stream)-1].Data.PayloadHeader.ChannelNumber = key.Channel
+
+		result = append(result, stream...)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Data.PayloadHeader.FrameTime < result[j].Data.PayloadHeader.FrameTime
+	})
+
+	return result
+}
+
 func addContentsEnd(src []Chunk) []Chunk {
 	if len(src) <= 0 {
 		return src
@@ -153,9 +305,26 @@ func addContentsEnd(src []Chunk) []Chunk {
 }
 
 func (s *USMInfo) WriteTo(seeker io.WriteSeeker) error {
-	var videoSeekPos int64
+	return s.WriteToContext(context.Background(), seeker, nil)
+}
 
-	videoOffsets := make([]int64, 0)
+// WriteToContext is WriteTo which stops when ctx is done and reports progress after every stream chunk.
+// Output is left incomplete if writing is stopped
+func (s *USMInfo) WriteToContext(ctx context.Context, seeker io.WriteSeeker, progress ProgressFunc) error {
+	// recovered files might miss important parts
+	if s.CRID.Header.ID != CRID {
+		return errors.New("no CRID chunk")
+	}
+	if len(s.VideoStreams) == 0 {
+		return errors.New("no video streams")
+	}
+
+	// seek info is regenerated for streams made of frames, so at first only space for it is reserved
+	seekPos := make(map[[4]byte]int64)
+	seekOffsets := map[[4]byte][]int64{
+		_SFV: make([]int64, 0),
+		_ALP: make([]int64, 0),
+	}
 
 	var pos int64
 	n, err := WriteChunk(s.CRID, seeker)
@@ -164,31 +333,35 @@ func (s *USMInfo) WriteTo(seeker io.WriteSeeker) error {
 	}
 	pos += n
 
-	for i := 0; i < len(s.HDRInfo); i++ {
-		n, err = WriteChunk(s.HDRInfo[customOrder[i]], seeker)
+	headerIDs := writeOrder(s.HDRInfo)
+	for _, id := range headerIDs {
+		n, err = WriteChunk(s.HDRInfo[id], seeker)
 		if err != nil {
 			return err
 		}
 		pos += n
 	}
-	for i := 0; i < len(s.HDRInfo); i++ {
-		n, err = WriteChunk(HeaderEndChunk(customOrder[i]), seeker)
+	for _, id := range headerIDs {
+		n, err = WriteChunk(HeaderEndChunk(id), seeker)
 		if err != nil {
 			return err
 		}
 		pos += n
 	}
 
-	for i := 0; i < len(s.Metadata); i++ {
-		id := customOrder[i]
+	metadataIDs := writeOrder(s.Metadata)
+	for _, id := range metadataIDs {
+		if _, ok := seekOffsets[id]; ok && countFrames(s.framesOf(id)) > 0 {
+			// skip seek data for now
+			seekPos[id] = pos
 
-		if id == _SFV {
-			// skip video seek data for now
-			videoSeekPos = pos
+			var size int64
+			size, err = s.getSizeForSeek(id)
+			if err != nil {
+				return err
+			}
 
-			// we need 12 (0xC) bytes per each video entry + 144 (0x90) bytes for other data
-			pos, err = seeker.Seek(getSizeForVideoSeek(len(s.VideoStreams)), io.SeekCurrent)
-			//pos, err = seeker.Seek(int64(s.Metadata[id].Header.Size+8), io.SeekCurrent)
+			pos, err = seeker.Seek(size, io.SeekCurrent)
 			if err != nil {
 				return err
 			}
@@ -201,36 +374,27 @@ func (s *USMInfo) WriteTo(seeker io.WriteSeeker) error {
 		}
 		pos += n
 	}
-	for i := 0; i < len(s.Metadata); i++ {
-		n, err = WriteChunk(MetadataEndChunk(customOrder[i]), seeker)
+	for _, id := range metadataIDs {
+		n, err = WriteChunk(MetadataEndChunk(id), seeker)
 		if err != nil {
 			return err
 		}
 		pos += n
 	}
 
-	var c Chunk
-	// write first video chunk
-	c, s.VideoStreams = pop(s.VideoStreams)
+	// write first video chunk, the movie itself is left as is, so it can be written again
+	c, video := pop(s.VideoStreams)
 	n, err = WriteChunk(c, seeker)
 	if err != nil {
 		return err
 	}
 
-	videoOffsets = append(videoOffsets, pos)
+	seekOffsets[_SFV] = append(seekOffsets[_SFV], pos)
 	pos += n
 
-	// some files might not have audio
-	if len(s.AudioStreams) > 2 {
-		// then write 2 audio chunks (HCA header + 1st chunk)
-		c, s.AudioStreams = pop(s.AudioStreams)
-		n, err = WriteChunk(c, seeker)
-		if err != nil {
-			return err
-		}
-		pos += n
-
-		c, s.AudioStreams = pop(s.AudioStreams)
+	// then write audio headers (HCA or ADX) and 1st audio chunk, some files might not have audio
+	leading, audio := s.leadingAudio()
+	for _, c = range leading {
 		n, err = WriteChunk(c, seeker)
 		if err != nil {
 			return err
@@ -240,8 +404,11 @@ func (s *USMInfo) WriteTo(seeker io.WriteSeeker) error {
 
 	// After this write chunks based on their frame time
 
-	chunks := append(s.VideoStreams, s.AudioStreams...)
+	chunks := append(append([]Chunk{}, video...), s.AlphaStreams...)
+	chunks = append(chunks, audio...)
 	chunks = append(chunks, s.SubtitleStreams...)
+	chunks = append(chunks, s.CueStreams...)
+	chunks = append(chunks, s.UnknownStreams...)
 
 	sort.SliceStable(chunks, func(i, j int) bool {
 		iFrame := chunks[i].Data.PayloadHeader.FrameTime
@@ -264,15 +431,26 @@ func (s *USMInfo) WriteTo(seeker io.WriteSeeker) error {
 		return iFrame < jFrame
 	})
 
+	p := Progress{File: fileName(seeker), Bytes: pos, TotalBytes: pos, TotalChunks: len(chunks)}
+	for _, c = range chunks {
+		// 8 is the size of chunkHeader
+		p.TotalBytes += int64(c.Header.Size) + 8
+	}
+	progress.report(p)
+
 	for _, c = range chunks {
+		if err = checkContext(ctx); err != nil {
+			return err
+		}
+
 		if c.Data.PayloadHeader.PayloadType == PayloadTypeEnd {
 			c.Data.PayloadHeader.FrameTime = 0x00
 			c.Data.PayloadHeader.FrameRate = 0x1e
 		}
 
-		if c.Header.ID == _SFV {
-			// store offsets for video chunks
-			videoOffsets = append(videoOffsets, pos)
+		if _, ok := seekOffsets[c.Header.ID]; ok && c.Data.PayloadHeader.PayloadType == PayloadTypeStream {
+			// store offsets for video and alpha chunks, CONTENTS END is not a frame
+			seekOffsets[c.Header.ID] = append(seekOffsets[c.Header.ID], pos)
 		}
 
 		n, err = WriteChunk(c, seeker)
@@ -281,59 +459,127 @@ func (s *USMInfo) WriteTo(seeker io.WriteSeeker) error {
 		}
 		pos += n
 
+		p.Bytes, p.Chunks = pos, p.Chunks+1
+		progress.report(p)
 	}
 
-	c, err = generateVideoSeek(videoOffsets)
-	if err != nil {
+	// now fill space reserved for seek info
+	for _, id := range metadataIDs {
+		p, ok := seekPos[id]
+		if !ok {
+			continue
+		}
+
+		c, err = generateSeek(id, s.seekName(id), seekOffsets[id])
+		if err != nil {
+			return err
+		}
+
+		_, err = seeker.Seek(p, io.SeekStart)
+		if err != nil {
+			return err
+		}
+
+		_, err = WriteChunk(c, seeker)
+		if err != nil {
+			return err
+		}
+	}
+
+	// size of the whole file is known only now, CRID keeps its size, so it's written over the old one.
+	// The movie itself keeps its CRID, so writing it again gives the same file
+	crid, changed, err := cridWithFileSize(s.CRID, pos)
+	if err != nil || !changed {
 		return err
 	}
 
-	_, err = seeker.Seek(videoSeekPos, io.SeekStart)
-	if err != nil {
+	if _, err = seeker.Seek(0, io.SeekStart); err != nil {
 		return err
 	}
+	_, err = WriteChunk(crid, seeker)
 
-	_, err = WriteChunk(c, seeker)
+	return err
+}
+
+// framesOf returns streams of the type which has seek info
+func (s *USMInfo) framesOf(id [4]byte) []Chunk {
+	if id == _ALP {
+		return s.AlphaStreams
+	}
+
+	return s.VideoStreams
+}
+
+// seekName returns name of seek info table from the source file
+func (s *USMInfo) seekName(id [4]byte) string {
+	if name, _, err := s.Metadata[id].Table(); err == nil && name != "" {
+		return name
+	}
+
+	return "VIDEO_SEEKINFO"
+}
+
+// getSizeForSeek calculates size of seek info chunk which will be generated for stream
+func (s *USMInfo) getSizeForSeek(id [4]byte) (int64, error) {
+	// actual offsets don't matter, they all take the same space
+	c, err := generateSeek(id, s.seekName(id), make([]int64, countFrames(s.framesOf(id))))
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	// 8 is the size of chunkHeader
+	return int64(c.Header.Size) + 8, nil
 }
 
-func getSizeForVideoSeek(videos int) int64 {
-	c := int64(videos / 30)
-	// weird way to implement math.Ceil
-	if videos%30 != 0 {
-		c += 1
+// countFrames returns amount of stream chunks, without end markers
+func countFrames(src []Chunk) (n int) {
+	for _, c := range src {
+		if c.Data.PayloadHeader.PayloadType == PayloadTypeStream {
+			n++
+		}
 	}
 
-	// 0x8 chunk start
-	// 0x18 payloadHeader
-	// 0x8 payload start
-	// 0x18 subtitle header
-	// 0x18 shared array
-	// count * 0xC - unique array
-	// 0x38 string array
-	// 0x0 byte array
-	// = 0x90 + unique array in total
-	size := 0xC*c + 0x90
+	return n
+}
+
+// writeOrder returns ids present in m in the order they should be written.
+// Unknown ids go after known ones, in the order they were in the source file
+func writeOrder(m map[[4]byte]Chunk) [][4]byte {
+	result := make([][4]byte, 0, len(m))
+	known := make(map[[4]byte]bool, len(customOrder))
+	for i := 0; i < len(customOrder); i++ {
+		known[customOrder[i]] = true
+		if _, ok := m[customOrder[i]]; ok {
+			result = append(result, customOrder[i])
+		}
+	}
 
-	if remainder := size % 0x10; remainder != 0 {
-		size += 0x10 - remainder
+	unknown := make([][4]byte, 0)
+	for id := range m {
+		if !known[id] {
+			unknown = append(unknown, id)
+		}
 	}
 
-	return size
+	sort.Slice(unknown, func(i, j int) bool {
+		if m[unknown[i]].offset != m[unknown[j]].offset {
+			return m[unknown[i]].offset < m[unknown[j]].offset
+		}
+		return bytes.Compare(unknown[i][:], unknown[j][:]) < 0
+	})
+
+	return append(result, unknown...)
 }
 
 func pop(src []Chunk) (Chunk, []Chunk) {
 	return src[0], src[1:]
 }
 
-func generateVideoSeek(videoOffsets []int64) (Chunk, error) {
+// generateSeek makes seek info for video or alpha stream, with entry for every 30th frame
+func generateSeek(id [4]byte, name string, offsets []int64) (Chunk, error) {
 	c := Chunk{
 		Header: Header{
-			ID: _SFV,
+			ID: id,
 			//Size: 0,
 		},
 		Data: Data{
@@ -351,7 +597,7 @@ func generateVideoSeek(videoOffsets []int64) (Chunk, error) {
 
 	data := make([][]Entry, 0)
 
-	for k, v := range videoOffsets {
+	for k, v := range offsets {
 		if k != 0 && k%30 != 0 {
 			continue
 		}
@@ -371,29 +617,7 @@ func generateVideoSeek(videoOffsets []int64) (Chunk, error) {
 		data = append(data, el)
 	}
 
-	payloadContent := compressDict("VIDEO_SEEKINFO", data)
-
-	if remainder := (payloadContent.Size() + 8) % 0x10; remainder != 0 {
-		c.Data.PayloadHeader.PaddingSize = uint16(0x10 - remainder)
-	}
-
-	compressedPayload, err := compressPayload(Payload{
-		Header:      Header{ID: _UTF, Size: int32(payloadContent.Size())},
-		PayloadData: payloadContent,
-	})
-
-	if err != nil {
-		return Chunk{}, fmt.Errorf("can't compress payload: %w", err)
-	}
-
-	c.Data.Payload = compressedPayload
-
-	c.Header.Size = int32(payloadContent.Size()) +
-		int32(c.Data.PayloadHeader.PaddingSize) +
-		8 + // UTF header inside payload
-		24 // 24 - PayloadHeader
-
-	return c, nil
+	return makeTableChunk(c, name, data)
 }
 
 func ContentsEndChunk(id [4]byte) Chunk {
@@ -431,8 +655,19 @@ func makeEndChunk(id [4]byte, content []byte) Chunk {
 func ReplaceAudio(in1, in2 *USMInfo) *USMInfo {
 
 	// ignore CRID for now kek
-	in1.HDRInfo[_SFA] = in2.HDRInfo[_SFA]
-	in1.Metadata[_SFA] = in2.Metadata[_SFA]
+	// header info holds codec of the stream, so it always goes together with audio
+	if hdr, ok := in2.HDRInfo[_SFA]; ok {
+		in1.HDRInfo[_SFA] = hdr
+	} else {
+		delete(in1.HDRInfo, _SFA)
+	}
+
+	if meta, ok := in2.Metadata[_SFA]; ok {
+		in1.Metadata[_SFA] = meta
+	} else {
+		delete(in1.Metadata, _SFA)
+	}
+
 	in1.AudioStreams = in2.AudioStreams
 
 	return in1
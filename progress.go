@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// Progress describes how far long operation has got
+type Progress struct {
+	// File being processed, empty if it has no name
+	File string
+	// Bytes processed so far, TotalBytes is 0 if size isn't known in advance
+	Bytes, TotalBytes int64
+	// Chunks processed so far, TotalChunks is 0 if amount isn't known in advance
+	Chunks, TotalChunks int
+}
+
+// ProgressFunc is called by long operations after every processed chunk
+type ProgressFunc func(Progress)
+
+// report calls progress if it's set
+func (f ProgressFunc) report(p Progress) {
+	if f != nil {
+		f(p)
+	}
+}
+
+// fileName returns name of file behind reader or writer, if it has one
+func fileName(v interface{}) string {
+	if f, ok := v.(interface{ Name() string }); ok {
+		return f.Name()
+	}
+
+	return ""
+}
+
+// fileSize returns size of file behind reader, or 0 if it's not a file
+func fileSize(r io.Reader) int64 {
+	f, ok := r.(*os.File)
+	if !ok {
+		return 0
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		return 0
+	}
+
+	return stat.Size()
+}
+
+// checkContext returns error of ctx if it's done, so long loops can stop
+func checkContext(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Reader indexes USM file in one pass, recording offset and headers of every chunk.
+// Payloads are read on demand, so even huge files can be processed with bounded memory
+type Reader struct {
+	src  io.ReaderAt
+	size int64
+
+	chunks []Chunk
+	// report is filled only by lenient reader
+	report RecoveryReport
+}
+
+// NewReader walks through src and builds index of all its chunks
+func NewReader(src io.ReaderAt, size int64) (*Reader, error) {
+	return NewReaderContext(context.Background(), src, size, nil)
+}
+
+// NewReaderContext is NewReader which stops when ctx is done and reports progress after every indexed chunk
+func NewReaderContext(ctx context.Context, src io.ReaderAt, size int64, progress ProgressFunc) (*Reader, error) {
+	r := &Reader{src: src, size: size}
+	p := Progress{File: fileName(src), TotalBytes: size}
+
+	var pos int64
+	for pos < size {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+
+		c, err := r.readChunkHeaders(pos)
+		if err != nil {
+			return nil, fmt.Errorf("read chunk: %w", err)
+		}
+
+		r.chunks = append(r.chunks, c)
+		// 8 is the size of chunkHeader
+		pos += int64(c.Header.Size) + 8
+
+		p.Bytes, p.Chunks = pos, len(r.chunks)
+		progress.report(p)
+	}
+
+	return r, nil
+}
+
+// NewFileReader is a shortcut to index opened file.
+// File should stay open while Reader or chunks obtained from it are in use
+func NewFileReader(f *os.File) (*Reader, error) {
+	return NewFileReaderContext(context.Background(), f, nil)
+}
+
+// NewFileReaderContext is NewFileReader which stops when ctx is done and reports progress
+func NewFileReaderContext(ctx context.Context, f *os.File, progress ProgressFunc) (*Reader, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewReaderContext(ctx, f, stat.Size(), progress)
+}
+
+func (r *Reader) readChunkHeaders(pos int64) (result Chunk, err error) {
+	src := io.NewSectionReader(r.src, pos, r.size-pos)
+
+	result.offset = int(pos)
+	result.src = r.src
+
+	if err = readStruct(src, binary.BigEndian, &result.Header); err != nil {
+		return result, locate(err, pos, [4]byte{})
+	}
+
+	if !isValidID(result.Header.ID) {
+		return result, &ErrUnknownChunkID{Offset: pos, ChunkID: result.Header.ID}
+	}
+
+	// whole chunk should fit into the file
+	if available := r.size - pos; int64(result.Header.Size)+8 > available {
+		return result, &ErrTruncatedChunk{
+			Offset:   pos,
+			ChunkID:  result.Header.ID,
+			Expected: int(result.Header.Size) + 8,
+			Actual:   int(available),
+		}
+	}
+
+	if err = readStruct(src, binary.BigEndian, &result.Data.PayloadHeader); err != nil {
+		// chunk is smaller than payload header
+		return result, &ErrBadChunkSize{Offset: pos, ChunkID: result.Header.ID, Size: result.Header.Size}
+	}
+
+	if err = checkSizes(result.Header, result.Data.PayloadHeader); err != nil {
+		return result, locate(err, pos, result.Header.ID)
+	}
+
+	return result, nil
+}
+
+// Size returns size of the indexed file
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+// Len returns amount of chunks in the file
+func (r *Reader) Len() int {
+	return len(r.chunks)
+}
+
+// Chunks returns all indexed chunks, without payloads loaded
+func (r *Reader) Chunks() []Chunk {
+	return r.chunks
+}
+
+// Chunk returns i-th chunk of the file with its payload
+func (r *Reader) Chunk(i int) (Chunk, error) {
+	return r.chunks[i].Load()
+}
+
+// Info builds USMInfo from indexed chunks.
+// Video, alpha, audio and unknown stream chunks are left unloaded and will be read from source during writing,
+// everything else (headers, metadata, subtitles, cue points) is small enough to be kept in memory
+func (r *Reader) Info() (*USMInfo, error) {
+	result := newUSMInfo()
+
+	for _, c := range r.chunks {
+		isStream := c.Data.PayloadHeader.PayloadType == PayloadTypeStream
+		if !isStream || c.Header.ID == _SBT || c.Header.ID == _CUE {
+			var err error
+			c, err = c.Load()
+			if err != nil {
+				return nil, fmt.Errorf("read chunk at %#x: %w", c.offset, err)
+			}
+		}
+
+		result.add(c)
+	}
+
+	return result, nil
+}
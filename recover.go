@@ -0,0 +1,233 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// chunkSignatures are ids of chunks this package knows, after damaged part of the file
+// chunks with them are trusted more than ones with ids which are only valid
+var chunkSignatures = [][4]byte{
+	CRID,
+	_SFV,
+	_SFA,
+	_SBT,
+	_ALP,
+	_CUE,
+	_USR,
+}
+
+// SkippedRange is a part of the file dropped during recovery
+type SkippedRange struct {
+	Start int64
+	End   int64
+	// Reason is an error which caused this range to be skipped
+	Reason error
+}
+
+func (r SkippedRange) String() string {
+	return fmt.Sprintf("%#x-%#x (%d bytes): %s", r.Start, r.End, r.End-r.Start, r.Reason)
+}
+
+// RecoveryReport lists everything which was dropped while reading damaged file
+type RecoveryReport struct {
+	Skipped []SkippedRange
+}
+
+// SkippedBytes returns total size of skipped ranges
+func (r RecoveryReport) SkippedBytes() (total int64) {
+	for _, s := range r.Skipped {
+		total += s.End - s.Start
+	}
+
+	return total
+}
+
+func (r RecoveryReport) String() string {
+	if len(r.Skipped) == 0 {
+		return "file is intact"
+	}
+
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "skipped %d bytes in %d ranges:", r.SkippedBytes(), len(r.Skipped))
+	for _, s := range r.Skipped {
+		b.WriteString("\n\t")
+		b.WriteString(s.String())
+	}
+
+	return b.String()
+}
+
+// NewLenientReader works like NewReader, but doesn't stop at damaged chunks.
+// Instead, it scans forward for the next valid chunk signature and records skipped bytes in Reader.Report
+func NewLenientReader(src io.ReaderAt, size int64) (*Reader, error) {
+	r := &Reader{src: src, size: size}
+
+	var pos int64
+	for pos < size {
+		c, err := r.readChunkHeaders(pos)
+		if err == nil {
+			err = checkPlausible(c)
+		}
+
+		if err != nil {
+			next, scanErr := r.findNextChunk(pos + 1)
+			if scanErr != nil {
+				return nil, fmt.Errorf("scan for next chunk: %w", scanErr)
+			}
+
+			r.report.Skipped = append(r.report.Skipped, SkippedRange{Start: pos, End: next, Reason: err})
+			pos = next
+			continue
+		}
+
+		r.chunks = append(r.chunks, c)
+		// 8 is the size of chunkHeader
+		pos += int64(c.Header.Size) + 8
+	}
+
+	return r, nil
+}
+
+// NewLenientFileReader is a shortcut to index opened damaged file
+func NewLenientFileReader(f *os.File) (*Reader, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLenientReader(f, stat.Size())
+}
+
+// Report returns list of ranges skipped by lenient reader. It's always empty for Reader made by NewReader
+func (r *Reader) Report() RecoveryReport {
+	return r.report
+}
+
+// checkPlausible does additional checks for chunk headers, so random bytes looking like chunk signature
+// are not mistaken for actual chunk. Id and size fitting into the file are already checked by readChunkHeaders,
+// any valid id is accepted, as files may have chunks this package doesn't know
+func checkPlausible(c Chunk) error {
+	if int(c.Data.PayloadHeader.Offset) != c.Data.PayloadHeader.Len() ||
+		c.Data.PayloadHeader.PayloadType > PayloadTypeSeek {
+		return &ErrBadChunkSize{
+			Offset:      int64(c.offset),
+			ChunkID:     c.Header.ID,
+			Size:        c.Header.Size,
+			PaddingSize: c.Data.PayloadHeader.PaddingSize,
+		}
+	}
+
+	return nil
+}
+
+// findNextChunk returns offset of the next valid chunk starting from pos or size of the file if there is none.
+// Chunk with known id is taken right away, unknown one only if another chunk or end of the file follows it.
+// Otherwise the first unknown chunk is used when there's nothing better till the end of the file
+func (r *Reader) findNextChunk(pos int64) (int64, error) {
+	const bufSize = 64 * 1024
+
+	fallback := int64(-1)
+	buf := make([]byte, bufSize)
+	for pos < r.size {
+		n, err := r.src.ReadAt(buf, pos)
+		if n == 0 && err != nil {
+			if err == io.EOF {
+				break
+			}
+			return 0, err
+		}
+
+		for i := 0; i < n; i++ {
+			if buf[i] != '@' && buf[i] != 'C' {
+				continue
+			}
+
+			candidate := pos + int64(i)
+			if n-i >= 4 {
+				if !hasSignature(buf[i:n]) {
+					continue
+				}
+			} else if !r.hasSignatureAt(candidate) {
+				// signature is split between two reads
+				continue
+			}
+
+			c, err := r.readChunkHeaders(candidate)
+			if err != nil || checkPlausible(c) != nil {
+				continue
+			}
+
+			if isKnownID(c.Header.ID) || r.isFollowed(c) {
+				return candidate, nil
+			}
+			if fallback < 0 {
+				fallback = candidate
+			}
+		}
+
+		pos += int64(n)
+	}
+
+	if fallback >= 0 {
+		return fallback, nil
+	}
+
+	return r.size, nil
+}
+
+// isFollowed checks if another plausible chunk or end of the file goes right after c
+func (r *Reader) isFollowed(c Chunk) bool {
+	// 8 is the size of chunkHeader
+	next := int64(c.offset) + int64(c.Header.Size) + 8
+	if next == r.size {
+		return true
+	}
+
+	nextChunk, err := r.readChunkHeaders(next)
+	return err == nil && checkPlausible(nextChunk) == nil
+}
+
+func (r *Reader) hasSignatureAt(pos int64) bool {
+	id := make([]byte, 4)
+	if n, _ := r.src.ReadAt(id, pos); n != len(id) {
+		return false
+	}
+
+	return hasSignature(id)
+}
+
+// hasSignature checks if b starts with valid chunk id
+func hasSignature(b []byte) bool {
+	var id [4]byte
+	if len(b) < len(id) {
+		return false
+	}
+	copy(id[:], b)
+
+	return isValidID(id)
+}
+
+func isKnownID(id [4]byte) bool {
+	for _, known := range chunkSignatures {
+		if id == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseFileLenient reads damaged file, skipping chunks which can't be read.
+// Unlike ParseFile, stream payloads are not loaded into memory, so src should stay open while result is in use
+func ParseFileLenient(src *os.File) (*USMInfo, RecoveryReport, error) {
+	r, err := NewLenientFileReader(src)
+	if err != nil {
+		return nil, RecoveryReport{}, err
+	}
+
+	info, err := r.Info()
+	return info, r.Report(), err
+}
@@ -0,0 +1,106 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLenientReader(t *testing.T) {
+	xyz := [4]byte{'@', 'X', 'Y', 'Z'}
+	chunk := func(id [4]byte, frame int32) Chunk {
+		return makeStreamChunk(id, 0, frame, 3000, bytes.Repeat([]byte{byte(frame)}, 20))
+	}
+	garbage := bytes.Repeat([]byte{0x11, 0x22, 0x33, 0x44}, 8)
+
+	// start of unknown chunk, which is plausible by itself, but isn't followed by another chunk
+	var partial bytes.Buffer
+	if _, err := WriteChunk(chunk(xyz, 1), &partial); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// chunks and damaged parts of the file, in order
+		parts []interface{}
+		ids   [][4]byte
+		// offsets of skipped ranges
+		skipped [][2]int64
+	}{
+		{
+			name:  "unknown chunk is kept",
+			parts: []interface{}{chunk(_SFV, 0), chunk(xyz, 1), chunk(_SFV, 2)},
+			ids:   [][4]byte{_SFV, xyz, _SFV},
+		},
+		{
+			name:    "resync at known chunk",
+			parts:   []interface{}{chunk(_SFV, 0), garbage, chunk(_SFA, 1)},
+			ids:     [][4]byte{_SFV, _SFA},
+			skipped: [][2]int64{{0x40, 0x60}},
+		},
+		{
+			name:    "resync at unknown chunk followed by another one",
+			parts:   []interface{}{chunk(_SFV, 0), garbage, chunk(xyz, 1), chunk(_SFV, 2)},
+			ids:     [][4]byte{_SFV, xyz, _SFV},
+			skipped: [][2]int64{{0x40, 0x60}},
+		},
+		{
+			name:    "resync at unknown chunk at the end",
+			parts:   []interface{}{chunk(_SFV, 0), garbage, chunk(xyz, 1)},
+			ids:     [][4]byte{_SFV, xyz},
+			skipped: [][2]int64{{0x40, 0x60}},
+		},
+		{
+			name:    "known chunk is preferred to unknown one which isn't followed by a chunk",
+			parts:   []interface{}{chunk(_SFV, 0), garbage, partial.Bytes()[:0x20], chunk(_SFA, 2)},
+			ids:     [][4]byte{_SFV, _SFA},
+			skipped: [][2]int64{{0x40, 0x80}},
+		},
+		{
+			name:    "truncated chunk at the end",
+			parts:   []interface{}{chunk(_SFV, 0), chunk(xyz, 1), garbage[:8]},
+			ids:     [][4]byte{_SFV, xyz},
+			skipped: [][2]int64{{0x80, 0x88}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			for _, part := range tt.parts {
+				switch p := part.(type) {
+				case Chunk:
+					if _, err := WriteChunk(p, &b); err != nil {
+						t.Fatal(err)
+					}
+				case []byte:
+					b.Write(p)
+				}
+			}
+
+			r, err := NewLenientReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			chunks := r.Chunks()
+			if len(chunks) != len(tt.ids) {
+				t.Fatalf("got %d chunks, expected %d", len(chunks), len(tt.ids))
+			}
+			for i, c := range chunks {
+				if c.Header.ID != tt.ids[i] {
+					t.Fatalf("chunk %d is %s, expected %s", i, idToString(c.Header.ID), idToString(tt.ids[i]))
+				}
+			}
+
+			skipped := r.Report().Skipped
+			if len(skipped) != len(tt.skipped) {
+				t.Fatalf("got %d skipped ranges, expected %d: %s", len(skipped), len(tt.skipped), r.Report())
+			}
+			for i, s := range skipped {
+				if s.Start != tt.skipped[i][0] || s.End != tt.skipped[i][1] {
+					t.Fatalf("skipped %#x-%#x, expected %#x-%#x", s.Start, s.End, tt.skipped[i][0], tt.skipped[i][1])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Split divides movie into standalone parts at provided times in seconds.
+// Every part starts from the keyframe nearest to its time, times which end up
+// at the same keyframe make one part. The movie itself is left as is.
+// Returns parts together with times they start from in the movie
+func (s *USMInfo) Split(points []float64) ([]*USMInfo, []float64, error) {
+	keyframes, err := s.keyframes(math.Inf(1))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(keyframes) == 0 {
+		return nil, nil, errors.New("video has no keyframes")
+	}
+
+	starts := []float64{keyframes[0]}
+	sorted := append([]float64{}, points...)
+	sort.Float64s(sorted)
+
+	for _, t := range sorted {
+		// the nearest keyframe, so parts keep about the same length as requested
+		i := sort.SearchFloat64s(keyframes, t)
+		if i == len(keyframes) || (i > 0 && t-keyframes[i-1] < keyframes[i]-t) {
+			i--
+		}
+
+		if keyframes[i] > starts[len(starts)-1] {
+			starts = append(starts, keyframes[i])
+		}
+	}
+
+	parts := make([]*USMInfo, 0, len(starts))
+	for i, start := range starts {
+		// the last part keeps everything till the end
+		var end float64
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+
+		part := s.clone()
+		if _, err := part.Cut(start, end); err != nil {
+			return nil, nil, fmt.Errorf("part %d: %w", i+1, err)
+		}
+
+		parts = append(parts, part)
+	}
+
+	return parts, starts, nil
+}
+
+// SplitEvery divides movie into parts of about provided length in seconds, see Split
+func (s *USMInfo) SplitEvery(length float64) ([]*USMInfo, []float64, error) {
+	if length <= 0 {
+		return nil, nil, errors.New("length of parts should be positive")
+	}
+
+	if len(s.VideoStreams) == 0 {
+		return nil, nil, errors.New("no video streams")
+	}
+
+	video, err := s.summarizeStream(keyOf(s.VideoStreams[0]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't read video: %w", err)
+	}
+
+	points := make([]float64, 0)
+	// the last part shorter than half of the length goes together with the previous one
+	for t := length; t+length/2 < video.Duration; t += length {
+		points = append(points, t)
+	}
+
+	return s.Split(points)
+}
+
+// clone makes copy of the movie which can be changed without touching the original.
+// Chunks are copied by value, their payloads are shared, since editing always makes new ones
+func (s *USMInfo) clone() *USMInfo {
+	result := *s
+
+	result.HDRInfo = make(map[[4]byte]Chunk, len(s.HDRInfo))
+	for id, c := range s.HDRInfo {
+		result.HDRInfo[id] = c
+	}
+
+	result.Metadata = make(map[[4]byte]Chunk, len(s.Metadata))
+	for id, c := range s.Metadata {
+		result.Metadata[id] = c
+	}
+
+	result.AudioStreams = append([]Chunk{}, s.AudioStreams...)
+	result.VideoStreams = append([]Chunk{}, s.VideoStreams...)
+	result.AlphaStreams = append([]Chunk{}, s.AlphaStreams...)
+	result.SubtitleStreams = append([]Chunk{}, s.SubtitleStreams...)
+	result.CueStreams = append([]Chunk{}, s.CueStreams...)
+	result.UnknownStreams = append([]Chunk{}, s.UnknownStreams...)
+	result.EndChunks = append([]Chunk{}, s.EndChunks...)
+
+	return &result
+}
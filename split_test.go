@@ -0,0 +1,79 @@
+package parser
+
+import "testing"
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []float64
+		// first frames of parts
+		starts []int
+	}{
+		{name: "nearest keyframes", points: []float64{0.9, 1.2}, starts: []int{0, 30, 40}},
+		{name: "same keyframe", points: []float64{0.3, 0.4}, starts: []int{0, 10}},
+		{name: "unsorted", points: []float64{1.7, 0.6}, starts: []int{0, 20, 50}},
+		{name: "at the start", points: []float64{0.1}, starts: []int{0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testMovie(t)
+
+			parts, starts, err := s.Split(tt.points)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkParts(t, parts, starts, tt.starts)
+
+			// movie itself is left as is
+			checkFrames(t, s, 0, testFrames)
+		})
+	}
+}
+
+func TestSplitEvery(t *testing.T) {
+	tests := []struct {
+		name   string
+		length float64
+		starts []int
+	}{
+		{name: "nearest keyframes", length: 0.4, starts: []int{0, 10, 20, 40, 50}},
+		{name: "short last part is joined", length: 0.7, starts: []int{0, 20, 40}},
+		{name: "longer than movie", length: 3, starts: []int{0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, starts, err := testMovie(t).SplitEvery(tt.length)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkParts(t, parts, starts, tt.starts)
+		})
+	}
+
+	if _, _, err := testMovie(t).SplitEvery(0); err == nil {
+		t.Fatal("expected error for zero length")
+	}
+}
+
+// checkParts checks that parts start from expected frames and every one of them lasts till the next
+func checkParts(t *testing.T, parts []*USMInfo, starts []float64, expected []int) {
+	t.Helper()
+
+	if len(parts) != len(expected) {
+		t.Fatalf("got %d parts, expected %d", len(parts), len(expected))
+	}
+
+	for i, part := range parts {
+		end := testFrames
+		if i+1 < len(expected) {
+			end = expected[i+1]
+		}
+
+		if start := float64(expected[i]) / 30; starts[i] != start {
+			t.Fatalf("part %d starts at %g, expected %g", i+1, starts[i], start)
+		}
+		checkFrames(t, part, expected[i], end-expected[i])
+	}
+}
@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// streamKey identifies single stream inside the file
+type streamKey struct {
+	ID      [4]byte
+	Channel byte
+}
+
+func (k streamKey) String() string {
+	return fmt.Sprintf("%s#%d", idToString(k.ID), k.Channel)
+}
+
+func keyOf(c Chunk) streamKey {
+	return streamKey{c.Header.ID, c.Data.PayloadHeader.ChannelNumber}
+}
+
+// allChunks returns every chunk from info in the order they were in the source file
+func (s *USMInfo) allChunks() []Chunk {
+	result := make([]Chunk, 0)
+	if s.CRID.Header.ID == CRID {
+		result = append(result, s.CRID)
+	}
+	for _, c := range s.HDRInfo {
+		result = append(result, c)
+	}
+	for _, c := range s.Metadata {
+		result = append(result, c)
+	}
+	result = append(result, s.EndChunks...)
+	result = append(result, s.streams()...)
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].offset < result[j].offset
+	})
+
+	return result
+}
+
+// streams returns stream chunks of every type, including unknown ones
+func (s *USMInfo) streams() []Chunk {
+	return append(s.knownStreams(), s.UnknownStreams...)
+}
+
+// knownStreams returns stream chunks of types this package understands
+func (s *USMInfo) knownStreams() []Chunk {
+	result := make([]Chunk, 0,
+		len(s.VideoStreams)+len(s.AlphaStreams)+len(s.AudioStreams)+len(s.SubtitleStreams)+len(s.CueStreams))
+	result = append(result, s.VideoStreams...)
+	result = append(result, s.AlphaStreams...)
+	result = append(result, s.AudioStreams...)
+	result = append(result, s.SubtitleStreams...)
+	result = append(result, s.CueStreams...)
+
+	return result
+}
+
+// streamKeys returns sorted list of streams chunks belong to
+func streamKeys(chunks []Chunk) []streamKey {
+	seen := make(map[streamKey]bool)
+	for _, c := range chunks {
+		seen[keyOf(c)] = true
+	}
+
+	return sortedKeys(seen)
+}
+
+func sortedKeys(m map[streamKey]bool) []streamKey {
+	result := make([]streamKey, 0, len(m))
+	for key := range m {
+		result = append(result, key)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ID != result[j].ID {
+			return bytes.Compare(result[i].ID[:], result[j].ID[:]) < 0
+		}
+		return result[i].Channel < result[j].Channel
+	})
+
+	return result
+}
+
+func sortedIDs(m map[[4]byte]Chunk) [][4]byte {
+	result := make([][4]byte, 0, len(m))
+	for id := range m {
+		result = append(result, id)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return bytes.Compare(result[i][:], result[j][:]) < 0
+	})
+
+	return result
+}
+
+func keysOf(m map[streamKey][]Chunk) map[streamKey]bool {
+	result := make(map[streamKey]bool, len(m))
+	for key := range m {
+		result[key] = true
+	}
+
+	return result
+}
@@ -0,0 +1,51 @@
+package parser
+
+import (
+	"errors"
+)
+
+// Strip removes stream of provided type with provided channel from the movie, or all streams of that type
+// when channel is negative. Header info goes together with the last stream of its type.
+// Video can't be removed, since movie can't be played without it
+func (s *USMInfo) Strip(id [4]byte, channel int) error {
+	var src *[]Chunk
+	switch id {
+	case _SFV:
+		return errors.New("video can't be removed")
+	case _ALP:
+		src = &s.AlphaStreams
+	case _SFA:
+		src = &s.AudioStreams
+	case _SBT:
+		src = &s.SubtitleStreams
+	case _CUE:
+		src = &s.CueStreams
+	default:
+		src = &s.UnknownStreams
+	}
+
+	result := make([]Chunk, 0, len(*src))
+	var left int
+	for _, c := range *src {
+		if c.Header.ID == id && (channel < 0 || int(c.Data.PayloadHeader.ChannelNumber) == channel) {
+			continue
+		}
+
+		if c.Header.ID == id {
+			left++
+		}
+		result = append(result, c)
+	}
+	*src = result
+
+	if left == 0 {
+		delete(s.HDRInfo, id)
+		delete(s.Metadata, id)
+	}
+
+	if err := s.updateCRID(); err != nil {
+		return err
+	}
+
+	return s.updateBitrates()
+}
@@ -24,9 +24,10 @@ const (
 func GetSubs(src io.Reader) (subs map[string][]Subtitle, err error) {
 	subs = make(map[string][]Subtitle, 0)
 
+	var pos int
 	for {
 		var c Chunk
-		c, err = ReadChunk(src, 0)
+		c, err = ReadChunk(src, pos)
 		if err != nil {
 			if err == io.EOF {
 				break
@@ -35,6 +36,9 @@ func GetSubs(src io.Reader) (subs map[string][]Subtitle, err error) {
 			}
 		}
 
+		// 8 is the size of chunkHeader
+		pos += int(c.Header.Size) + 8
+
 		if c.Header.IDString() != "@SBT" {
 			continue
 		}
@@ -46,10 +50,40 @@ func GetSubs(src io.Reader) (subs map[string][]Subtitle, err error) {
 
 		var sub Subtitle
 		sub, err = ReadSubtitleData(c.Data.Payload)
+		if err != nil {
+			err = locate(err, c.payloadOffset(), c.Header.ID)
+			return
+		}
+
+		subs[sub.SubtitleHeader.GetLang()] = append(subs[sub.SubtitleHeader.GetLang()], sub)
+	}
+
+	return subs, nil
+}
+
+// Subs reads subtitles the same way as GetSubs,
+// but loads only subtitle chunks instead of going through the whole file
+func (r *Reader) Subs() (subs map[string][]Subtitle, err error) {
+	subs = make(map[string][]Subtitle, 0)
+
+	for _, c := range r.chunks {
+		if c.Header.ID != _SBT || c.Data.PayloadHeader.PayloadType != PayloadTypeStream {
+			continue
+		}
+
+		var payload []byte
+		payload, err = c.ReadPayload()
 		if err != nil {
 			return
 		}
 
+		var sub Subtitle
+		sub, err = ReadSubtitleData(payload)
+		if err != nil {
+			err = locate(err, c.payloadOffset(), c.Header.ID)
+			return
+		}
+
 		subs[sub.SubtitleHeader.GetLang()] = append(subs[sub.SubtitleHeader.GetLang()], sub)
 	}
 
@@ -108,3 +142,31 @@ func parseTime(t uint32) string {
 
 	return fmt.Sprintf("%02d:%02d:%02d,%03d", h, m, s, ms)
 }
+
+// ReplaceSubtitles copies subtitles from in2 to in1, removing subtitles in1 had
+func ReplaceSubtitles(in1, in2 *USMInfo) (*USMInfo, error) {
+	if hdr, ok := in2.HDRInfo[_SBT]; ok {
+		in1.HDRInfo[_SBT] = hdr
+	} else {
+		delete(in1.HDRInfo, _SBT)
+	}
+
+	if meta, ok := in2.Metadata[_SBT]; ok {
+		in1.Metadata[_SBT] = meta
+	} else {
+		delete(in1.Metadata, _SBT)
+	}
+
+	in1.SubtitleStreams = make([]Chunk, 0, len(in2.SubtitleStreams))
+	for _, c := range in2.SubtitleStreams {
+		if c.Data.PayloadHeader.PayloadType == PayloadTypeStream {
+			in1.SubtitleStreams = append(in1.SubtitleStreams, c)
+		}
+	}
+
+	if err := in1.updateCRID(); err != nil {
+		return nil, err
+	}
+
+	return in1, in1.updateBitrates()
+}
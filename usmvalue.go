@@ -3,6 +3,7 @@ package parser
 import (
 	"encoding/binary"
 	"fmt"
+	"math"
 	"strings"
 )
 
@@ -148,3 +149,62 @@ func (e Entry) ToByte() byte {
 
 	return val
 }
+
+// Uint returns value of numeric entry as unsigned number
+func (e Entry) Uint() uint64 {
+	switch len(e.Value) {
+	case 1:
+		return uint64(e.Value[0])
+	case 2:
+		return uint64(binary.BigEndian.Uint16(e.Value))
+	case 4:
+		return uint64(binary.BigEndian.Uint32(e.Value))
+	case 8:
+		return binary.BigEndian.Uint64(e.Value)
+	}
+
+	return 0
+}
+
+// Int returns value of numeric entry, taking its sign into account
+func (e Entry) Int() int64 {
+	if strings.HasPrefix(e.Type.Name, "Unsigned") {
+		return int64(e.Uint())
+	}
+
+	switch len(e.Value) {
+	case 1:
+		return int64(int8(e.Value[0]))
+	case 2:
+		return int64(int16(binary.BigEndian.Uint16(e.Value)))
+	case 4:
+		return int64(int32(binary.BigEndian.Uint32(e.Value)))
+	case 8:
+		return int64(binary.BigEndian.Uint64(e.Value))
+	}
+
+	return 0
+}
+
+// Float returns value of any numeric entry as float
+func (e Entry) Float() float64 {
+	switch e.Type.Name {
+	case "Float":
+		return float64(math.Float32frombits(uint32(e.Uint())))
+	case "Double":
+		return math.Float64frombits(e.Uint())
+	}
+
+	return float64(e.Int())
+}
+
+// GetEntry looks for entry with provided key in a row of @UTF table
+func GetEntry(row []Entry, key string) (Entry, bool) {
+	for _, e := range row {
+		if e.Key == key {
+			return e, true
+		}
+	}
+
+	return Entry{}, false
+}
@@ -0,0 +1,349 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type Severity int
+
+const (
+	SeverityWarning Severity = iota
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+
+	return "warning"
+}
+
+// Issue is a single problem found by Validate
+type Issue struct {
+	Severity Severity
+	// Offset of the chunk in file, -1 if issue isn't related to specific chunk
+	Offset  int64
+	ChunkID [4]byte
+	Message string
+}
+
+func (i Issue) String() string {
+	if i.Offset < 0 {
+		return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+	}
+
+	return fmt.Sprintf("%s: %s at %#x: %s", i.Severity, idToString(i.ChunkID), i.Offset, i.Message)
+}
+
+// ValidationReport lists all issues found in a file
+type ValidationReport struct {
+	Issues []Issue
+}
+
+// HasErrors reports whether file has issues which make it invalid
+func (r ValidationReport) HasErrors() bool {
+	for _, i := range r.Issues {
+		if i.Severity == SeverityError {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r ValidationReport) String() string {
+	if len(r.Issues) == 0 {
+		return "no issues found"
+	}
+
+	lines := make([]string, 0, len(r.Issues))
+	for _, i := range r.Issues {
+		lines = append(lines, i.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (r *ValidationReport) add(severity Severity, c *Chunk, format string, args ...interface{}) {
+	issue := Issue{Severity: severity, Offset: -1, Message: fmt.Sprintf(format, args...)}
+	if c != nil {
+		issue.Offset = int64(c.offset)
+		issue.ChunkID = c.Header.ID
+	}
+
+	r.Issues = append(r.Issues, issue)
+}
+
+// Validate checks structural integrity of parsed file.
+// Offsets are checked against positions chunks had in the source, so info should come straight from
+// ParseFile or Reader, without any modifications
+func Validate(info *USMInfo) ValidationReport {
+	var r ValidationReport
+
+	validateChunkSizes(info, &r)
+	validateEndMarkers(info, &r)
+	validateFrameTimes(info, &r)
+	validateSeek(info, _SFV, &r)
+	validateSeek(info, _ALP, &r)
+	validateAudioHeaders(info, &r)
+	validateCRID(info, &r)
+
+	return r
+}
+
+func validateChunkSizes(info *USMInfo, r *ValidationReport) {
+	for _, c := range info.allChunks() {
+		c := c
+		ph := c.Data.PayloadHeader
+
+		if int(ph.Offset) != ph.Len() {
+			r.add(SeverityError, &c, "payload header size is %#x, expected %#x", ph.Offset, ph.Len())
+		}
+
+		if c.payloadSize() < 0 {
+			r.add(SeverityError, &c, "chunk size %#x is too small for padding %#x", c.Header.Size, ph.PaddingSize)
+			continue
+		}
+
+		if c.Data.Payload != nil && len(c.Data.Payload) != c.payloadSize() {
+			r.add(SeverityError, &c, "payload has %#x bytes, but chunk header says %#x",
+				len(c.Data.Payload), c.payloadSize())
+		}
+
+		// 8 bytes of chunk header are included
+		if (c.Header.Size+8)%0x10 != 0 {
+			r.add(SeverityError, &c, "chunk size %#x is not padded to 16 bytes", c.Header.Size+8)
+		}
+
+		if ph.PaddingSize >= 0x10 && c.payloadSize() > 0 {
+			r.add(SeverityWarning, &c, "padding %#x is bigger than needed for alignment", ph.PaddingSize)
+		}
+	}
+}
+
+func validateEndMarkers(info *USMInfo, r *ValidationReport) {
+	var headerEnds, metadataEnds, contentsEnds = map[[4]byte]bool{}, map[[4]byte]bool{}, map[streamKey]bool{}
+
+	for _, c := range info.EndChunks {
+		c := c
+		switch {
+		case bytes.HasPrefix(c.Data.Payload, HeaderEnd[:]):
+			headerEnds[c.Header.ID] = true
+		case bytes.HasPrefix(c.Data.Payload, MetadataEnd[:]):
+			metadataEnds[c.Header.ID] = true
+		case bytes.HasPrefix(c.Data.Payload, ContentsEnd[:]):
+			contentsEnds[keyOf(c)] = true
+		default:
+			r.add(SeverityWarning, &c, "unknown end marker %q", strings.TrimRight(string(c.Data.Payload), "\x00"))
+		}
+	}
+
+	for _, id := range sortedIDs(info.HDRInfo) {
+		if !headerEnds[id] {
+			r.add(SeverityError, nil, "stream %s has no HEADER END marker", idToString(id))
+		}
+	}
+
+	for _, id := range sortedIDs(info.Metadata) {
+		if !metadataEnds[id] {
+			r.add(SeverityError, nil, "stream %s has no METADATA END marker", idToString(id))
+		}
+	}
+
+	for _, key := range streamKeys(info.streams()) {
+		if !contentsEnds[key] {
+			r.add(SeverityError, nil, "stream %s has no CONTENTS END marker", key)
+		}
+	}
+}
+
+func validateFrameTimes(info *USMInfo, r *ValidationReport) {
+	last := make(map[streamKey]Chunk)
+
+	for _, c := range info.allChunks() {
+		c := c
+		if c.Data.PayloadHeader.PayloadType != PayloadTypeStream || c.Header.ID == CRID {
+			continue
+		}
+
+		key := keyOf(c)
+		prev, ok := last[key]
+		last[key] = c
+		if !ok {
+			continue
+		}
+
+		prevTime, curTime := prev.Data.PayloadHeader.FrameTime, c.Data.PayloadHeader.FrameTime
+		// each video or alpha chunk is a separate frame, other streams might have chunks with the same time
+		isFrame := c.Header.ID == _SFV || c.Header.ID == _ALP
+		if (isFrame && curTime <= prevTime) || curTime < prevTime {
+			r.add(SeverityError, &c, "frame time %d of stream %s goes after %d", curTime, key, prevTime)
+		}
+	}
+}
+
+// validateSeek checks that seek info of video or alpha stream points to its frames
+func validateSeek(info *USMInfo, id [4]byte, r *ValidationReport) {
+	seek, ok := info.Metadata[id]
+	if !ok {
+		return
+	}
+
+	_, rows, err := seek.Table()
+	if err != nil {
+		r.add(SeverityError, &seek, "can't read seek info: %s", err)
+		return
+	}
+
+	// frame number of every chunk by its offset
+	frames := make(map[int64]int)
+	var frame int
+	for _, c := range info.allChunks() {
+		if c.Header.ID == id && c.Data.PayloadHeader.PayloadType == PayloadTypeStream {
+			frames[int64(c.offset)] = frame
+			frame++
+		}
+	}
+
+	for i, row := range rows {
+		ofs, okOfs := GetEntry(row, "ofs_byte")
+		frmID, okFrm := GetEntry(row, "ofs_frmid")
+		if !okOfs || !okFrm {
+			r.add(SeverityError, &seek, "seek entry #%d has no ofs_byte or ofs_frmid", i)
+			continue
+		}
+
+		actualFrame, found := frames[ofs.Int()]
+		if !found {
+			r.add(SeverityError, &seek, "seek entry #%d points to %#x, which is not a start of %s chunk",
+				i, ofs.Int(), idToString(id))
+			continue
+		}
+
+		if int64(actualFrame) != frmID.Int() {
+			r.add(SeverityError, &seek, "seek entry #%d points to frame %d, but chunk at %#x is frame %d",
+				i, frmID.Int(), ofs.Int(), actualFrame)
+		}
+	}
+}
+
+func validateAudioHeaders(info *USMInfo, r *ValidationReport) {
+	first := make(map[streamKey]bool)
+
+	for _, c := range info.AudioStreams {
+		c := c
+		key := keyOf(c)
+		isFirst := !first[key]
+		first[key] = true
+
+		codec := audioHeaderCodec(c)
+		name := audioCodecNames[uint64(codec)]
+		if codec != 0 && !isFirst {
+			r.add(SeverityError, &c, "%s header of stream %s is not the first audio chunk", name, key)
+		}
+
+		if codec != 0 {
+			if _, err := readAudioHeader(c); err != nil {
+				r.add(SeverityError, &c, "can't decode %s header: %s", name, err)
+			}
+		}
+
+		expected := audioCodec(info)
+		if !isFirst || expected == 0 {
+			continue
+		}
+
+		if codec == 0 {
+			r.add(SeverityError, &c, "first chunk of %s stream %s is not %s header",
+				audioCodecNames[uint64(expected)], key, audioCodecNames[uint64(expected)])
+		} else if codec != expected {
+			r.add(SeverityError, &c, "stream %s has %s header, but audio header info says %s",
+				key, name, audioCodecNames[uint64(expected)])
+		}
+	}
+}
+
+// values of audio_codec field from AUDIO_HDRINFO
+const (
+	audioCodecADX = 2
+	audioCodecHCA = 4
+)
+
+// audioCodec reads codec id from audio header info, returns 0 if it's unknown
+func audioCodec(info *USMInfo) int {
+	hdr, ok := info.HDRInfo[_SFA]
+	if !ok {
+		return 0
+	}
+
+	_, rows, err := hdr.Table()
+	if err != nil || len(rows) == 0 {
+		return 0
+	}
+
+	codec, ok := GetEntry(rows[0], "audio_codec")
+	if !ok {
+		return 0
+	}
+
+	return int(codec.Uint())
+}
+
+func validateCRID(info *USMInfo, r *ValidationReport) {
+	if info.CRID.Header.ID != CRID {
+		r.add(SeverityError, nil, "file has no CRID chunk")
+		return
+	}
+
+	crid := info.CRID
+	if crid.offset != 0 {
+		r.add(SeverityError, &crid, "CRID is not the first chunk of the file")
+	}
+
+	name, rows, err := crid.Table()
+	if err != nil {
+		r.add(SeverityError, &crid, "can't read CRID table: %s", err)
+		return
+	}
+
+	if name != "CRIUSF_DIR_STREAM" {
+		r.add(SeverityWarning, &crid, "unexpected CRID table name %q", name)
+	}
+
+	listed := make(map[streamKey]bool)
+	for i, row := range rows {
+		key, ok := cridKey(row)
+		if !ok {
+			r.add(SeverityError, &crid, "CRID entry #%d has no stmid or chno", i)
+			continue
+		}
+
+		// first entry describes the file itself
+		if key.ID == [4]byte{} {
+			continue
+		}
+
+		listed[key] = true
+	}
+
+	present := make(map[streamKey]bool)
+	for _, key := range streamKeys(info.streams()) {
+		present[key] = true
+	}
+
+	// unknown streams are not required to be listed
+	for _, key := range streamKeys(info.knownStreams()) {
+		if !listed[key] {
+			r.add(SeverityError, &crid, "stream %s is not listed in CRID", key)
+		}
+	}
+
+	for _, key := range sortedKeys(listed) {
+		if !present[key] {
+			r.add(SeverityError, &crid, "stream %s is listed in CRID but has no chunks", key)
+		}
+	}
+}
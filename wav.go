@@ -0,0 +1,246 @@
+package parser
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// WAVAudio is decoded 16-bit PCM audio
+type WAVAudio struct {
+	SampleRate int
+	Channels   int
+	// interleaved samples of all channels
+	Samples []int16
+}
+
+// Len returns number of samples per channel
+func (w *WAVAudio) Len() int {
+	return len(w.Samples) / w.Channels
+}
+
+// Duration returns length of audio in seconds
+func (w *WAVAudio) Duration() float64 {
+	return float64(w.Len()) / float64(w.SampleRate)
+}
+
+// wave format tags
+const (
+	wavFormatPCM        = 1
+	wavFormatExtensible = 0xFFFE
+)
+
+// ReadWAV reads 16-bit PCM WAV file
+func ReadWAV(src io.Reader) (*WAVAudio, error) {
+	var riff struct {
+		RIFF [4]byte
+		Size uint32
+		WAVE [4]byte
+	}
+	if err := binary.Read(src, binary.LittleEndian, &riff); err != nil {
+		return nil, fmt.Errorf("can't read WAV header: %w", err)
+	}
+
+	if string(riff.RIFF[:]) != "RIFF" || string(riff.WAVE[:]) != "WAVE" {
+		return nil, errors.New("not a WAV file")
+	}
+
+	var result *WAVAudio
+	for {
+		var chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err := binary.Read(src, binary.LittleEndian, &chunk); err != nil {
+			return nil, fmt.Errorf("WAV file has no data: %w", err)
+		}
+
+		switch string(chunk.ID[:]) {
+		case "fmt ":
+			var format struct {
+				Format        uint16
+				Channels      uint16
+				SampleRate    uint32
+				ByteRate      uint32
+				BlockAlign    uint16
+				BitsPerSample uint16
+			}
+			if chunk.Size < 16 {
+				return nil, fmt.Errorf("WAV format is too short: %d bytes", chunk.Size)
+			}
+			if err := binary.Read(src, binary.LittleEndian, &format); err != nil {
+				return nil, fmt.Errorf("can't read WAV format: %w", err)
+			}
+			// extensible format keeps actual format in the extension, first 2 bytes of subformat GUID
+			rest := make([]byte, chunk.Size-16+chunk.Size%2)
+			if _, err := io.ReadFull(src, rest); err != nil {
+				return nil, fmt.Errorf("can't read WAV format: %w", err)
+			}
+			if format.Format == wavFormatExtensible && len(rest) >= 10 {
+				format.Format = binary.LittleEndian.Uint16(rest[8:])
+			}
+
+			if format.Format != wavFormatPCM || format.BitsPerSample != 16 {
+				return nil, fmt.Errorf("only 16-bit PCM is supported, got format %d with %d bits",
+					format.Format, format.BitsPerSample)
+			}
+			if format.Channels == 0 || format.SampleRate == 0 {
+				return nil, fmt.Errorf("bad WAV format: %d channels, %d Hz", format.Channels, format.SampleRate)
+			}
+
+			result = &WAVAudio{SampleRate: int(format.SampleRate), Channels: int(format.Channels)}
+		case "data":
+			if result == nil {
+				return nil, errors.New("WAV data goes before format")
+			}
+
+			// some writers don't fill size of data when streaming, so take what's there
+			data, err := io.ReadAll(io.LimitReader(src, int64(chunk.Size)))
+			if err != nil {
+				return nil, fmt.Errorf("can't read WAV data: %w", err)
+			}
+
+			frame := 2 * result.Channels
+			data = data[:len(data)-len(data)%frame]
+			result.Samples = make([]int16, len(data)/2)
+			for i := range result.Samples {
+				result.Samples[i] = int16(binary.LittleEndian.Uint16(data[i*2:]))
+			}
+
+			return result, nil
+		default:
+			if _, err := io.CopyN(io.Discard, src, int64(chunk.Size+chunk.Size%2)); err != nil {
+				return nil, fmt.Errorf("can't skip WAV chunk %q: %w", chunk.ID, err)
+			}
+		}
+	}
+}
+
+// WriteWAVHeader writes header of 16-bit PCM WAV file, samples is a number of samples per channel
+func WriteWAVHeader(out io.Writer, sampleRate, channels int, samples uint64) error {
+	dataSize := samples * uint64(channels) * 2
+	if dataSize > 0xFFFFFFFF-36 {
+		return fmt.Errorf("%d samples don't fit into WAV file", samples)
+	}
+
+	header := struct {
+		RIFF          [4]byte
+		Size          uint32
+		WAVE          [4]byte
+		Fmt           [4]byte
+		FmtSize       uint32
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Data          [4]byte
+		DataSize      uint32
+	}{
+		RIFF:          [4]byte{'R', 'I', 'F', 'F'},
+		Size:          uint32(36 + dataSize),
+		WAVE:          [4]byte{'W', 'A', 'V', 'E'},
+		Fmt:           [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		Format:        1,
+		Channels:      uint16(channels),
+		SampleRate:    uint32(sampleRate),
+		ByteRate:      uint32(sampleRate * channels * 2),
+		BlockAlign:    uint16(channels * 2),
+		BitsPerSample: 16,
+		Data:          [4]byte{'d', 'a', 't', 'a'},
+		DataSize:      uint32(dataSize),
+	}
+
+	return binary.Write(out, binary.LittleEndian, header)
+}
+
+// ExtractWAV decodes audio stream with provided channel and writes it to out as WAV file.
+// Key is needed only for encrypted streams
+func (s *USMInfo) ExtractWAV(channel byte, key uint64, out io.Writer) error {
+	chunks := s.streamOf(_SFA, channel)
+	if len(chunks) == 0 {
+		return fmt.Errorf("file has no audio stream with channel %d", channel)
+	}
+
+	switch audioHeaderCodec(chunks[0]) {
+	case audioCodecHCA:
+		return decodeHCA(chunks, key, out)
+	case audioCodecADX:
+		return decodeADX(chunks, out)
+	default:
+		return fmt.Errorf("audio stream %d is neither HCA nor ADX", channel)
+	}
+}
+
+func decodeHCA(chunks []Chunk, key uint64, out io.Writer) error {
+	h, err := readHCAHeader(chunks[0])
+	if err != nil {
+		return err
+	}
+
+	decoder, err := NewHCADecoder(h, key)
+	if err != nil {
+		return err
+	}
+
+	if err = WriteWAVHeader(out, h.SampleRate, h.Channels, h.Samples()); err != nil {
+		return err
+	}
+
+	// header chunk might have first blocks after the header
+	buf, err := chunks[0].ReadPayload()
+	if err != nil {
+		return err
+	}
+	buf = buf[h.HeaderSize:]
+
+	skip := int(h.EncoderDelay) * h.Channels
+	left := int(h.Samples()) * h.Channels
+	var block uint32
+
+	for i := 1; ; i++ {
+		for len(buf) >= int(h.BlockSize) && block < h.BlockCount && left > 0 {
+			samples, err := decoder.DecodeBlock(buf)
+			if err != nil {
+				return fmt.Errorf("can't decode block %d: %w", block, err)
+			}
+			buf = buf[h.BlockSize:]
+			block++
+
+			if skip >= len(samples) {
+				skip -= len(samples)
+				continue
+			}
+			samples = samples[skip:]
+			skip = 0
+
+			if len(samples) > left {
+				samples = samples[:left]
+			}
+			left -= len(samples)
+
+			if err = binary.Write(out, binary.LittleEndian, samples); err != nil {
+				return err
+			}
+		}
+
+		if left <= 0 || i >= len(chunks) {
+			break
+		}
+
+		payload, err := chunks[i].ReadPayload()
+		if err != nil {
+			return err
+		}
+		buf = append(buf, payload...)
+	}
+
+	if left > 0 {
+		return fmt.Errorf("stream ended after %d of %d blocks", block, h.BlockCount)
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendChunk(b []byte, id string, data []byte) []byte {
+	b = append(b, id...)
+	b = appendUint32(b, uint32(len(data)))
+	b = append(b, data...)
+	if len(data)%2 != 0 {
+		b = append(b, 0)
+	}
+
+	return b
+}
+
+func TestReadWAV(t *testing.T) {
+	samples := testTone(22050, 2, 100)
+	data := make([]byte, 0, len(samples)*2)
+	for _, s := range samples {
+		data = appendUint16(data, uint16(s))
+	}
+
+	pcm := make([]byte, 16)
+	binary.LittleEndian.PutUint16(pcm[0:], wavFormatPCM)
+	binary.LittleEndian.PutUint16(pcm[2:], 2)
+	binary.LittleEndian.PutUint32(pcm[4:], 22050)
+	binary.LittleEndian.PutUint32(pcm[8:], 22050*4)
+	binary.LittleEndian.PutUint16(pcm[12:], 4)
+	binary.LittleEndian.PutUint16(pcm[14:], 16)
+
+	// WAVE_FORMAT_EXTENSIBLE with KSDATAFORMAT_SUBTYPE_PCM
+	extensible := append([]byte(nil), pcm...)
+	binary.LittleEndian.PutUint16(extensible[0:], wavFormatExtensible)
+	extensible = appendUint16(extensible, 22)
+	extensible = appendUint16(extensible, 16)
+	extensible = appendUint32(extensible, 3)
+	extensible = append(extensible, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00,
+		0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71)
+
+	float := append([]byte(nil), extensible...)
+	float[24] = 3
+
+	tests := []struct {
+		name   string
+		chunks func(b []byte) []byte
+		err    bool
+	}{
+		{
+			name: "pcm",
+			chunks: func(b []byte) []byte {
+				return appendChunk(appendChunk(b, "fmt ", pcm), "data", data)
+			},
+		},
+		{
+			name: "extensible",
+			chunks: func(b []byte) []byte {
+				return appendChunk(appendChunk(b, "fmt ", extensible), "data", data)
+			},
+		},
+		{
+			name: "odd-sized chunks",
+			chunks: func(b []byte) []byte {
+				b = appendChunk(b, "JUNK", []byte{1, 2, 3})
+				b = appendChunk(b, "fmt ", extensible)
+				b = appendChunk(b, "LIST", []byte("INFOISFT\x05\x00\x00\x00test\x00"))
+				return appendChunk(b, "data", data)
+			},
+		},
+		{
+			name: "float",
+			chunks: func(b []byte) []byte {
+				return appendChunk(appendChunk(b, "fmt ", float), "data", data)
+			},
+			err: true,
+		},
+		{
+			name: "data before format",
+			chunks: func(b []byte) []byte {
+				return appendChunk(b, "data", data)
+			},
+			err: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := tt.chunks([]byte("RIFF\x00\x00\x00\x00WAVE"))
+			binary.LittleEndian.PutUint32(file[4:], uint32(len(file)-8))
+
+			wav, err := ReadWAV(bytes.NewReader(file))
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if wav.SampleRate != 22050 || wav.Channels != 2 {
+				t.Fatalf("got %d channels, %d Hz", wav.Channels, wav.SampleRate)
+			}
+			if !equalSamples(wav.Samples, samples) {
+				t.Fatal("samples don't match")
+			}
+		})
+	}
+}
+
+func TestWriteWAVHeader(t *testing.T) {
+	samples := testTone(48000, 3, 257)
+
+	var b bytes.Buffer
+	if err := WriteWAVHeader(&b, 48000, 3, 257); err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != 44 {
+		t.Fatalf("header has %d bytes", b.Len())
+	}
+	if err := binary.Write(&b, binary.LittleEndian, samples); err != nil {
+		t.Fatal(err)
+	}
+
+	if size := binary.LittleEndian.Uint32(b.Bytes()[4:]); int(size) != b.Len()-8 {
+		t.Fatalf("RIFF size %d, file has %d bytes", size, b.Len())
+	}
+
+	wav, err := ReadWAV(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wav.SampleRate != 48000 || wav.Channels != 3 || wav.Len() != 257 {
+		t.Fatalf("got %d samples of %d channels, %d Hz", wav.Len(), wav.Channels, wav.SampleRate)
+	}
+	if !equalSamples(wav.Samples, samples) {
+		t.Fatal("samples don't match")
+	}
+
+	if err = WriteWAVHeader(&b, 48000, 2, 1<<31); err == nil {
+		t.Fatal("expected error for data over 4 GiB")
+	}
+}